@@ -0,0 +1,206 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/holiman/uint256"
+)
+
+var (
+	// ErrInvalidAmount is returned when an amount string is not a plain decimal number, or
+	// when a negative amount is converted to an unsigned raw amount.
+	ErrInvalidAmount = errors.New("amount: invalid decimal number")
+	// ErrPrecisionLoss is returned when RoundExact is given and the result is not a whole
+	// number of raw units, such as an amount with more fractional digits than the token has
+	// decimals.
+	ErrPrecisionLoss = errors.New("amount: not a whole number of raw units")
+	// ErrAmountOverflow is returned when a raw amount does not fit in 256 bits.
+	ErrAmountOverflow = errors.New("amount: raw amount overflows uint256")
+)
+
+// Rounding selects how a value that falls between two raw units is resolved: fractional
+// digits beyond a token's decimals in ParseAmount, or a fractional fee in NetAmount.
+type Rounding uint8
+
+const (
+	// RoundExact rejects amounts that cannot be represented exactly with ErrPrecisionLoss.
+	// Surplus fractional digits that are all zero are accepted.
+	RoundExact Rounding = iota
+	// RoundDown truncates toward zero.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+	// RoundHalfUp rounds to the nearest raw unit, with ties away from zero.
+	RoundHalfUp
+	// RoundHalfEven rounds to the nearest raw unit, with ties to the even unit.
+	RoundHalfEven
+)
+
+// FormatOptions controls how FormatAmount renders a raw amount. The zero value renders
+// the exact amount with no trailing fractional zeros and no grouping.
+type FormatOptions struct {
+	// ThousandsSeparator, if set, is inserted between groups of three integer digits.
+	ThousandsSeparator string
+	// SignificantDigits, if positive, truncates the amount toward zero to that many
+	// significant digits.
+	SignificantDigits int
+}
+
+// ParseAmount converts a human-readable decimal amount such as "1.5" into raw token units
+// for a token with the given decimals. The amount may have a leading sign, and either the
+// integer or the fractional part may be empty but not both; exponents and digit separators
+// are rejected. Fractional digits beyond decimals are handled according to rounding.
+func ParseAmount(amount string, decimals uint8, rounding Rounding) (*big.Int, error) {
+	digits := amount
+	negative := false
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		negative = digits[0] == '-'
+		digits = digits[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+
+	var dropped string
+	if len(fracPart) > int(decimals) {
+		fracPart, dropped = fracPart[:decimals], fracPart[decimals:]
+	}
+	raw, _ := new(big.Int).SetString(intPart+fracPart+strings.Repeat("0", int(decimals)-len(fracPart)), 10)
+
+	if strings.Trim(dropped, "0") != "" {
+		roundUp, err := roundsUp(rounding, dropped, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q has %d fractional digits, token has %d", err, amount, len(fracPart)+len(dropped), decimals)
+		}
+		if roundUp {
+			raw.Add(raw, big.NewInt(1))
+		}
+	}
+	if negative {
+		raw.Neg(raw)
+	}
+	return raw, nil
+}
+
+// ParseAmountUint256 is ParseAmount for unsigned 256-bit raw amounts. Negative amounts
+// are rejected with ErrInvalidAmount.
+func ParseAmountUint256(amount string, decimals uint8, rounding Rounding) (*uint256.Int, error) {
+	raw, err := ParseAmount(amount, decimals, rounding)
+	if err != nil {
+		return nil, err
+	}
+	if raw.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %q is negative", ErrInvalidAmount, amount)
+	}
+	out, overflow := uint256.FromBig(raw)
+	if overflow {
+		return nil, fmt.Errorf("%w: %q", ErrAmountOverflow, amount)
+	}
+	return out, nil
+}
+
+// roundsUp reports whether the magnitude raw, whose non-zero surplus digits are dropped,
+// should be incremented by one unit.
+func roundsUp(rounding Rounding, dropped string, raw *big.Int) (bool, error) {
+	switch rounding {
+	case RoundDown:
+		return false, nil
+	case RoundUp:
+		return true, nil
+	case RoundHalfUp:
+		return dropped[0] >= '5', nil
+	case RoundHalfEven:
+		if dropped[0] != '5' || strings.Trim(dropped[1:], "0") != "" {
+			return dropped[0] >= '5', nil
+		}
+		return raw.Bit(0) == 1, nil
+	default:
+		return false, ErrPrecisionLoss
+	}
+}
+
+// isDigits reports whether s consists only of ASCII digits. The empty string qualifies.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatAmount renders a raw amount of a token with the given decimals as a decimal
+// string, such as "1.5" for 1500000 with 6 decimals.
+func FormatAmount(raw *big.Int, decimals uint8, opts FormatOptions) string {
+	digits := new(big.Int).Abs(raw).String()
+	if n := opts.SignificantDigits; n > 0 && n < len(digits) && digits != "0" {
+		digits = digits[:n] + strings.Repeat("0", len(digits)-n)
+	}
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	split := len(digits) - int(decimals)
+	intPart, fracPart := digits[:split], strings.TrimRight(digits[split:], "0")
+
+	var b strings.Builder
+	if raw.Sign() < 0 {
+		b.WriteByte('-')
+	}
+	for i := 0; i < len(intPart); i++ {
+		if i > 0 && opts.ThousandsSeparator != "" && (len(intPart)-i)%3 == 0 {
+			b.WriteString(opts.ThousandsSeparator)
+		}
+		b.WriteByte(intPart[i])
+	}
+	if fracPart != "" {
+		b.WriteByte('.')
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// FormatAmountUint256 is FormatAmount for unsigned 256-bit raw amounts.
+func FormatAmountUint256(raw *uint256.Int, decimals uint8, opts FormatOptions) string {
+	return FormatAmount(raw.ToBig(), decimals, opts)
+}
+
+// ToRaw converts a human-readable amount of token id into raw units using the token's
+// decimals. See ParseAmount for the accepted syntax and rounding.
+func (ts *TokenSystem) ToRaw(id uint64, amount string, rounding Rounding) (*big.Int, error) {
+	token, err := ts.GetTokenByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAmount(amount, token.Decimals, rounding)
+}
+
+// ToRawUint256 is ToRaw for unsigned 256-bit raw amounts.
+func (ts *TokenSystem) ToRawUint256(id uint64, amount string, rounding Rounding) (*uint256.Int, error) {
+	token, err := ts.GetTokenByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAmountUint256(amount, token.Decimals, rounding)
+}
+
+// FromRaw renders a raw amount of token id as a decimal string using the token's decimals.
+func (ts *TokenSystem) FromRaw(id uint64, raw *uint256.Int, opts FormatOptions) (string, error) {
+	token, err := ts.GetTokenByID(id)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmountUint256(raw, token.Decimals, opts), nil
+}
+
+// FromRawBig is FromRaw for big.Int raw amounts, which may be negative.
+func (ts *TokenSystem) FromRawBig(id uint64, raw *big.Int, opts FormatOptions) (string, error) {
+	token, err := ts.GetTokenByID(id)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmount(raw, token.Decimals, opts), nil
+}
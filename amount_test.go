@@ -0,0 +1,184 @@
+package token
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// bigInt parses a base-10 integer, failing the test if it is malformed.
+func bigInt(t *testing.T, s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	require.True(t, ok, "bad integer %q", s)
+	return v
+}
+
+// --- Unit Tests ---
+
+func TestParseAmount(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		amount      string
+		decimals    uint8
+		rounding    Rounding
+		expected    string
+		expectedErr error
+	}{
+		{name: "Integer", amount: "42", decimals: 6, expected: "42000000"},
+		{name: "Fraction", amount: "1.5", decimals: 6, expected: "1500000"},
+		{name: "Leading point", amount: ".25", decimals: 2, expected: "25"},
+		{name: "Trailing point", amount: "7.", decimals: 2, expected: "700"},
+		{name: "Zero decimals", amount: "12", decimals: 0, expected: "12"},
+		{name: "Negative", amount: "-0.1", decimals: 18, expected: "-100000000000000000"},
+		{name: "Explicit plus", amount: "+3", decimals: 1, expected: "30"},
+		{name: "Surplus zeros are exact", amount: "1.500000000", decimals: 6, expected: "1500000"},
+		{name: "Beyond uint256", amount: strings.Repeat("9", 80), decimals: 18, expected: strings.Repeat("9", 80) + strings.Repeat("0", 18)},
+		{name: "Precision loss", amount: "1.0000001", decimals: 6, expectedErr: ErrPrecisionLoss},
+		{name: "Round down", amount: "1.0000019", decimals: 6, rounding: RoundDown, expected: "1000001"},
+		{name: "Round up", amount: "1.0000011", decimals: 6, rounding: RoundUp, expected: "1000002"},
+		{name: "Round up negative", amount: "-1.01", decimals: 1, rounding: RoundUp, expected: "-11"},
+		{name: "Half up tie", amount: "0.25", decimals: 1, rounding: RoundHalfUp, expected: "3"},
+		{name: "Half up below", amount: "0.249", decimals: 1, rounding: RoundHalfUp, expected: "2"},
+		{name: "Half even tie to even", amount: "0.25", decimals: 1, rounding: RoundHalfEven, expected: "2"},
+		{name: "Half even tie to odd", amount: "0.35", decimals: 1, rounding: RoundHalfEven, expected: "4"},
+		{name: "Half even above tie", amount: "0.2501", decimals: 1, rounding: RoundHalfEven, expected: "3"},
+		{name: "Half even negative", amount: "-0.35", decimals: 1, rounding: RoundHalfEven, expected: "-4"},
+		{name: "Empty", amount: "", decimals: 6, expectedErr: ErrInvalidAmount},
+		{name: "Lone point", amount: ".", decimals: 6, expectedErr: ErrInvalidAmount},
+		{name: "Exponent", amount: "1e6", decimals: 6, expectedErr: ErrInvalidAmount},
+		{name: "Separator", amount: "1,000", decimals: 6, expectedErr: ErrInvalidAmount},
+		{name: "Whitespace", amount: " 1", decimals: 6, expectedErr: ErrInvalidAmount},
+		{name: "Two points", amount: "1.2.3", decimals: 6, expectedErr: ErrInvalidAmount},
+		{name: "Double sign", amount: "--1", decimals: 6, expectedErr: ErrInvalidAmount},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := ParseAmount(tc.amount, tc.decimals, tc.rounding)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, raw.String())
+		})
+	}
+}
+
+func TestParseAmountUint256(t *testing.T) {
+	t.Parallel()
+	raw, err := ParseAmountUint256("1.5", 18, RoundExact)
+	require.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(1_500_000_000_000_000_000), raw)
+
+	max := new(uint256.Int).SetAllOne()
+	raw, err = ParseAmountUint256(FormatAmountUint256(max, 18, FormatOptions{}), 18, RoundExact)
+	require.NoError(t, err)
+	assert.Equal(t, max, raw)
+
+	_, err = ParseAmountUint256(strings.Repeat("9", 80), 0, RoundExact)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+	_, err = ParseAmountUint256("-1", 18, RoundExact)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestFormatAmount(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		raw      string
+		decimals uint8
+		opts     FormatOptions
+		expected string
+	}{
+		{name: "Fraction", raw: "1500000", decimals: 6, expected: "1.5"},
+		{name: "Whole", raw: "2000000", decimals: 6, expected: "2"},
+		{name: "Below one", raw: "42", decimals: 6, expected: "0.000042"},
+		{name: "Zero", raw: "0", decimals: 18, expected: "0"},
+		{name: "Zero decimals", raw: "1234", decimals: 0, expected: "1234"},
+		{name: "Negative", raw: "-1500000", decimals: 6, expected: "-1.5"},
+		{name: "Thousands", raw: "1234567890123", decimals: 6, opts: FormatOptions{ThousandsSeparator: ","}, expected: "1,234,567.890123"},
+		{name: "Thousands short", raw: "999000000", decimals: 6, opts: FormatOptions{ThousandsSeparator: ","}, expected: "999"},
+		{name: "Thousands negative", raw: "-1000000000", decimals: 6, opts: FormatOptions{ThousandsSeparator: "_"}, expected: "-1_000"},
+		{name: "Significant fraction", raw: "1234567", decimals: 6, opts: FormatOptions{SignificantDigits: 3}, expected: "1.23"},
+		{name: "Significant truncates", raw: "1999999", decimals: 6, opts: FormatOptions{SignificantDigits: 2}, expected: "1.9"},
+		{name: "Significant integer", raw: "123456000000", decimals: 6, opts: FormatOptions{SignificantDigits: 2}, expected: "120000"},
+		{name: "Significant small", raw: "1234", decimals: 18, opts: FormatOptions{SignificantDigits: 2}, expected: "0.0000000000000012"},
+		{name: "Significant more than digits", raw: "15", decimals: 1, opts: FormatOptions{SignificantDigits: 10}, expected: "1.5"},
+		{name: "Both", raw: "1234567890000", decimals: 6, opts: FormatOptions{ThousandsSeparator: ",", SignificantDigits: 4}, expected: "1,234,000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FormatAmount(bigInt(t, tc.raw), tc.decimals, tc.opts))
+		})
+	}
+}
+
+func TestAmount_RoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, amount := range []string{"0", "1", "0.000001", "123456.789", "-42.5", strings.Repeat("9", 40) + ".123"} {
+		raw, err := ParseAmount(amount, 6, RoundExact)
+		require.NoError(t, err)
+		assert.Equal(t, amount, FormatAmount(raw, 6, FormatOptions{}))
+	}
+}
+
+func TestTokenSystem_AmountConversion(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	usdc, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+	require.NoError(t, err)
+	weth, err := ts.AddToken(addr(2), "Wrapped Ether", "WETH", 18)
+	require.NoError(t, err)
+
+	raw, err := ts.ToRaw(usdc, "1.5", RoundExact)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1_500_000), raw)
+	raw256, err := ts.ToRawUint256(weth, "1.5", RoundExact)
+	require.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(1_500_000_000_000_000_000), raw256)
+
+	_, err = ts.ToRaw(usdc, "0.0000001", RoundExact)
+	assert.ErrorIs(t, err, ErrPrecisionLoss)
+	raw, err = ts.ToRaw(usdc, "0.0000001", RoundUp)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), raw)
+
+	s, err := ts.FromRaw(weth, uint256.NewInt(1_234_500_000_000_000_000), FormatOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "1.2345", s)
+	s, err = ts.FromRawBig(usdc, big.NewInt(-1_234_567_000_000), FormatOptions{ThousandsSeparator: ","})
+	require.NoError(t, err)
+	assert.Equal(t, "-1,234,567", s)
+
+	_, err = ts.ToRaw(99, "1", RoundExact)
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	_, err = ts.FromRaw(99, uint256.NewInt(1), FormatOptions{})
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+// --- Benchmarking ---
+
+func BenchmarkAmount(b *testing.B) {
+	raw := big.NewInt(1_234_567_890_123)
+	b.Run("Parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ParseAmount("1234567.890123", 6, RoundExact)
+		}
+	})
+	b.Run("Format", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = FormatAmount(raw, 6, FormatOptions{ThousandsSeparator: ","})
+		}
+	})
+}
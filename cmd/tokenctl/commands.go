@@ -0,0 +1,614 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func runList(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	var (
+		symbol   = fs.String("symbol", "", "only tokens with this symbol, compared as chosen by -match")
+		match    = fs.String("match", "exact", "symbol match: exact, fold, prefix or substring")
+		decimals = fs.String("decimals", "", "only tokens with decimals in `RANGE`: N, MIN-MAX, MIN- or -MAX")
+		fee      = fs.String("fee", "", "only tokens with a transfer fee in parts per million in `RANGE`")
+		gas      = fs.String("gas", "", "only tokens with transfer gas in `RANGE`")
+		required = fs.String("require", "", "only tokens with all of these risk `FLAGS`, such as pausable|honeypot")
+		excluded = fs.String("exclude", "", "only tokens with none of these risk `FLAGS`")
+		orderBy  = fs.String("order", "id", "order by id, symbol or address")
+		desc     = fs.Bool("desc", false, "order descending")
+		limit    = fs.Int("limit", 0, "list at most `N` tokens")
+		output   = fs.String("output", "table", "output format: table, json or csv")
+	)
+	rest, err := parseArgs(fs, args, 1, false)
+	if err != nil {
+		return err
+	}
+
+	q := token.Query{Symbol: *symbol, Descending: *desc, Limit: *limit}
+	switch *match {
+	case "exact":
+		q.SymbolMatch = token.SymbolExact
+	case "fold":
+		q.SymbolMatch = token.SymbolFold
+	case "prefix":
+		q.SymbolMatch = token.SymbolPrefix
+	case "substring":
+		q.SymbolMatch = token.SymbolSubstring
+	default:
+		return usagef("unknown -match %q", *match)
+	}
+	switch *orderBy {
+	case "id":
+		q.OrderBy = token.OrderByID
+	case "symbol":
+		q.OrderBy = token.OrderBySymbol
+	case "address":
+		q.OrderBy = token.OrderByAddress
+	default:
+		return usagef("unknown -order %q", *orderBy)
+	}
+	if q.Decimals, err = parseRange[uint8]("decimals", *decimals, 8); err != nil {
+		return err
+	}
+	if q.FeePPM, err = parseRange[uint32]("fee", *fee, 32); err != nil {
+		return err
+	}
+	if q.Gas, err = parseRange[uint64]("gas", *gas, 64); err != nil {
+		return err
+	}
+	if q.Flags.Require, err = parseFlagsArg("require", *required); err != nil {
+		return err
+	}
+	if q.Flags.Exclude, err = parseFlagsArg("exclude", *excluded); err != nil {
+		return err
+	}
+
+	ts, _, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	page, err := ts.Query(q)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "table":
+		return writeTable(stdout, page.Tokens)
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(page.Tokens)
+	case "csv":
+		return writeCSV(stdout, page.Tokens)
+	default:
+		return usagef("unknown -output %q", *output)
+	}
+}
+
+// writeTable prints tokens as aligned columns.
+func writeTable(w io.Writer, tokens []token.TokenView) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tADDRESS\tSYMBOL\tNAME\tDECIMALS\tFEE PPM\tGAS\tFLAGS")
+	for _, v := range tokens {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			v.ID, v.Address.Hex(), v.Symbol, v.Name, v.Decimals, v.FeeOnTransferPPM, v.GasForTransfer, v.Flags)
+	}
+	return tw.Flush()
+}
+
+// outputFlags adds the flags of commands that write the registry back.
+func outputFlags(fs *flag.FlagSet) (out, formatName *string, lossy *bool) {
+	out = fs.String("o", "", "write the result to `FILE` instead of replacing the input")
+	formatName = fs.String("format", "", "format of the written file: binary, json or csv (default: that of the input, or the extension of -o)")
+	lossy = lossyFlag(fs)
+	return out, formatName, lossy
+}
+
+func lossyFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("lossy", false, "allow writing CSV even though it drops the IDs of deleted tokens")
+}
+
+// save writes ts to out, or back to in when out is empty. Without an explicit format, a
+// file written in place keeps its format.
+func save(ts *token.TokenSystem, in string, inFormat format, out, formatName string, lossy bool) error {
+	f, err := parseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		out = in
+		if f == "" {
+			f = inFormat
+		}
+	}
+	f = formatForPath(out, f)
+	if err := checkLossy(f, ts.State(), lossy); err != nil {
+		return err
+	}
+	return writeSystem(out, f, ts)
+}
+
+func runAdd(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	var (
+		address  = fs.String("address", "", "token contract `ADDRESS` (required)")
+		name     = fs.String("name", "", "token name")
+		symbol   = fs.String("symbol", "", "token symbol (required)")
+		decimals = fs.Uint("decimals", 18, "token decimals")
+		fee      = fs.Uint("fee", 0, "transfer fee in parts per million")
+		gas      = fs.Uint64("gas", 0, "gas used by a transfer")
+		flags    = fs.String("flags", "", "risk `FLAGS`, such as pausable|upgradeable")
+	)
+	out, formatName, lossy := outputFlags(fs)
+	rest, err := parseArgs(fs, args, 1, false)
+	if err != nil {
+		return err
+	}
+	addr, err := parseAddress(*address)
+	if err != nil {
+		return err
+	}
+	if *decimals > 255 {
+		return usagef("-decimals %d exceeds 255", *decimals)
+	}
+	if *fee > token.FeeDenominator {
+		return usagef("-fee %d exceeds %d", *fee, token.FeeDenominator)
+	}
+	riskFlags, err := parseFlagsArg("flags", *flags)
+	if err != nil {
+		return err
+	}
+
+	ts, f, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	var id uint64
+	err = ts.Update(func(tx *token.Tx) error {
+		var err error
+		if id, err = tx.AddToken(addr, *name, *symbol, uint8(*decimals)); err != nil {
+			return err
+		}
+		if *fee != 0 || *gas != 0 {
+			if err := tx.UpdateTokenPPM(id, uint32(*fee), *gas); err != nil {
+				return err
+			}
+		}
+		if riskFlags != 0 {
+			return tx.SetFlags(id, riskFlags)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := save(ts, rest[0], f, *out, *formatName, *lossy); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, id)
+	return nil
+}
+
+// selectorFlags adds the -id and -address flags of commands that act on one token.
+func selectorFlags(fs *flag.FlagSet) (id *uint64, address *string) {
+	id = fs.Uint64("id", 0, "select the token by `ID`")
+	address = fs.String("address", "", "select the token by `ADDRESS`")
+	return id, address
+}
+
+// selectToken resolves the token chosen by exactly one of -id and -address.
+func selectToken(ts *token.TokenSystem, id uint64, address string) (token.TokenView, error) {
+	switch {
+	case (id == 0) == (address == ""):
+		return token.TokenView{}, usagef("give exactly one of -id and -address")
+	case id != 0:
+		return ts.GetTokenByID(id)
+	default:
+		addr, err := parseAddress(address)
+		if err != nil {
+			return token.TokenView{}, err
+		}
+		return ts.GetTokenByAddress(addr)
+	}
+}
+
+func runDelete(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	id, address := selectorFlags(fs)
+	out, formatName, lossy := outputFlags(fs)
+	rest, err := parseArgs(fs, args, 1, false)
+	if err != nil {
+		return err
+	}
+	ts, f, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	view, err := selectToken(ts, *id, *address)
+	if err != nil {
+		return err
+	}
+	if err := ts.DeleteToken(view.ID); err != nil {
+		return err
+	}
+	return save(ts, rest[0], f, *out, *formatName, *lossy)
+}
+
+func runUpdate(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	id, address := selectorFlags(fs)
+	var (
+		fee   = fs.Uint("fee", 0, "set the transfer fee in parts per million")
+		gas   = fs.Uint64("gas", 0, "set the gas used by a transfer")
+		flags = fs.String("flags", "", "replace the risk flags with `FLAGS`; \"none\" clears them")
+	)
+	out, formatName, lossy := outputFlags(fs)
+	rest, err := parseArgs(fs, args, 1, false)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["fee"] && !set["gas"] && !set["flags"] {
+		return usagef("nothing to update: give -fee, -gas or -flags")
+	}
+	if *fee > token.FeeDenominator {
+		return usagef("-fee %d exceeds %d", *fee, token.FeeDenominator)
+	}
+	riskFlags, err := parseFlagsArg("flags", *flags)
+	if err != nil {
+		return err
+	}
+
+	ts, f, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	view, err := selectToken(ts, *id, *address)
+	if err != nil {
+		return err
+	}
+	err = ts.Update(func(tx *token.Tx) error {
+		newFee, newGas := view.FeeOnTransferPPM, view.GasForTransfer
+		if set["fee"] {
+			newFee = uint32(*fee)
+		}
+		if set["gas"] {
+			newGas = *gas
+		}
+		if newFee != view.FeeOnTransferPPM || newGas != view.GasForTransfer {
+			if err := tx.UpdateTokenPPM(view.ID, newFee, newGas); err != nil {
+				return err
+			}
+		}
+		if !set["flags"] {
+			return nil
+		}
+		if clear := view.Flags &^ riskFlags; clear != 0 {
+			if err := tx.ClearFlags(view.ID, clear); err != nil {
+				return err
+			}
+		}
+		if add := riskFlags &^ view.Flags; add != 0 {
+			return tx.SetFlags(view.ID, add)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return save(ts, rest[0], f, *out, *formatName, *lossy)
+}
+
+func runImport(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	chainID := fs.Uint64("chain", 0, "import the tokens for chain `ID` (required)")
+	out, formatName, lossy := outputFlags(fs)
+	rest, err := parseArgs(fs, args, 2, true)
+	if err != nil {
+		return err
+	}
+	if *chainID == 0 {
+		return usagef("-chain is required")
+	}
+
+	ts, f, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	var lists []*token.TokenList
+	for _, path := range rest[1:] {
+		list, err := readTokenListFile(path)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, list)
+	}
+	result, err := ts.ImportTokenLists(*chainID, lists...)
+	if err != nil {
+		return err
+	}
+	if err := save(ts, rest[0], f, *out, *formatName, *lossy); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "added %d tokens\n", len(result.Added))
+	failed := make([]common.Address, 0, len(result.Failed))
+	for addr := range result.Failed {
+		failed = append(failed, addr)
+	}
+	slices.SortFunc(failed, func(a, b common.Address) int { return a.Cmp(b) })
+	for _, addr := range failed {
+		fmt.Fprintf(stdout, "skipped %s: %v\n", addr.Hex(), result.Failed[addr])
+	}
+	for _, c := range result.Conflicts {
+		fmt.Fprintf(stdout, "conflict %s: lists %s disagree on %s\n",
+			c.Address.Hex(), strings.Join(c.Lists, ", "), strings.Join(c.Fields, ", "))
+	}
+	return nil
+}
+
+func readTokenListFile(path string) (*token.TokenList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	list, err := token.ReadTokenList(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return list, nil
+}
+
+func runDiff(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	asJSON := fs.Bool("json", false, "print the changeset as JSON, for patch")
+	rest, err := parseArgs(fs, args, 2, false)
+	if err != nil {
+		return err
+	}
+	oldState, _, err := readState(rest[0])
+	if err != nil {
+		return err
+	}
+	newState, _, err := readState(rest[1])
+	if err != nil {
+		return err
+	}
+
+	changes, err := token.Diff(oldState.Tokens, newState.Tokens)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			return err
+		}
+	}
+	if changes.IsEmpty() {
+		return nil
+	}
+	if *asJSON {
+		return errFound
+	}
+
+	// Print the changes as one list ordered by ID.
+	type line struct {
+		id   uint64
+		text string
+	}
+	var lines []line
+	for _, v := range changes.Added {
+		lines = append(lines, line{v.ID, fmt.Sprintf("+ %d %s %s", v.ID, v.Address.Hex(), v.Symbol)})
+	}
+	for _, v := range changes.Removed {
+		lines = append(lines, line{v.ID, fmt.Sprintf("- %d %s %s", v.ID, v.Address.Hex(), v.Symbol)})
+	}
+	for _, c := range changes.Changed {
+		text := fmt.Sprintf("~ %d %s %s: %s", c.ID, c.After.Address.Hex(), c.After.Symbol, strings.Join(fieldChanges(c), ", "))
+		lines = append(lines, line{c.ID, text})
+	}
+	slices.SortFunc(lines, func(a, b line) int { return cmp.Compare(a.id, b.id) })
+	for _, l := range lines {
+		fmt.Fprintln(stdout, l.text)
+	}
+	return errFound
+}
+
+// fieldChanges describes each changed field as "field old -> new".
+func fieldChanges(c token.TokenChange) []string {
+	changes := make([]string, len(c.Fields))
+	for i, field := range c.Fields {
+		var from, to any
+		switch field {
+		case "name":
+			from, to = strconv.Quote(c.Before.Name), strconv.Quote(c.After.Name)
+		case "symbol":
+			from, to = strconv.Quote(c.Before.Symbol), strconv.Quote(c.After.Symbol)
+		case "decimals":
+			from, to = c.Before.Decimals, c.After.Decimals
+		case "feeOnTransferPPM":
+			from, to = c.Before.FeeOnTransferPPM, c.After.FeeOnTransferPPM
+		case "gasForTransfer":
+			from, to = c.Before.GasForTransfer, c.After.GasForTransfer
+		case "flags":
+			from, to = c.Before.Flags, c.After.Flags
+		}
+		changes[i] = fmt.Sprintf("%s %v -> %v", field, from, to)
+	}
+	return changes
+}
+
+func runPatch(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	out, formatName, lossy := outputFlags(fs)
+	rest, err := parseArgs(fs, args, 2, false)
+	if err != nil {
+		return err
+	}
+	ts, f, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(rest[1])
+	if err != nil {
+		return err
+	}
+	var changes token.Changeset
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return fmt.Errorf("%s: %w", rest[1], err)
+	}
+	if err := ts.Apply(changes); err != nil {
+		return err
+	}
+	return save(ts, rest[0], f, *out, *formatName, *lossy)
+}
+
+func runValidate(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	rest, err := parseArgs(fs, args, 1, false)
+	if err != nil {
+		return err
+	}
+	state, _, err := readState(rest[0])
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return errFound
+	}
+	problems := checkState(state)
+	for _, p := range problems {
+		fmt.Fprintf(stdout, "%s: %s\n", rest[0], p)
+	}
+	if len(problems) > 0 {
+		return errFound
+	}
+	fmt.Fprintf(stdout, "%s: %d tokens, ok\n", rest[0], len(state.Tokens))
+	return nil
+}
+
+// checkState returns every problem with state: what token.NewTokenRegistryFromState
+// rejects, reported in full rather than stopping at the first, and tokens that break
+// token.DefaultValidationRules.
+func checkState(state token.RegistryState) []string {
+	var problems []string
+	rules := token.DefaultValidationRules()
+	ids := make(map[uint64]int, len(state.Tokens))
+	addresses := make(map[common.Address]uint64, len(state.Tokens))
+	var highest uint64
+	for i, v := range state.Tokens {
+		if v.ID == 0 {
+			problems = append(problems, fmt.Sprintf("token %d (%s): ID 0 is never issued", i, v.Address.Hex()))
+		}
+		if n := ids[v.ID]; n == 1 {
+			problems = append(problems, fmt.Sprintf("%v: %d", token.ErrDuplicateID, v.ID))
+		}
+		ids[v.ID]++
+		if other, ok := addresses[v.Address]; ok {
+			problems = append(problems, fmt.Sprintf("%v: %s is used by tokens %d and %d", token.ErrDuplicateAddress, v.Address.Hex(), other, v.ID))
+		} else {
+			addresses[v.Address] = v.ID
+		}
+		highest = max(highest, v.ID)
+
+		var errs []error
+		errs = append(errs, rules.ValidateAdd(v), rules.ValidateUpdate(v, v.FeeOnTransferPPM, v.GasForTransfer))
+		for _, err := range errs {
+			var validation *token.ValidationError
+			if errors.As(err, &validation) {
+				for _, field := range validation.Fields {
+					problems = append(problems, fmt.Sprintf("token %d: %s: %s", v.ID, field.Field, field.Reason))
+				}
+			}
+		}
+	}
+
+	tombstones := slices.Clone(state.Tombstones)
+	slices.Sort(tombstones)
+	for _, id := range slices.Compact(tombstones) {
+		if ids[id] > 0 {
+			problems = append(problems, fmt.Sprintf("%v: %d", token.ErrIDReused, id))
+		}
+		highest = max(highest, id)
+	}
+	if state.NextID != 0 && state.NextID <= highest {
+		problems = append(problems, fmt.Sprintf("%v: nextID %d, highest ID %d", token.ErrInvalidNextID, state.NextID, highest))
+	}
+	return problems
+}
+
+func runConvert(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	formatName := fs.String("format", "", "format of OUT: binary, json or csv (default: from the extension of OUT)")
+	lossy := lossyFlag(fs)
+	rest, err := parseArgs(fs, args, 2, false)
+	if err != nil {
+		return err
+	}
+	f, err := parseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	ts, _, err := loadSystem(rest[0])
+	if err != nil {
+		return err
+	}
+	f = formatForPath(rest[1], f)
+	if err := checkLossy(f, ts.State(), *lossy); err != nil {
+		return err
+	}
+	return writeSystem(rest[1], f, ts)
+}
+
+// parseAddress parses a hex address given on the command line.
+func parseAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, usagef("%q is not an address", s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+func parseFlagsArg(name, s string) (token.RiskFlags, error) {
+	flags, err := token.ParseRiskFlags(s)
+	if err != nil {
+		return 0, usagef("-%s: %v", name, err)
+	}
+	return flags, nil
+}
+
+// parseRange parses a range flag: "N", "MIN-MAX", "MIN-" or "-MAX". Empty means no
+// filter.
+func parseRange[T uint8 | uint32 | uint64](name, s string, bits int) (*token.Range[T], error) {
+	if s == "" {
+		return nil, nil
+	}
+	rawMin, rawMax, isRange := strings.Cut(s, "-")
+	if !isRange {
+		rawMax = rawMin
+	}
+	r := &token.Range[T]{Max: ^T(0)}
+	if rawMin != "" {
+		v, err := strconv.ParseUint(rawMin, 10, bits)
+		if err != nil {
+			return nil, usagef("-%s: %v", name, err)
+		}
+		r.Min = T(v)
+	}
+	if rawMax != "" {
+		v, err := strconv.ParseUint(rawMax, 10, bits)
+		if err != nil {
+			return nil, usagef("-%s: %v", name, err)
+		}
+		r.Max = T(v)
+	}
+	if r.Min > r.Max {
+		return nil, usagef("-%s: empty range %s", name, s)
+	}
+	return r, nil
+}
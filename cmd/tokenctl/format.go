@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// format is a registry file format.
+type format string
+
+const (
+	formatBinary format = "binary"
+	formatJSON   format = "json"
+	formatCSV    format = "csv"
+)
+
+// snapshotMagic starts every binary snapshot; see token.WriteRegistrySnapshot.
+const snapshotMagic = "IWTS"
+
+// csvHeader lists the CSV columns in the order they are written.
+var csvHeader = []string{"id", "address", "name", "symbol", "decimals", "feeOnTransferPPM", "gasForTransfer", "flags"}
+
+// parseFormat parses the value of a -format flag. Empty means unset.
+func parseFormat(s string) (format, error) {
+	switch f := format(strings.ToLower(s)); f {
+	case "", formatBinary, formatJSON, formatCSV:
+		return f, nil
+	default:
+		return "", usagef("unknown format %q: want binary, json or csv", s)
+	}
+}
+
+// formatForPath returns explicit if set, and otherwise the format implied by the
+// extension of path.
+func formatForPath(path string, explicit format) format {
+	if explicit != "" {
+		return explicit
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".csv":
+		return formatCSV
+	default:
+		return formatBinary
+	}
+}
+
+// sniffFormat tells the format of a file from its contents.
+func sniffFormat(data []byte) format {
+	switch trimmed := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(data, []byte(snapshotMagic)):
+		return formatBinary
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		return formatJSON
+	default:
+		return formatCSV
+	}
+}
+
+// readState reads a registry file without validating it, so that validate can report
+// every problem rather than the first. A binary snapshot is validated as it is decoded.
+func readState(path string) (token.RegistryState, format, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return token.RegistryState{}, "", err
+	}
+	f := sniffFormat(data)
+	var state token.RegistryState
+	switch f {
+	case formatBinary:
+		ts, err := token.NewTokenSystemFromSnapshot(bytes.NewReader(data))
+		if err != nil {
+			return state, f, fmt.Errorf("%s: %w", path, err)
+		}
+		state = ts.State()
+	case formatJSON:
+		state, err = decodeJSONState(data)
+	case formatCSV:
+		state.Tokens, err = readCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return state, f, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, f, nil
+}
+
+// loadSystem reads a registry file into a TokenSystem and returns the file's format.
+func loadSystem(path string) (*token.TokenSystem, format, error) {
+	state, f, err := readState(path)
+	if err != nil {
+		return nil, f, err
+	}
+	ts, err := token.NewTokenSystemFromState(state)
+	if err != nil {
+		return nil, f, fmt.Errorf("%s: %w", path, err)
+	}
+	return ts, f, nil
+}
+
+// writeSystem writes ts to path in format f. The file is replaced atomically, so a
+// failure leaves the previous contents in place.
+func writeSystem(path string, f format, ts *token.TokenSystem) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file private; give it the mode of the file it replaces.
+	mode := os.FileMode(0o644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	switch f {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(ts.State())
+	case formatCSV:
+		err = writeCSV(w, ts.State().Tokens)
+	default:
+		err = ts.WriteSnapshot(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkLossy refuses to write state as CSV when that would lose the IDs of deleted tokens
+// or the next ID, letting a registry rebuilt from the file reissue them, unless lossy is
+// set.
+func checkLossy(f format, state token.RegistryState, lossy bool) error {
+	if f != formatCSV || lossy {
+		return nil
+	}
+	var highest uint64
+	for _, v := range state.Tokens {
+		highest = max(highest, v.ID)
+	}
+	if len(state.Tombstones) == 0 && state.NextID <= highest+1 {
+		return nil
+	}
+	return fmt.Errorf("CSV cannot record deleted IDs or the next ID (%d deleted, next ID %d), so they could be reissued; write binary or JSON, or pass -lossy",
+		len(state.Tombstones), state.NextID)
+}
+
+// decodeJSONState accepts both a RegistryState object and a bare array of tokens.
+func decodeJSONState(data []byte) (token.RegistryState, error) {
+	var state token.RegistryState
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(data, &state.Tokens)
+		return state, err
+	}
+	err := json.Unmarshal(data, &state)
+	return state, err
+}
+
+// writeCSV writes tokens with a header row. Flags are written by name, as in
+// "pausable|upgradeable". CSV holds only the tokens: the next ID and the IDs of deleted
+// tokens are lost.
+func writeCSV(w io.Writer, tokens []token.TokenView) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, v := range tokens {
+		err := cw.Write([]string{
+			strconv.FormatUint(v.ID, 10),
+			v.Address.Hex(),
+			v.Name,
+			v.Symbol,
+			strconv.FormatUint(uint64(v.Decimals), 10),
+			strconv.FormatUint(uint64(v.FeeOnTransferPPM), 10),
+			strconv.FormatUint(v.GasForTransfer, 10),
+			v.Flags.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readCSV reads tokens written by writeCSV. Columns are matched by header name and may
+// come in any order; feeOnTransferPPM, gasForTransfer and flags may be left out.
+func readCSV(r io.Reader) ([]token.TokenView, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	column := make(map[string]int, len(header))
+	for i, name := range header {
+		column[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvHeader[:5] {
+		if _, ok := column[name]; !ok {
+			return nil, fmt.Errorf("csv header: missing column %q", name)
+		}
+	}
+
+	tokens := []token.TokenView{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		v, err := parseCSVRecord(record, column)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		tokens = append(tokens, v)
+	}
+}
+
+func parseCSVRecord(record []string, column map[string]int) (token.TokenView, error) {
+	// Names and symbols are kept exactly as written, including surrounding spaces.
+	field := func(name string) string {
+		if i, ok := column[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	number := func(name string, bits int, optional bool) (uint64, error) {
+		raw := strings.TrimSpace(field(name))
+		if raw == "" && optional {
+			return 0, nil
+		}
+		v, err := strconv.ParseUint(raw, 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		return v, nil
+	}
+
+	id, err := number("id", 64, false)
+	if err != nil {
+		return token.TokenView{}, err
+	}
+	address := strings.TrimSpace(field("address"))
+	if !common.IsHexAddress(address) {
+		return token.TokenView{}, fmt.Errorf("address: %q is not an address", address)
+	}
+	decimals, err := number("decimals", 8, false)
+	if err != nil {
+		return token.TokenView{}, err
+	}
+	fee, err := number("feeOnTransferPPM", 32, true)
+	if err != nil {
+		return token.TokenView{}, err
+	}
+	gas, err := number("gasForTransfer", 64, true)
+	if err != nil {
+		return token.TokenView{}, err
+	}
+	flags, err := token.ParseRiskFlags(field("flags"))
+	if err != nil {
+		return token.TokenView{}, fmt.Errorf("flags: %w", err)
+	}
+	return token.TokenView{
+		ID:               id,
+		Address:          common.HexToAddress(address),
+		Name:             field("name"),
+		Symbol:           field("symbol"),
+		Decimals:         uint8(decimals),
+		FeeOnTransferPPM: uint32(fee),
+		GasForTransfer:   gas,
+		Flags:            flags,
+	}, nil
+}
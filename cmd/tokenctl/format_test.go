@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Unit Tests ---
+
+func TestSniffFormat(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, formatBinary, sniffFormat([]byte("IWTS\x04\x00")))
+	assert.Equal(t, formatJSON, sniffFormat([]byte(`  {"tokens": []}`)))
+	assert.Equal(t, formatJSON, sniffFormat([]byte("\n[]")))
+	assert.Equal(t, formatCSV, sniffFormat([]byte("id,address\n")))
+	assert.Equal(t, formatCSV, sniffFormat(nil))
+}
+
+func TestFormatForPath(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, formatJSON, formatForPath("a/b.JSON", ""))
+	assert.Equal(t, formatCSV, formatForPath("b.csv", ""))
+	assert.Equal(t, formatBinary, formatForPath("b.snap", ""))
+	assert.Equal(t, formatCSV, formatForPath("b.json", formatCSV))
+}
+
+func TestCSV_RoundTrip(t *testing.T) {
+	t.Parallel()
+	tokens := []token.TokenView{
+		{ID: 1, Address: addr(1), Name: `Quote "Token", Inc`, Symbol: " PAD ", Decimals: 6, FeeOnTransferPPM: 10, GasForTransfer: 5, Flags: token.FlagPausable | token.FlagHoneypot},
+		{ID: 7, Address: addr(2), Name: "Plain", Symbol: "P", Decimals: 18},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeCSV(&buf, tokens))
+	assert.Contains(t, buf.String(), "pausable|honeypot")
+
+	decoded, err := readCSV(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, tokens, decoded)
+}
+
+func TestReadCSV(t *testing.T) {
+	t.Parallel()
+
+	// Columns in any order, with the optional ones left out.
+	decoded, err := readCSV(strings.NewReader("symbol,decimals,address,id,name\nWETH,18,0x0100000000000000000000000000000000000000,3,Wrapped Ether\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []token.TokenView{{ID: 3, Address: addr(1), Name: "Wrapped Ether", Symbol: "WETH", Decimals: 18}}, decoded)
+
+	for input, message := range map[string]string{
+		"":                  "csv header",
+		"id,address,name\n": `missing column "symbol"`,
+		"id,address,name,symbol,decimals\nx,0x01,a,b,1\n":                                                      "csv line 2: id",
+		"id,address,name,symbol,decimals\n1,0x01,a,b,1\n":                                                      "is not an address",
+		"id,address,name,symbol,decimals,flags\n1,0x0100000000000000000000000000000000000000,a,b,1,mintable\n": token.ErrUnknownFlag.Error(),
+	} {
+		_, err := readCSV(strings.NewReader(input))
+		assert.ErrorContains(t, err, message, "input %q", input)
+	}
+}
+
+func TestReadState_JSONArray(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "views.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id": 4, "address": "0x0100000000000000000000000000000000000000", "name": "A", "symbol": "A", "decimals": 18}]`), 0o644))
+
+	state, f, err := readState(path)
+	require.NoError(t, err)
+	assert.Equal(t, formatJSON, f)
+	require.Len(t, state.Tokens, 1)
+	assert.Equal(t, uint64(4), state.Tokens[0].ID)
+	assert.Zero(t, state.NextID)
+}
+
+func TestWriteSystem_KeepsMode(t *testing.T) {
+	t.Parallel()
+	path := writeFixture(t, t.TempDir(), "tokens.json", formatJSON)
+	require.NoError(t, os.Chmod(path, 0o600))
+	require.NoError(t, writeSystem(path, formatJSON, load(t, path)))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
@@ -0,0 +1,159 @@
+// Command tokenctl inspects and edits token registry files offline. It reads and writes
+// binary snapshots, JSON registry state and CSV, and can list, query, edit, import token
+// lists into, diff, patch, validate and convert them.
+//
+// Usage:
+//
+//	tokenctl <command> [flags] <args>
+//
+// Run "tokenctl help" for the list of commands and "tokenctl <command> -h" for the flags
+// of one.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit statuses. Like diff(1), a command that finds differences or problems exits with
+// exitFound rather than exitError.
+const (
+	exitOK    = 0
+	exitFound = 1
+	exitError = 2
+)
+
+// errFound is returned by diff and validate when they have reported differences or
+// problems, so that run exits with exitFound.
+var errFound = errors.New("differences or problems found")
+
+// command is one tokenctl subcommand.
+type command struct {
+	name    string
+	args    string // Positional arguments, for the usage line
+	summary string
+	// run parses args with fs, which has the command's name and its output set, and runs
+	// the command.
+	run func(fs *flag.FlagSet, args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "list", args: "FILE", summary: "list tokens, optionally filtered and ordered", run: runList},
+	{name: "add", args: "FILE", summary: "add a token", run: runAdd},
+	{name: "delete", args: "FILE", summary: "delete a token by ID or address", run: runDelete},
+	{name: "update", args: "FILE", summary: "update a token's fee, transfer gas or flags", run: runUpdate},
+	{name: "import", args: "FILE TOKENLIST...", summary: "add the tokens of Uniswap token lists", run: runImport},
+	{name: "diff", args: "OLD NEW", summary: "show tokens added, removed and changed between two files", run: runDiff},
+	{name: "patch", args: "FILE CHANGESET", summary: "apply a changeset written by diff -json", run: runPatch},
+	{name: "validate", args: "FILE", summary: "check a file for duplicate IDs or addresses, ID reuse and invalid tokens", run: runValidate},
+	{name: "convert", args: "IN OUT", summary: "convert between the binary, JSON and CSV formats", run: runConvert},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitError
+		}
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet("tokenctl "+cmd.name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(stderr, "usage: tokenctl %s [flags] %s\n\n%s.\n", cmd.name, cmd.args, cmd.summary)
+			if hasFlags(fs) {
+				fmt.Fprintln(stderr, "\nFlags:")
+				fs.PrintDefaults()
+			}
+		}
+		err := cmd.run(fs, args[1:], stdout)
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, flag.ErrHelp):
+			return exitOK
+		case errors.Is(err, errFound):
+			return exitFound
+		case errors.Is(err, errFlags):
+			return exitError
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(stderr, "tokenctl %s: %v\n", cmd.name, err)
+			fs.Usage()
+			return exitError
+		default:
+			fmt.Fprintf(stderr, "tokenctl %s: %v\n", cmd.name, err)
+			return exitError
+		}
+	}
+	fmt.Fprintf(stderr, "tokenctl: unknown command %q\n", args[0])
+	printUsage(stderr)
+	return exitError
+}
+
+var (
+	// errUsage is wrapped by errors in the command line itself.
+	errUsage = errors.New("usage")
+	// errFlags is returned for flags the flag package has already reported.
+	errFlags = errors.New("invalid flags")
+)
+
+// usagef returns an error wrapping errUsage.
+func usagef(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, args...))
+}
+
+// parseArgs parses flags and requires exactly n positional arguments, or at least n if
+// variadic.
+func parseArgs(fs *flag.FlagSet, args []string, n int, variadic bool) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errFlags
+	}
+	rest := fs.Args()
+	if len(rest) < n || (!variadic && len(rest) > n) {
+		return nil, usagef("wrong number of arguments")
+	}
+	return rest, nil
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `tokenctl inspects and edits token registry files offline.
+
+Usage:
+
+	tokenctl <command> [flags] <args>
+
+Commands:
+
+`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(w, `
+Files are read as binary snapshots, JSON registry state or CSV, whichever they contain.
+Written files take their format from -format or else from their extension: .json, .csv,
+or anything else for a binary snapshot.
+
+Run "tokenctl <command> -h" for the flags of a command.
+`)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+func addr(b byte) common.Address {
+	var a common.Address
+	a[0] = b
+	return a
+}
+
+// tokenctl runs the command line and returns its exit status, stdout and stderr.
+func tokenctl(t *testing.T, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// writeFixture writes a registry with WETH (ID 1), USDC (ID 2) and TAX (ID 4), with ID 3
+// deleted, to dir in format f and returns its path.
+func writeFixture(t *testing.T, dir, name string, f format) string {
+	ts := token.NewTokenSystem()
+	for i, symbol := range []string{"WETH", "USDC", "GONE", "TAX"} {
+		_, err := ts.AddToken(addr(byte(i+1)), symbol+" Token", symbol, 18)
+		require.NoError(t, err)
+	}
+	require.NoError(t, ts.DeleteToken(3))
+	require.NoError(t, ts.UpdateTokenPPM(4, 30_000, 90_000))
+	require.NoError(t, ts.SetFlags(2, token.FlagUpgradeable|token.FlagBlacklistable))
+	path := filepath.Join(dir, name)
+	require.NoError(t, writeSystem(path, f, ts))
+	return path
+}
+
+func load(t *testing.T, path string) *token.TokenSystem {
+	ts, _, err := loadSystem(path)
+	require.NoError(t, err)
+	return ts
+}
+
+// --- Unit Tests ---
+
+func TestRun_Usage(t *testing.T) {
+	t.Parallel()
+
+	status, _, stderr := tokenctl(t)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "Commands:")
+
+	status, _, stderr = tokenctl(t, "help")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stderr, "convert")
+
+	status, _, stderr = tokenctl(t, "frobnicate")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, `unknown command "frobnicate"`)
+
+	status, _, stderr = tokenctl(t, "list")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "wrong number of arguments")
+	assert.Contains(t, stderr, "usage: tokenctl list")
+
+	status, _, stderr = tokenctl(t, "list", "-bogus", "file")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "flag provided but not defined")
+
+	status, _, _ = tokenctl(t, "list", "-h")
+	assert.Equal(t, exitOK, status)
+}
+
+func TestRun_List(t *testing.T) {
+	t.Parallel()
+	path := writeFixture(t, t.TempDir(), "tokens.snap", formatBinary)
+
+	status, stdout, _ := tokenctl(t, "list", path)
+	require.Equal(t, exitOK, status)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 4)
+	assert.Regexp(t, `^ID\s+ADDRESS\s+SYMBOL`, lines[0])
+	assert.Regexp(t, `^2\s+0x0200000000000000000000000000000000000000\s+USDC\s+USDC Token\s+18\s+0\s+0\s+blacklistable\|upgradeable$`, lines[2])
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []uint64
+	}{
+		{name: "Order", args: []string{"-order", "symbol", "-desc"}, expected: []uint64{1, 2, 4}},
+		{name: "Symbol", args: []string{"-symbol", "usd", "-match", "prefix"}, expected: []uint64{2}},
+		{name: "Fee range", args: []string{"-fee", "1-"}, expected: []uint64{4}},
+		{name: "Gas range", args: []string{"-gas", "-50000"}, expected: []uint64{1, 2}},
+		{name: "Decimals", args: []string{"-decimals", "18"}, expected: []uint64{1, 2, 4}},
+		{name: "Flags", args: []string{"-exclude", "upgradeable"}, expected: []uint64{1, 4}},
+		{name: "Limit", args: []string{"-limit", "2", "-order", "address", "-desc"}, expected: []uint64{4, 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append(append([]string{"list", "-output", "json"}, tc.args...), path)
+			status, stdout, stderr := tokenctl(t, args...)
+			require.Equal(t, exitOK, status, stderr)
+			var views []token.TokenView
+			require.NoError(t, json.Unmarshal([]byte(stdout), &views))
+			ids := make([]uint64, len(views))
+			for i, v := range views {
+				ids[i] = v.ID
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+
+	for _, args := range [][]string{
+		{"-match", "regex"}, {"-order", "name"}, {"-fee", "9-1"}, {"-decimals", "300"},
+		{"-require", "mintable"}, {"-output", "xml"},
+	} {
+		status, _, _ := tokenctl(t, append(append([]string{"list"}, args...), path)...)
+		assert.Equal(t, exitError, status, "%v", args)
+	}
+}
+
+func TestRun_Edit(t *testing.T) {
+	t.Parallel()
+	path := writeFixture(t, t.TempDir(), "tokens.json", formatJSON)
+
+	status, stdout, stderr := tokenctl(t, "add", "-address", addr(9).Hex(), "-name", "Dai", "-symbol", "DAI",
+		"-fee", "100", "-flags", "pausable", path)
+	require.Equal(t, exitOK, status, stderr)
+	assert.Equal(t, "5\n", stdout, "IDs of deleted tokens are not reissued")
+	view, err := load(t, path).GetTokenByID(5)
+	require.NoError(t, err)
+	assert.Equal(t, token.TokenView{
+		ID: 5, Address: addr(9), Name: "Dai", Symbol: "DAI", Decimals: 18,
+		FeeOnTransferPPM: 100, Flags: token.FlagPausable,
+	}, view)
+
+	status, _, stderr = tokenctl(t, "add", "-address", addr(9).Hex(), "-symbol", "DAI", path)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, token.ErrAlreadyExists.Error())
+
+	status, _, stderr = tokenctl(t, "update", "-address", addr(2).Hex(), "-gas", "60000", "-flags", "upgradeable", path)
+	require.Equal(t, exitOK, status, stderr)
+	view, err = load(t, path).GetTokenByID(2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(60_000), view.GasForTransfer)
+	assert.Equal(t, token.FlagUpgradeable, view.Flags)
+
+	status, _, stderr = tokenctl(t, "update", "-id", "2", path)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "nothing to update")
+
+	// Writing elsewhere leaves the input unchanged.
+	out := filepath.Join(filepath.Dir(path), "out.csv")
+	status, _, stderr = tokenctl(t, "delete", "-id", "1", "-o", out, path)
+	assert.Equal(t, exitError, status, "CSV would drop the deleted IDs")
+	assert.Contains(t, stderr, "-lossy")
+	assert.NoFileExists(t, out)
+	status, _, stderr = tokenctl(t, "delete", "-id", "1", "-o", out, "-lossy", path)
+	require.Equal(t, exitOK, status, stderr)
+	assert.Len(t, load(t, path).View(), 4)
+	assert.Len(t, load(t, out).View(), 3)
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "id,address,"), "-o takes the format from the extension")
+
+	status, _, _ = tokenctl(t, "delete", "-id", "1", "-address", addr(1).Hex(), path)
+	assert.Equal(t, exitError, status)
+	status, _, stderr = tokenctl(t, "delete", "-id", "77", path)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, token.ErrTokenNotFound.Error())
+}
+
+func TestRun_Import(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := writeFixture(t, dir, "tokens.snap", formatBinary)
+	list := `{
+  "name": "Test List",
+  "timestamp": "2024-01-01T00:00:00Z",
+  "version": {"major": 1, "minor": 0, "patch": 0},
+  "tokens": [
+    {"chainId": 1, "address": "0x0100000000000000000000000000000000000000", "name": "Wrapped Ether", "symbol": "WETH", "decimals": 18},
+    {"chainId": 1, "address": "0x0a00000000000000000000000000000000000000", "name": "Chainlink", "symbol": "LINK", "decimals": 18},
+    {"chainId": 10, "address": "0x0b00000000000000000000000000000000000000", "name": "Optimism", "symbol": "OP", "decimals": 18}
+  ]
+}`
+	listPath := filepath.Join(dir, "list.json")
+	require.NoError(t, os.WriteFile(listPath, []byte(list), 0o644))
+
+	status, stdout, stderr := tokenctl(t, "import", "-chain", "1", path, listPath)
+	require.Equal(t, exitOK, status, stderr)
+	assert.Contains(t, stdout, "added 1 tokens")
+	assert.Contains(t, stdout, "skipped 0x0100000000000000000000000000000000000000: "+token.ErrAlreadyExists.Error())
+	_, err := load(t, path).GetTokenByAddress(common.HexToAddress("0x0a00000000000000000000000000000000000000"))
+	assert.NoError(t, err)
+
+	status, _, _ = tokenctl(t, "import", path, listPath)
+	assert.Equal(t, exitError, status, "-chain is required")
+}
+
+func TestRun_Diff(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	before := writeFixture(t, dir, "before.snap", formatBinary)
+	after := writeFixture(t, dir, "after.json", formatJSON)
+
+	status, stdout, _ := tokenctl(t, "diff", before, after)
+	assert.Equal(t, exitOK, status, "the same registry in two formats")
+	assert.Empty(t, stdout)
+
+	for _, args := range [][]string{
+		{"delete", "-id", "1", after},
+		{"update", "-id", "4", "-fee", "0", "-flags", "honeypot", after},
+		{"add", "-address", addr(7).Hex(), "-symbol", "NEW", after},
+	} {
+		status, _, stderr := tokenctl(t, args...)
+		require.Equal(t, exitOK, status, stderr)
+	}
+
+	status, stdout, _ = tokenctl(t, "diff", before, after)
+	assert.Equal(t, exitFound, status)
+	assert.Equal(t, strings.Join([]string{
+		"- 1 0x0100000000000000000000000000000000000000 WETH",
+		"~ 4 0x0400000000000000000000000000000000000000 TAX: feeOnTransferPPM 30000 -> 0, flags none -> honeypot",
+		"+ 5 0x0700000000000000000000000000000000000000 NEW",
+	}, "\n")+"\n", stdout)
+
+	// The same address under another ID cannot be expressed as a changeset.
+	moved := filepath.Join(dir, "moved.json")
+	state := load(t, before).State()
+	state.Tokens[0].ID, state.NextID = 9, 10
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(moved, data, 0o644))
+	status, _, stderr := tokenctl(t, "diff", before, moved)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, token.ErrChangesetConflict.Error())
+}
+
+func TestRun_Patch(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	production := writeFixture(t, dir, "production.snap", formatBinary)
+	staging := writeFixture(t, dir, "staging.json", formatJSON)
+	for _, args := range [][]string{
+		{"delete", "-id", "2", staging},
+		{"update", "-id", "1", "-gas", "50000", staging},
+		{"add", "-address", addr(7).Hex(), "-symbol", "NEW", staging},
+	} {
+		status, _, stderr := tokenctl(t, args...)
+		require.Equal(t, exitOK, status, stderr)
+	}
+
+	status, stdout, _ := tokenctl(t, "diff", "-json", production, staging)
+	require.Equal(t, exitFound, status)
+	changes := filepath.Join(dir, "changes.json")
+	require.NoError(t, os.WriteFile(changes, []byte(stdout), 0o644))
+
+	status, _, stderr := tokenctl(t, "patch", production, changes)
+	require.Equal(t, exitOK, status, stderr)
+	assert.Equal(t, load(t, staging).State(), load(t, production).State())
+
+	// The changeset no longer fits the patched file.
+	status, _, stderr = tokenctl(t, "patch", production, changes)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, token.ErrChangesetConflict.Error())
+
+	status, stdout, _ = tokenctl(t, "diff", "-json", production, staging)
+	assert.Equal(t, exitOK, status)
+	assert.JSONEq(t, `{}`, stdout)
+}
+
+func TestRun_Validate(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := writeFixture(t, dir, "tokens.snap", formatBinary)
+
+	status, stdout, _ := tokenctl(t, "validate", path)
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, path+": 3 tokens, ok\n", stdout)
+
+	bad := token.RegistryState{
+		Tokens: []token.TokenView{
+			{ID: 1, Address: addr(1), Name: "A", Symbol: "A"},
+			{ID: 1, Address: addr(2), Name: "B", Symbol: "B"},
+			{ID: 3, Address: addr(1), Name: "C", Symbol: ""},
+		},
+		NextID:     3,
+		Tombstones: []uint64{3},
+	}
+	data, err := json.Marshal(bad)
+	require.NoError(t, err)
+	badPath := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(badPath, data, 0o644))
+
+	status, stdout, _ = tokenctl(t, "validate", badPath)
+	assert.Equal(t, exitFound, status)
+	for _, problem := range []string{
+		token.ErrDuplicateID.Error() + ": 1",
+		token.ErrDuplicateAddress.Error() + ": 0x0100000000000000000000000000000000000000 is used by tokens 1 and 3",
+		"token 3: symbol: empty",
+		token.ErrIDReused.Error() + ": 3",
+		token.ErrInvalidNextID.Error() + ": nextID 3, highest ID 3",
+	} {
+		assert.Contains(t, stdout, badPath+": "+problem+"\n")
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.snap")
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	raw[len(raw)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(corrupt, raw, 0o644))
+	status, stdout, _ = tokenctl(t, "validate", corrupt)
+	assert.Equal(t, exitFound, status)
+	assert.Contains(t, stdout, token.ErrSnapshotChecksum.Error())
+}
+
+func TestRun_Convert(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := writeFixture(t, dir, "tokens.snap", formatBinary)
+	expected := load(t, path).State()
+
+	// JSON and binary keep the deleted IDs; CSV keeps only the tokens, and so is only
+	// written when asked for.
+	jsonPath := filepath.Join(dir, "tokens.json")
+	csvPath := filepath.Join(dir, "tokens.csv")
+	binPath := filepath.Join(dir, "copy")
+	status, _, stderr := tokenctl(t, "convert", path, csvPath)
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "1 deleted, next ID 5")
+	for _, args := range [][]string{
+		{"convert", path, jsonPath},
+		{"convert", "-lossy", jsonPath, csvPath},
+		{"convert", "-format", "binary", jsonPath, binPath},
+	} {
+		status, _, stderr := tokenctl(t, args...)
+		require.Equal(t, exitOK, status, stderr)
+	}
+	assert.Equal(t, expected, load(t, jsonPath).State())
+	assert.Equal(t, expected, load(t, binPath).State())
+	assert.Equal(t, expected.Tokens, load(t, csvPath).View())
+
+	status, _, _ = tokenctl(t, "convert", "-format", "yaml", path, jsonPath)
+	assert.Equal(t, exitError, status)
+
+	// Nothing is lost from a registry without deletions.
+	fresh := filepath.Join(dir, "fresh.csv")
+	status, _, stderr = tokenctl(t, "convert", csvPath, fresh)
+	assert.Equal(t, exitOK, status, stderr)
+}
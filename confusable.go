@@ -0,0 +1,193 @@
+package token
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrImpersonation is returned when the canonical guard refuses a token whose symbol or
+// name resembles that of a canonical token.
+var ErrImpersonation = errors.New("token impersonates a canonical token")
+
+// confusables maps characters that render like a Latin letter or digit to the lower-case
+// ASCII letter they imitate. It is a subset of the Unicode confusables data (UTS #39)
+// covering the Cyrillic, Greek, Armenian and Cherokee homoglyphs seen in scam tokens.
+// Digits map to the letter they imitate, so "USD0" and "USDO" share a skeleton. "I", "i",
+// "l" and "1" all map to "l", which keeps skeletons case-insensitive.
+var confusables = map[rune]rune{
+	// Latin and ASCII
+	'0': 'o', '1': 'l', 'I': 'l', 'i': 'l', '|': 'l', 'ı': 'l', 'ȷ': 'j', 'ǀ': 'l', 'ℓ': 'l', 'ɑ': 'a', 'ɡ': 'g',
+	// Cyrillic
+	'А': 'a', 'В': 'b', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o', 'Р': 'p', 'С': 'c',
+	'Т': 't', 'У': 'y', 'Х': 'x', 'Ѕ': 's', 'І': 'l', 'Ј': 'j', 'Ԛ': 'q', 'Ԝ': 'w', 'Ү': 'y',
+	'Ӏ': 'l', 'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'і': 'l', 'ј': 'j', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'ӏ': 'l', 'һ': 'h', 'ԁ': 'd',
+	// Greek
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Ι': 'l', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n',
+	'Ο': 'o', 'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x', 'Ϲ': 'c', 'α': 'a', 'γ': 'y', 'ι': 'l',
+	'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u', 'ϲ': 'c', 'ϳ': 'j',
+	// Armenian
+	'հ': 'h', 'ո': 'n', 'ս': 'u', 'ց': 'g', 'օ': 'o', 'զ': 'q',
+	// Cherokee
+	'Ꭺ': 'a', 'Ᏼ': 'b', 'Ꮯ': 'c', 'Ꭼ': 'e', 'Ꮐ': 'g', 'Ꮋ': 'h', 'Ꭵ': 'l', 'Ꭻ': 'j', 'Ꮶ': 'k',
+	'Ꮮ': 'l', 'Ꮇ': 'm', 'Ꮲ': 'p', 'Ꮪ': 's', 'Ꭲ': 't', 'Ꮩ': 'v', 'Ꮃ': 'w', 'Ꮓ': 'z',
+}
+
+// Skeleton returns the form of s used to detect look-alike symbols and names: two strings
+// with the same skeleton are likely to be mistaken for one another. It ignores case,
+// whitespace, combining marks and invisible formatting characters, folds fullwidth and
+// mathematical letters and digits to ASCII, and replaces known homoglyphs with the
+// character they imitate. "USDC", "usdc", "USDС" (Cyrillic С) and "ＵＳＤＣ" all have the
+// skeleton "usdc".
+func Skeleton(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+			continue
+		case r >= 0xFF01 && r <= 0xFF5E: // Fullwidth ASCII
+			r -= 0xFEE0
+		case r >= 0x1D400 && r <= 0x1D6A3: // Mathematical letters, in styles of A-Z then a-z
+			if letter := (r - 0x1D400) % 52; letter < 26 {
+				r = 'A' + letter
+			} else {
+				r = 'a' + letter - 26
+			}
+		case r >= 0x1D7CE && r <= 0x1D7FF: // Mathematical digits, in styles of 0-9
+			r = '0' + (r-0x1D7CE)%10
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		} else if c, ok := confusables[unicode.ToLower(r)]; ok {
+			r = c
+		} else {
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// skeletonKeys returns the distinct non-empty skeletons of a token's name and symbol.
+func skeletonKeys(name, symbol string) []string {
+	keys := make([]string, 0, 2)
+	if key := Skeleton(symbol); key != "" {
+		keys = append(keys, key)
+	}
+	if key := Skeleton(name); key != "" && !slices.Contains(keys, key) {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// indexSkeletons adds id to the skeleton index under its name and symbol skeletons.
+func indexSkeletons(id uint64, name, symbol string, registry *TokenRegistry) {
+	for _, key := range skeletonKeys(name, symbol) {
+		addToIndex(registry.skeletonToIDs, key, id)
+	}
+}
+
+// unindexSkeletons removes id from the skeleton index.
+func unindexSkeletons(id uint64, name, symbol string, registry *TokenRegistry) {
+	for _, key := range skeletonKeys(name, symbol) {
+		removeFromIndex(registry.skeletonToIDs, key, id)
+	}
+}
+
+// findImpersonators returns every other token whose symbol or name skeleton matches the
+// symbol or name skeleton of the token with the given ID, ordered by ID.
+func findImpersonators(id uint64, registry *TokenRegistry) ([]TokenView, error) {
+	index, ok := registry.idToIndex[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	var matches []uint64
+	for _, key := range skeletonKeys(registry.name[index], registry.symbol[index]) {
+		for _, other := range registry.skeletonToIDs[key] {
+			if other != id && !slices.Contains(matches, other) {
+				matches = append(matches, other)
+			}
+		}
+	}
+	slices.SortFunc(matches, cmp.Compare[uint64])
+
+	views := make([]TokenView, len(matches))
+	for i, other := range matches {
+		views[i], _ = getTokenByID(other, registry)
+	}
+	return views, nil
+}
+
+// WithCanonicalGuard makes adds, and renames made by Apply, fail with ErrImpersonation
+// when the token's new symbol or name has the same Skeleton as the symbol or name of a
+// canonical token at a different address. Mark tokens canonical with SetCanonical.
+func WithCanonicalGuard() Option {
+	return func(ts *TokenSystem) {
+		ts.canonicalGuard = true
+	}
+}
+
+// SetCanonical marks the token at addr as canonical, the trusted original of its symbol
+// and name, or clears the mark. The address need not be registered yet. Marks are
+// configuration: they are not part of snapshots or the write-ahead log.
+// It acquires a full write lock.
+func (ts *TokenSystem) SetCanonical(addr common.Address, canonical bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if !canonical {
+		delete(ts.canonical, addr)
+		return
+	}
+	if ts.canonical == nil {
+		ts.canonical = make(map[common.Address]struct{})
+	}
+	ts.canonical[addr] = struct{}{}
+}
+
+// IsCanonical reports whether the token at addr is marked canonical.
+// It acquires a read lock, allowing multiple concurrent readers.
+func (ts *TokenSystem) IsCanonical(addr common.Address) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	_, ok := ts.canonical[addr]
+	return ok
+}
+
+// FindImpersonators returns the other tokens whose symbol or name looks like the symbol
+// or name of the given token, ordered by ID. Called with a trusted token, it lists the
+// tokens that could be mistaken for it. See Skeleton.
+func (ts *TokenSystem) FindImpersonators(id uint64) ([]TokenView, error) {
+	if registry := ts.published.Load(); registry != nil {
+		return findImpersonators(id, registry)
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return findImpersonators(id, ts.registry)
+}
+
+// guardCanonical refuses an add that resembles a canonical token, when the guard is
+// enabled. Canonical tokens themselves are always accepted.
+func (ts *TokenSystem) guardCanonical(m mutation, registry *TokenRegistry) error {
+	if !ts.canonicalGuard || len(ts.canonical) == 0 {
+		return nil
+	}
+	if _, ok := ts.canonical[m.address]; ok {
+		return nil
+	}
+	for _, key := range skeletonKeys(m.name, m.symbol) {
+		for _, id := range registry.skeletonToIDs[key] {
+			index := registry.idToIndex[id]
+			if _, ok := ts.canonical[registry.address[index]]; ok {
+				return fmt.Errorf("%w: skeleton %q matches token %d (%s)", ErrImpersonation, key, id, registry.address[index].Hex())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// newImpersonationTestSystem registers a genuine USDC followed by look-alikes and an
+// unrelated token.
+func newImpersonationTestSystem(t *testing.T, opts ...Option) *TokenSystem {
+	ts := NewTokenSystem(opts...)
+	for i, tok := range []struct{ name, symbol string }{
+		{"USD Coin", "USDC"},
+		{"USD Coin", "USDС"},      // Cyrillic Es
+		{"Circle Dollar", "ＵＳＤＣ"}, // Fullwidth
+		{"USD Coin", "USDC2"},
+		{"Tether USD", "USDT"},
+	} {
+		_, err := ts.AddToken(addr(byte(i+1)), tok.name, tok.symbol, 6)
+		require.NoError(t, err)
+	}
+	return ts
+}
+
+// requireSkeletonIndexConsistent checks the skeleton index against a fresh rebuild.
+func requireSkeletonIndexConsistent(t *testing.T, registry *TokenRegistry) {
+	rebuilt, err := NewTokenRegistryFromViews(viewRegistry(registry))
+	require.NoError(t, err)
+	require.Equal(t, len(rebuilt.skeletonToIDs), len(registry.skeletonToIDs))
+	for key, expected := range rebuilt.skeletonToIDs {
+		require.ElementsMatch(t, expected, registry.skeletonToIDs[key], "skeleton key %q", key)
+	}
+}
+
+// --- Unit Tests ---
+
+func TestSkeleton(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"USDC", "usdc"},
+		{"usdc", "usdc"},
+		{"USDС", "usdc"},        // Cyrillic Es
+		{"UЅDС", "usdc"},        // Cyrillic Dze and Es
+		{"ＵＳＤＣ", "usdc"},        // Fullwidth
+		{"𝐔𝐒𝐃𝐂", "usdc"},        // Mathematical bold
+		{"U\u200bSDC", "usdc"},  // Zero-width space
+		{"USDC\u0301", "usdc"},  // Combining acute accent
+		{"ԜΕΤΗ", "weth"},        // Cyrillic We, Greek Epsilon, Tau and Eta
+		{"USD Coin", "usdcoln"}, // Whitespace is ignored
+		{"USD0", "usdo"},        // Zero imitates O
+		{"USDI", "usdl"},        // I, i, l and 1 look alike
+		{"usdi", "usdl"},
+		{"USD1", "usdl"},
+		{"𝟙INCH", "llnch"}, // Mathematical digit
+		{"USDT", "usdt"},   // Different letters stay different
+		{"ÜSDC", "üsdc"},   // Precomposed letters are kept
+		{"", ""},
+		{"\u200b \u2060\ufeff", ""}, // Only invisible characters
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, Skeleton(tc.input), "Skeleton(%q)", tc.input)
+	}
+}
+
+func TestTokenSystem_FindImpersonators(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Locked"},
+		{name: "LockFree", opts: []Option{WithLockFreeReads()}},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			ts := newImpersonationTestSystem(t, mode.opts...)
+			requireSkeletonIndexConsistent(t, ts.registry)
+
+			impersonators, err := ts.FindImpersonators(1)
+			require.NoError(t, err)
+			assert.Equal(t, []uint64{2, 3, 4}, ids(impersonators), "symbol and name collisions are both found")
+
+			impersonators, err = ts.FindImpersonators(3)
+			require.NoError(t, err)
+			assert.Equal(t, []uint64{1, 2}, ids(impersonators), "only symbols collide")
+
+			impersonators, err = ts.FindImpersonators(5)
+			require.NoError(t, err)
+			assert.Empty(t, impersonators)
+
+			_, err = ts.FindImpersonators(99)
+			assert.ErrorIs(t, err, ErrTokenNotFound)
+
+			// Swap-and-pop moves the last token, and deleted tokens leave the index.
+			require.NoError(t, ts.DeleteToken(2))
+			requireSkeletonIndexConsistent(t, ts.registry)
+			impersonators, err = ts.FindImpersonators(1)
+			require.NoError(t, err)
+			assert.Equal(t, []uint64{3, 4}, ids(impersonators))
+
+			for _, id := range []uint64{1, 3, 4, 5} {
+				require.NoError(t, ts.DeleteToken(id))
+			}
+			assert.Empty(t, ts.registry.skeletonToIDs, "empty entries are removed")
+		})
+	}
+}
+
+func TestTokenSystem_CanonicalGuard(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Refuses look-alikes", func(t *testing.T) {
+		ts := NewTokenSystem(WithCanonicalGuard())
+		ts.SetCanonical(addr(1), true)
+		assert.True(t, ts.IsCanonical(addr(1)))
+		assert.False(t, ts.IsCanonical(addr(2)))
+
+		_, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+		require.NoError(t, err)
+
+		_, err = ts.AddToken(addr(2), "Totally Legit", "USDС", 6)
+		assert.ErrorIs(t, err, ErrImpersonation)
+		_, err = ts.AddToken(addr(3), "USD  Coin", "UC", 6)
+		assert.ErrorIs(t, err, ErrImpersonation, "names are guarded too")
+		_, err = ts.AddToken(addr(4), "Tether USD", "USDT", 6)
+		assert.NoError(t, err)
+
+		err = ts.Update(func(tx *Tx) error {
+			_, err := tx.AddToken(addr(5), "USD Coin", "ＵＳＤＣ", 6)
+			return err
+		})
+		assert.ErrorIs(t, err, ErrImpersonation)
+
+		result := ts.AddTokens([]TokenMetadata{
+			{Address: addr(6), Name: "Dai", Symbol: "DAI", Decimals: 18},
+			{Address: addr(7), Name: "Fake", Symbol: "usdc", Decimals: 6},
+		})
+		assert.Contains(t, result.Added, addr(6))
+		assert.ErrorIs(t, result.Failed[addr(7)], ErrImpersonation)
+	})
+
+	t.Run("Canonical tokens are always accepted", func(t *testing.T) {
+		ts := NewTokenSystem(WithCanonicalGuard())
+		ts.SetCanonical(addr(1), true)
+		ts.SetCanonical(addr(2), true)
+		_, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+		require.NoError(t, err)
+		_, err = ts.AddToken(addr(2), "USD Coin", "USDC", 6)
+		assert.NoError(t, err, "a second canonical token may share the symbol")
+	})
+
+	t.Run("Unmarked tokens are not protected", func(t *testing.T) {
+		ts := NewTokenSystem(WithCanonicalGuard())
+		ts.SetCanonical(addr(1), true)
+		_, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+		require.NoError(t, err)
+		ts.SetCanonical(addr(1), false)
+		assert.False(t, ts.IsCanonical(addr(1)))
+		_, err = ts.AddToken(addr(2), "USD Coin", "USDС", 6)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Guard is off by default", func(t *testing.T) {
+		ts := NewTokenSystem()
+		ts.SetCanonical(addr(1), true)
+		_, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+		require.NoError(t, err)
+		_, err = ts.AddToken(addr(2), "USD Coin", "USDС", 6)
+		assert.NoError(t, err)
+	})
+}
+
+// --- Benchmarking ---
+
+func BenchmarkSkeleton(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = Skeleton("Ｗrapped Еther")
+	}
+}
@@ -0,0 +1,286 @@
+package token
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrChangesetConflict is returned by Diff when two token sets disagree about which ID
+	// an address has, and by Apply when the registry no longer matches the changeset.
+	ErrChangesetConflict = errors.New("changeset conflict")
+	// ErrInvalidTokenID is returned by Apply for an added token whose ID the registry could
+	// never have assigned: zero, or the largest uint64, after which no next ID exists.
+	ErrInvalidTokenID = errors.New("invalid token ID")
+)
+
+// Changeset is the difference between two token sets, keyed by token ID. Each list is
+// ordered by ID.
+type Changeset struct {
+	Added   []TokenView   `json:"added,omitempty"`
+	Removed []TokenView   `json:"removed,omitempty"`
+	Changed []TokenChange `json:"changed,omitempty"`
+}
+
+// TokenChange is a token present in both sets with different contents. Fields names the
+// fields that differ, using the TokenView JSON names, in TokenView order.
+type TokenChange struct {
+	ID     uint64    `json:"id"`
+	Before TokenView `json:"before"`
+	After  TokenView `json:"after"`
+	Fields []string  `json:"fields"`
+}
+
+// IsEmpty reports whether the changeset changes nothing.
+func (c Changeset) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Diff returns the changes that turn the tokens in from into the tokens in to. Tokens are
+// matched by ID, since IDs are permanent: a token whose ID is only in to is added, and one
+// whose ID is only in from is removed.
+//
+// A set that uses an ID or an address twice fails with ErrDuplicateID or
+// ErrDuplicateAddress. An address is a token's identity, so an ID whose address differs
+// between the sets, or an address under different IDs, fails with ErrChangesetConflict:
+// such sets come from registries that have diverged, which no changeset can reconcile.
+func Diff(from, to []TokenView) (Changeset, error) {
+	fromByID, err := indexViews(from)
+	if err != nil {
+		return Changeset{}, fmt.Errorf("from: %w", err)
+	}
+	toByID, err := indexViews(to)
+	if err != nil {
+		return Changeset{}, fmt.Errorf("to: %w", err)
+	}
+	fromIDs := make(map[common.Address]uint64, len(from))
+	for _, v := range from {
+		fromIDs[v.Address] = v.ID
+	}
+
+	var c Changeset
+	for _, after := range to {
+		if id, ok := fromIDs[after.Address]; ok && id != after.ID {
+			return Changeset{}, fmt.Errorf("%w: address %s is token %d in from and token %d in to",
+				ErrChangesetConflict, after.Address.Hex(), id, after.ID)
+		}
+		before, ok := fromByID[after.ID]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, after)
+		case before.Address != after.Address:
+			return Changeset{}, fmt.Errorf("%w: token %d is %s in from and %s in to",
+				ErrChangesetConflict, after.ID, before.Address.Hex(), after.Address.Hex())
+		default:
+			if fields := changedFields(before, after); len(fields) > 0 {
+				c.Changed = append(c.Changed, TokenChange{ID: after.ID, Before: before, After: after, Fields: fields})
+			}
+		}
+	}
+	for _, before := range from {
+		if _, ok := toByID[before.ID]; !ok {
+			c.Removed = append(c.Removed, before)
+		}
+	}
+
+	byID := func(a, b TokenView) int { return cmp.Compare(a.ID, b.ID) }
+	slices.SortFunc(c.Added, byID)
+	slices.SortFunc(c.Removed, byID)
+	slices.SortFunc(c.Changed, func(a, b TokenChange) int { return cmp.Compare(a.ID, b.ID) })
+	return c, nil
+}
+
+// DiffSystems returns the changes that turn the tokens of from into those of to. Each
+// system is read under its own read lock, so neither is blocked for the whole comparison.
+func DiffSystems(from, to *TokenSystem) (Changeset, error) {
+	return Diff(from.View(), to.View())
+}
+
+// indexViews maps views by ID, rejecting duplicate IDs and addresses.
+func indexViews(views []TokenView) (map[uint64]TokenView, error) {
+	byID := make(map[uint64]TokenView, len(views))
+	addresses := make(map[common.Address]struct{}, len(views))
+	for _, v := range views {
+		if _, ok := byID[v.ID]; ok {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateID, v.ID)
+		}
+		if _, ok := addresses[v.Address]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateAddress, v.Address.Hex())
+		}
+		byID[v.ID] = v
+		addresses[v.Address] = struct{}{}
+	}
+	return byID, nil
+}
+
+// changedFields names the fields other than ID and address that differ between two
+// versions of a token.
+func changedFields(before, after TokenView) []string {
+	var fields []string
+	if before.Name != after.Name {
+		fields = append(fields, "name")
+	}
+	if before.Symbol != after.Symbol {
+		fields = append(fields, "symbol")
+	}
+	if before.Decimals != after.Decimals {
+		fields = append(fields, "decimals")
+	}
+	if before.FeeOnTransferPPM != after.FeeOnTransferPPM {
+		fields = append(fields, "feeOnTransferPPM")
+	}
+	if before.GasForTransfer != after.GasForTransfer {
+		fields = append(fields, "gasForTransfer")
+	}
+	if before.Flags != after.Flags {
+		fields = append(fields, "flags")
+	}
+	return fields
+}
+
+// Apply applies a changeset as a single transaction: either every change is made or, on
+// error, none is. Added tokens keep their IDs, so applying the Diff of two registries makes
+// the receiving one hand out the same IDs as the other.
+//
+// A changeset is checked against the registry as it is now, and Apply fails with
+// ErrChangesetConflict if it no longer fits: a removed or changed token is missing or has
+// another address, a changed field no longer holds its Before value, or an added token's ID
+// or address is already in use. Fields a change does not name are left as they are, so
+// unrelated edits made since the Diff survive. An added token may not reuse the ID of a
+// deleted one (ErrIDReused) or have an ID the registry could not assign
+// (ErrInvalidTokenID), and every change passes the same validation, denylist and
+// impersonation checks as the equivalent single operation.
+func (ts *TokenSystem) Apply(c Changeset) error {
+	return ts.Update(func(tx *Tx) error {
+		return tx.Apply(c)
+	})
+}
+
+// Apply applies a changeset within the transaction; see TokenSystem.Apply. Removals are
+// applied first, so a changeset may remove a token and add another at its address.
+func (tx *Tx) Apply(c Changeset) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	for _, before := range c.Removed {
+		if _, err := tx.current(before.ID, before.Address); err != nil {
+			return err
+		}
+		if err := tx.DeleteToken(before.ID); err != nil {
+			return fmt.Errorf("token %d: %w", before.ID, err)
+		}
+	}
+	for _, change := range c.Changed {
+		if err := tx.applyChange(change); err != nil {
+			return fmt.Errorf("token %d: %w", change.ID, err)
+		}
+	}
+	for _, v := range c.Added {
+		if err := tx.applyAdd(v); err != nil {
+			return fmt.Errorf("token %d: %w", v.ID, err)
+		}
+	}
+	return nil
+}
+
+// current returns the token with the given ID, which must have the given address.
+func (tx *Tx) current(id uint64, addr common.Address) (TokenView, error) {
+	current, err := getTokenByID(id, tx.registry)
+	if err != nil {
+		return TokenView{}, fmt.Errorf("%w: token %d: %w", ErrChangesetConflict, id, err)
+	}
+	if current.Address != addr {
+		return TokenView{}, fmt.Errorf("%w: token %d is %s, not %s", ErrChangesetConflict, id, current.Address.Hex(), addr.Hex())
+	}
+	return current, nil
+}
+
+func (tx *Tx) applyChange(change TokenChange) error {
+	current, err := tx.current(change.ID, change.Before.Address)
+	if err != nil {
+		return err
+	}
+	// Start from the current token and copy over only the fields the change names.
+	next := current
+	for _, field := range change.Fields {
+		var stale bool
+		switch field {
+		case "name":
+			stale, next.Name = current.Name != change.Before.Name, change.After.Name
+		case "symbol":
+			stale, next.Symbol = current.Symbol != change.Before.Symbol, change.After.Symbol
+		case "decimals":
+			stale, next.Decimals = current.Decimals != change.Before.Decimals, change.After.Decimals
+		case "feeOnTransferPPM":
+			stale, next.FeeOnTransferPPM = current.FeeOnTransferPPM != change.Before.FeeOnTransferPPM, change.After.FeeOnTransferPPM
+		case "gasForTransfer":
+			stale, next.GasForTransfer = current.GasForTransfer != change.Before.GasForTransfer, change.After.GasForTransfer
+		case "flags":
+			stale, next.Flags = current.Flags != change.Before.Flags, change.After.Flags
+		default:
+			return fmt.Errorf("unknown field %q", field)
+		}
+		if stale {
+			return fmt.Errorf("%w: %s was changed since the diff", ErrChangesetConflict, field)
+		}
+	}
+	return tx.setView(current, next)
+}
+
+func (tx *Tx) applyAdd(v TokenView) error {
+	if v.ID == 0 || v.ID == math.MaxUint64 {
+		return fmt.Errorf("%w: %d is outside 1 to %d", ErrInvalidTokenID, v.ID, uint64(math.MaxUint64-1))
+	}
+	if current, err := getTokenByAddress(v.Address, tx.registry); err == nil {
+		return fmt.Errorf("%w: address %s is token %d", ErrChangesetConflict, v.Address.Hex(), current.ID)
+	}
+	if current, err := getTokenByID(v.ID, tx.registry); err == nil {
+		return fmt.Errorf("%w: ID is used by %s", ErrChangesetConflict, current.Address.Hex())
+	}
+	err := tx.apply(mutation{
+		kind:     mutationAdd,
+		id:       v.ID,
+		address:  v.Address,
+		name:     v.Name,
+		symbol:   v.Symbol,
+		decimals: v.Decimals,
+	})
+	if err != nil {
+		return err
+	}
+	added, err := getTokenByID(v.ID, tx.registry)
+	if err != nil {
+		return err
+	}
+	return tx.setView(added, v)
+}
+
+// setView makes the mutations that turn current into next, skipping unchanged columns.
+func (tx *Tx) setView(current, next TokenView) error {
+	if current.Name != next.Name || current.Symbol != next.Symbol || current.Decimals != next.Decimals {
+		err := tx.apply(mutation{
+			kind:     mutationMetadata,
+			id:       current.ID,
+			name:     next.Name,
+			symbol:   next.Symbol,
+			decimals: next.Decimals,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if current.FeeOnTransferPPM != next.FeeOnTransferPPM || current.GasForTransfer != next.GasForTransfer {
+		if err := tx.UpdateTokenPPM(current.ID, next.FeeOnTransferPPM, next.GasForTransfer); err != nil {
+			return err
+		}
+	}
+	if current.Flags != next.Flags {
+		return tx.apply(mutation{kind: mutationFlags, id: current.ID, flags: next.Flags})
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package token
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// newDiffPair returns a registry and an identical copy of it holding three tokens.
+func newDiffPair(t *testing.T) (*TokenSystem, *TokenSystem) {
+	ts := NewTokenSystem()
+	for i, symbol := range []string{"TKA", "TKB", "TKC"} {
+		_, err := ts.AddToken(addr(byte(i+1)), "Token "+symbol, symbol, 18)
+		require.NoError(t, err)
+	}
+	copied, err := NewTokenSystemFromState(ts.State())
+	require.NoError(t, err)
+	return ts, copied
+}
+
+// --- Unit Tests ---
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	a := TokenView{ID: 1, Address: addr(1), Name: "Token A", Symbol: "TKA", Decimals: 18}
+	b := TokenView{ID: 2, Address: addr(2), Name: "Token B", Symbol: "TKB", Decimals: 6}
+	c := TokenView{ID: 3, Address: addr(3), Name: "Token C", Symbol: "TKC", Decimals: 8}
+	renamed := b
+	renamed.Name, renamed.Symbol, renamed.GasForTransfer, renamed.Flags = "Token Bee", "BEE", 50_000, FlagPausable
+
+	changes, err := Diff([]TokenView{c, b, a}, []TokenView{renamed, {ID: 4, Address: addr(4)}, a})
+	require.NoError(t, err)
+	assert.Equal(t, Changeset{
+		Added:   []TokenView{{ID: 4, Address: addr(4)}},
+		Removed: []TokenView{c},
+		Changed: []TokenChange{{
+			ID: 2, Before: b, After: renamed,
+			Fields: []string{"name", "symbol", "gasForTransfer", "flags"},
+		}},
+	}, changes)
+	assert.False(t, changes.IsEmpty())
+
+	changes, err = Diff([]TokenView{a, b}, []TokenView{b, a})
+	require.NoError(t, err)
+	assert.True(t, changes.IsEmpty(), "order does not matter")
+}
+
+func TestDiff_Errors(t *testing.T) {
+	t.Parallel()
+	a := TokenView{ID: 1, Address: addr(1), Symbol: "TKA"}
+	b := TokenView{ID: 2, Address: addr(2), Symbol: "TKB"}
+
+	testCases := []struct {
+		name        string
+		from, to    []TokenView
+		expectedErr error
+	}{
+		{name: "Duplicate ID", from: []TokenView{a, {ID: 1, Address: addr(9)}}, expectedErr: ErrDuplicateID},
+		{name: "Duplicate address", to: []TokenView{a, {ID: 9, Address: addr(1)}}, expectedErr: ErrDuplicateAddress},
+		{name: "Address moved to another ID", from: []TokenView{a}, to: []TokenView{{ID: 3, Address: addr(1)}}, expectedErr: ErrChangesetConflict},
+		{name: "ID reassigned to another address", from: []TokenView{a, b}, to: []TokenView{{ID: 1, Address: addr(3)}, b}, expectedErr: ErrChangesetConflict},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Diff(tc.from, tc.to)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestTokenSystem_ApplyDiff(t *testing.T) {
+	t.Parallel()
+	staging, production := newDiffPair(t)
+
+	require.NoError(t, staging.DeleteToken(1))
+	require.NoError(t, staging.UpdateTokenPPM(2, 10_000, 65_000))
+	require.NoError(t, staging.SetFlags(2, FlagHoneypot))
+	_, err := staging.AddToken(addr(4), "Token D", "TKD", 6)
+	require.NoError(t, err)
+	require.NoError(t, staging.Update(func(tx *Tx) error {
+		return tx.Apply(Changeset{Changed: []TokenChange{{
+			ID:     3,
+			Before: TokenView{ID: 3, Address: addr(3), Name: "Token TKC", Symbol: "TKC", Decimals: 18},
+			After:  TokenView{ID: 3, Address: addr(3), Name: "Token Sea", Symbol: "SEA", Decimals: 9},
+			Fields: []string{"name", "symbol", "decimals"},
+		}}})
+	}))
+
+	changes, err := DiffSystems(production, staging)
+	require.NoError(t, err)
+	assert.Len(t, changes.Added, 1)
+	assert.Len(t, changes.Removed, 1)
+	assert.Len(t, changes.Changed, 2)
+
+	sub := production.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+	require.NoError(t, production.Apply(changes))
+	assert.Equal(t, staging.State(), production.State(), "IDs, tombstones and the next ID match")
+	assert.Empty(t, production.GetTokensBySymbol("TKC"), "a rename is reindexed")
+	assert.Len(t, production.GetTokensBySymbol("SEA"), 1)
+
+	// One delete, two updates and one rename, and an add.
+	kinds := make([]EventKind, 5)
+	for i := range kinds {
+		kinds[i] = receive(t, sub).Kind
+	}
+	assert.Equal(t, []EventKind{TokenDeleted, TokenUpdated, TokenUpdated, TokenUpdated, TokenAdded}, kinds)
+
+	changes, err = DiffSystems(production, staging)
+	require.NoError(t, err)
+	assert.True(t, changes.IsEmpty())
+}
+
+func TestTokenSystem_ApplyKeepsUnrelatedEdits(t *testing.T) {
+	t.Parallel()
+	staging, production := newDiffPair(t)
+	require.NoError(t, staging.UpdateTokenPPM(1, 5_000, 0))
+	changes, err := DiffSystems(production, staging)
+	require.NoError(t, err)
+
+	// Flags and another token change in production after the diff.
+	require.NoError(t, production.SetFlags(1, FlagPausable))
+	require.NoError(t, production.UpdateTokenPPM(2, 0, 21_000))
+	require.NoError(t, production.Apply(changes))
+
+	view, err := production.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5_000), view.FeeOnTransferPPM)
+	assert.Equal(t, FlagPausable, view.Flags)
+	view, err = production.GetTokenByID(2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(21_000), view.GasForTransfer)
+}
+
+func TestTokenSystem_ApplyConflicts(t *testing.T) {
+	t.Parallel()
+	tka := TokenView{ID: 1, Address: addr(1), Name: "Token", Symbol: "TKN", Decimals: 18}
+	feeChange := func(before uint32) TokenChange {
+		from, to := tka, tka
+		from.FeeOnTransferPPM, to.FeeOnTransferPPM = before, 7_000
+		return TokenChange{ID: 1, Before: from, After: to, Fields: []string{"feeOnTransferPPM"}}
+	}
+
+	testCases := []struct {
+		name        string
+		changes     Changeset
+		expectedErr error
+	}{
+		{
+			name:        "Address under another ID",
+			changes:     Changeset{Added: []TokenView{{ID: 10, Address: addr(1), Symbol: "DUP"}}},
+			expectedErr: ErrChangesetConflict,
+		},
+		{
+			name:        "ID in use",
+			changes:     Changeset{Added: []TokenView{{ID: 2, Address: addr(9), Symbol: "NEW"}}},
+			expectedErr: ErrChangesetConflict,
+		},
+		{
+			name:        "Deleted ID",
+			changes:     Changeset{Added: []TokenView{{ID: 4, Address: addr(9), Symbol: "NEW"}}},
+			expectedErr: ErrIDReused,
+		},
+		{
+			name:        "Zero ID",
+			changes:     Changeset{Added: []TokenView{{ID: 0, Address: addr(9), Symbol: "NEW"}}},
+			expectedErr: ErrInvalidTokenID,
+		},
+		{
+			name:        "Last ID",
+			changes:     Changeset{Added: []TokenView{{ID: math.MaxUint64, Address: addr(9), Symbol: "NEW"}}},
+			expectedErr: ErrInvalidTokenID,
+		},
+		{
+			name:        "Removed token missing",
+			changes:     Changeset{Removed: []TokenView{{ID: 4, Address: addr(4)}}},
+			expectedErr: ErrChangesetConflict,
+		},
+		{
+			name:        "Removed token has another address",
+			changes:     Changeset{Removed: []TokenView{{ID: 2, Address: addr(1)}}},
+			expectedErr: ErrChangesetConflict,
+		},
+		{
+			name:        "Field changed since the diff",
+			changes:     Changeset{Changed: []TokenChange{feeChange(1_000)}},
+			expectedErr: ErrChangesetConflict,
+		},
+		{
+			name: "Invalid change",
+			changes: Changeset{Changed: []TokenChange{{
+				ID: 1, Before: tka, After: TokenView{ID: 1, Address: addr(1)}, Fields: []string{"symbol"},
+			}}},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			// The valid first change is rolled back with the rest.
+			name: "Atomic",
+			changes: Changeset{
+				Changed: []TokenChange{feeChange(0)},
+				Added:   []TokenView{{ID: 2, Address: addr(9), Symbol: "NEW"}},
+			},
+			expectedErr: ErrChangesetConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := NewTokenSystem()
+			populateTestSystem(t, ts)
+			require.NoError(t, ts.DeleteToken(4))
+			before := ts.State()
+
+			err := ts.Apply(tc.changes)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, before, ts.State(), "a failed Apply changes nothing")
+		})
+	}
+}
+
+func TestTokenSystem_ApplyRenameGuard(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem(WithCanonicalGuard())
+	ts.SetCanonical(addr(1), true)
+	_, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+	require.NoError(t, err)
+	id, err := ts.AddToken(addr(2), "Other", "OTHER", 6)
+	require.NoError(t, err)
+
+	before, err := ts.GetTokenByID(id)
+	require.NoError(t, err)
+	after := before
+	after.Symbol = "USDC"
+	err = ts.Apply(Changeset{Changed: []TokenChange{{ID: id, Before: before, After: after, Fields: []string{"symbol"}}}})
+	assert.ErrorIs(t, err, ErrImpersonation)
+}
+
+func TestWAL_RecoversApply(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	populate(t, ts)
+
+	target := ts.View()
+	target[0].Name, target[0].Symbol, target[0].Decimals = "Renamed", "REN", 9
+	changes, err := Diff(ts.View(), target)
+	require.NoError(t, err)
+	require.NoError(t, ts.Apply(changes))
+	expected := ts.State()
+	require.NoError(t, ts.Close())
+
+	reopened := openTestSystem(t, opts)
+	assert.Equal(t, expected, reopened.State())
+}
+
+// --- Benchmarking ---
+
+func BenchmarkDiff(b *testing.B) {
+	from := make([]TokenView, 10_000)
+	for i := range from {
+		from[i] = TokenView{ID: uint64(i + 1), Address: addr(byte(i)), Symbol: "TKN"}
+		from[i].Address[1], from[i].Address[2] = byte(i>>8), byte(i>>16)
+	}
+	to := append([]TokenView(nil), from...)
+	for i := 0; i < len(to); i += 100 {
+		to[i].GasForTransfer = 50_000
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Diff(from, to); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
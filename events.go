@@ -0,0 +1,264 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSubscriptionBuffer is the number of undelivered events a subscription holds when
+// SubscribeOptions.Buffer is zero.
+const DefaultSubscriptionBuffer = 256
+
+// EventKind identifies the change an Event describes.
+type EventKind uint8
+
+const (
+	// TokenAdded reports a new token. Event.Token is the token as added.
+	TokenAdded EventKind = iota + 1
+	// TokenDeleted reports a removed token. Event.Token is the token as it was before deletion.
+	TokenDeleted
+	// TokenUpdated reports a change to an existing token: its fee, gas or flags, or, when a
+	// changeset is applied, its name, symbol or decimals. Event.Token is the token after
+	// the update and Event.Previous the token before it.
+	TokenUpdated
+	// ResyncRequired reports that events were dropped because the subscriber fell behind.
+	// The subscriber must reload its state with ViewWithSeq and then ignore every event
+	// whose Seq is not greater than the sequence number it returned.
+	ResyncRequired
+)
+
+// String returns the name of the event kind.
+func (k EventKind) String() string {
+	switch k {
+	case TokenAdded:
+		return "TokenAdded"
+	case TokenDeleted:
+		return "TokenDeleted"
+	case TokenUpdated:
+		return "TokenUpdated"
+	case ResyncRequired:
+		return "ResyncRequired"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes a single committed registry change.
+//
+// Seq increases by one for every change committed by the TokenSystem, starting from 1 when
+// it is created or opened, so gaps only appear where events were dropped. For
+// ResyncRequired, Seq is that of the most recent dropped event.
+type Event struct {
+	Seq      uint64    `json:"seq"`
+	Kind     EventKind `json:"kind"`
+	Token    TokenView `json:"token"`
+	Previous TokenView `json:"previous"`
+}
+
+// OverflowPolicy decides what happens when a subscriber's buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// DropOnOverflow discards the subscriber's pending events and queues a single
+	// ResyncRequired event in their place. Writers never wait for subscribers.
+	DropOnOverflow OverflowPolicy = iota
+	// BlockOnOverflow makes writers wait for the subscriber to make room, applying
+	// backpressure to every writer of the TokenSystem. If SubscribeOptions.BlockTimeout is
+	// set and elapses, the subscriber is treated as under DropOnOverflow for that event.
+	BlockOnOverflow
+)
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Buffer is the number of undelivered events held for the subscriber. Zero means
+	// DefaultSubscriptionBuffer.
+	Buffer int
+	// Policy decides what happens when the buffer is full.
+	Policy OverflowPolicy
+	// BlockTimeout bounds how long a writer waits under BlockOnOverflow. Zero means
+	// indefinitely.
+	BlockTimeout time.Duration
+}
+
+// Subscription is a stream of registry change events created by TokenSystem.Subscribe.
+type Subscription struct {
+	// C delivers events in Seq order. It is closed after Close is called.
+	C <-chan Event
+
+	ts   *TokenSystem
+	opts SubscribeOptions
+	out  chan Event
+
+	mu    sync.Mutex
+	queue []Event
+
+	notify    chan struct{} // Signals the pump that the queue is non-empty
+	space     chan struct{} // Signals a blocked writer that the queue has shrunk
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Subscribe starts a stream of events for every change committed after it returns. Events
+// are queued while the write lock is held, so they are delivered in commit order.
+//
+// To combine a subscription with the current state, subscribe first, then call
+// ViewWithSeq and ignore events whose Seq is not greater than the sequence number it
+// returns. The subscriber must not call TokenSystem write methods from the goroutine that
+// receives events under BlockOnOverflow, or it may wait on itself.
+func (ts *TokenSystem) Subscribe(opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultSubscriptionBuffer
+	}
+	out := make(chan Event)
+	sub := &Subscription{
+		C:      out,
+		ts:     ts,
+		opts:   opts,
+		out:    out,
+		notify: make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go sub.pump()
+
+	ts.mu.Lock()
+	ts.subscribers = append(ts.subscribers, sub)
+	ts.mu.Unlock()
+	return sub
+}
+
+// Close stops the subscription and closes C. Events not yet received are discarded. It is
+// safe to call Close more than once and from any goroutine.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		// Release any writer blocked on this subscriber before taking the lock it holds.
+		close(s.done)
+
+		s.ts.mu.Lock()
+		defer s.ts.mu.Unlock()
+		for i, sub := range s.ts.subscribers {
+			if sub == s {
+				s.ts.subscribers = append(s.ts.subscribers[:i], s.ts.subscribers[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+// ViewWithSeq returns a view of all tokens together with the Seq of the last change it
+// includes. It acquires a read lock, allowing multiple concurrent readers.
+func (ts *TokenSystem) ViewWithSeq() ([]TokenView, uint64) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return viewRegistry(ts.registry), ts.seq
+}
+
+// publish assigns sequence numbers to events and queues them for every subscriber.
+// Callers must hold the write lock and call it after the changes are installed.
+func (ts *TokenSystem) publish(events []Event) {
+	for i := range events {
+		ts.seq++
+		events[i].Seq = ts.seq
+	}
+	for _, sub := range ts.subscribers {
+		for _, ev := range events {
+			sub.enqueue(ev)
+		}
+	}
+}
+
+// enqueue adds ev to the subscriber's queue, applying the overflow policy if it is full.
+func (s *Subscription) enqueue(ev Event) {
+	if s.opts.Policy == BlockOnOverflow && !s.waitForSpace() {
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.queue) >= s.opts.Buffer {
+		// Everything pending is superseded by the resync the subscriber has to perform.
+		s.queue = append(s.queue[:0], Event{Seq: ev.Seq, Kind: ResyncRequired})
+	} else {
+		s.queue = append(s.queue, ev)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// waitForSpace blocks until the queue has room, the timeout elapses or the subscription
+// is closed. It reports false only if the subscription was closed.
+func (s *Subscription) waitForSpace() bool {
+	var timeout <-chan time.Time
+	if s.opts.BlockTimeout > 0 {
+		timer := time.NewTimer(s.opts.BlockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		s.mu.Lock()
+		full := len(s.queue) >= s.opts.Buffer
+		s.mu.Unlock()
+		if !full {
+			return true
+		}
+		select {
+		case <-s.space:
+		case <-timeout:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// pump moves queued events to C until the subscription is closed.
+func (s *Subscription) pump() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		ev := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.space <- struct{}{}:
+		default:
+		}
+		select {
+		case s.out <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// mutationEvent applies m to the registry and returns the event describing it, without a
+// sequence number.
+func mutationEvent(m mutation, registry *TokenRegistry) (Event, error) {
+	before, _ := getTokenByID(m.id, registry)
+	if err := applyMutation(m, registry); err != nil {
+		return Event{}, err
+	}
+	switch m.kind {
+	case mutationDelete:
+		return Event{Kind: TokenDeleted, Token: before}, nil
+	case mutationUpdate, mutationFlags, mutationMetadata:
+		after, _ := getTokenByID(m.id, registry)
+		return Event{Kind: TokenUpdated, Token: after, Previous: before}, nil
+	default:
+		after, _ := getTokenByID(m.id, registry)
+		return Event{Kind: TokenAdded, Token: after}, nil
+	}
+}
@@ -0,0 +1,220 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// receive reads the next event from a subscription, failing the test if none arrives.
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.C:
+		require.True(t, ok, "subscription closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+// receiveUntil reads events until one with the given Seq arrives and returns them all.
+func receiveUntil(t *testing.T, sub *Subscription, seq uint64) []Event {
+	t.Helper()
+	var events []Event
+	for {
+		ev := receive(t, sub)
+		events = append(events, ev)
+		if ev.Seq >= seq {
+			return events
+		}
+	}
+}
+
+// --- Unit Tests ---
+
+func TestTokenSystem_Subscribe(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	sub := ts.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(id, 15_000, 40000))
+	require.NoError(t, ts.DeleteToken(id))
+	assert.Error(t, ts.DeleteToken(id), "failed writes produce no events")
+
+	added := TokenView{ID: id, Address: addr(1), Name: "Token A", Symbol: "TKA", Decimals: 18}
+	updated := added
+	updated.FeeOnTransferPPM, updated.GasForTransfer = 15_000, 40000
+
+	assert.Equal(t, Event{Seq: 1, Kind: TokenAdded, Token: added}, receive(t, sub))
+	assert.Equal(t, Event{Seq: 2, Kind: TokenUpdated, Token: updated, Previous: added}, receive(t, sub))
+	assert.Equal(t, Event{Seq: 3, Kind: TokenDeleted, Token: updated}, receive(t, sub))
+
+	view, seq := ts.ViewWithSeq()
+	assert.Empty(t, view)
+	assert.Equal(t, uint64(3), seq)
+}
+
+func TestTokenSystem_SubscribeTransactions(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem(WithLockFreeReads())
+	sub := ts.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+
+	require.Error(t, ts.Update(func(tx *Tx) error {
+		_, _ = tx.AddToken(addr(9), "Rolled Back", "RB", 18)
+		return errors.New("abort")
+	}))
+	result := ts.AddTokens([]TokenMetadata{{Address: addr(1), Symbol: "TKA"}, {Address: addr(2), Symbol: "TKB"}})
+	require.NoError(t, ts.Update(func(tx *Tx) error {
+		if err := tx.DeleteToken(result.Added[addr(1)]); err != nil {
+			return err
+		}
+		return tx.UpdateTokenPPM(result.Added[addr(2)], 20_000, 1)
+	}))
+
+	var kinds []EventKind
+	for i, ev := range receiveUntil(t, sub, 4) {
+		assert.Equal(t, uint64(i+1), ev.Seq, "rolled-back transactions consume no sequence numbers")
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.Equal(t, []EventKind{TokenAdded, TokenAdded, TokenDeleted, TokenUpdated}, kinds)
+}
+
+func TestTokenSystem_SubscribeDropOnOverflow(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	sub := ts.Subscribe(SubscribeOptions{Buffer: 2})
+	defer sub.Close()
+
+	// Nobody is receiving, so the writes overflow the buffer without blocking.
+	for i := 0; i < 20; i++ {
+		require.NoError(t, ts.UpdateTokenPPM(id, uint32(i), uint64(i)))
+	}
+
+	events := receiveUntil(t, sub, 21)
+	var resync *Event
+	for i := range events {
+		if events[i].Kind == ResyncRequired {
+			resync = &events[i]
+		} else if resync != nil {
+			assert.Greater(t, events[i].Seq, resync.Seq, "events after a resync follow the dropped ones")
+		}
+	}
+	require.NotNil(t, resync)
+	assert.Less(t, len(events), 20)
+
+	// Resynchronising yields the latest state.
+	view, seq := ts.ViewWithSeq()
+	assert.Equal(t, uint64(21), seq)
+	assert.Equal(t, uint64(19), view[0].GasForTransfer)
+}
+
+func TestTokenSystem_SubscribeBlockOnOverflow(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	sub := ts.Subscribe(SubscribeOptions{Buffer: 1, Policy: BlockOnOverflow})
+	defer sub.Close()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			_ = ts.UpdateTokenPPM(id, 0, uint64(i))
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		ev := receive(t, sub)
+		require.Equal(t, TokenUpdated, ev.Kind)
+		require.Equal(t, uint64(i+2), ev.Seq, "backpressure never drops events")
+		require.Equal(t, uint64(i), ev.Token.GasForTransfer)
+	}
+}
+
+func TestTokenSystem_SubscribeBlockTimeout(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	sub := ts.Subscribe(SubscribeOptions{Buffer: 1, Policy: BlockOnOverflow, BlockTimeout: 10 * time.Millisecond})
+	defer sub.Close()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, ts.UpdateTokenPPM(id, 0, uint64(i)))
+	}
+
+	var kinds []EventKind
+	for _, ev := range receiveUntil(t, sub, 6) {
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.Contains(t, kinds, ResyncRequired)
+}
+
+func TestTokenSystem_SubscriptionClose(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	sub := ts.Subscribe(SubscribeOptions{Buffer: 1, Policy: BlockOnOverflow})
+
+	// Nobody receives, so the writer blocks on the subscriber once its buffer is full.
+	blocked := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if err := ts.UpdateTokenPPM(id, 0, uint64(i)); err != nil {
+				blocked <- err
+				return
+			}
+		}
+		blocked <- nil
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	sub.Close()
+	sub.Close()
+	select {
+	case err := <-blocked:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer still blocked after Close")
+	}
+	for range sub.C {
+	}
+	assert.Empty(t, ts.subscribers)
+}
+
+func TestEventKind_String(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "TokenAdded", TokenAdded.String())
+	assert.Equal(t, "ResyncRequired", ResyncRequired.String())
+	assert.Equal(t, "Unknown", EventKind(0).String())
+}
+
+// --- Benchmarking ---
+
+func BenchmarkTokenSystem_UpdateWithSubscriber(b *testing.B) {
+	ts := newBenchSystem(b, 1000)
+	sub := ts.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+	go func() {
+		for range sub.C {
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = ts.UpdateTokenPPM(uint64(i%1000+1), 5_000, uint64(i))
+	}
+}
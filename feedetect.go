@@ -0,0 +1,276 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrTransferReverted is returned when the simulated transfer reverts or returns false.
+	ErrTransferReverted = errors.New("fee detection: transfer reverted")
+	// ErrZeroReceived is returned when the transfer succeeds but the recipient's balance
+	// does not grow.
+	ErrZeroReceived = errors.New("fee detection: recipient received nothing")
+	// ErrReceivedMoreThanSent is returned when the recipient's balance grows by more than
+	// the amount sent, as happens with some rebasing and reflection tokens.
+	ErrReceivedMoreThanSent = errors.New("fee detection: recipient received more than was sent")
+	// ErrBalanceOverride is returned when the sender's balance could not be funded through
+	// a storage override, usually because the token's balance mapping is not at the
+	// configured slot.
+	ErrBalanceOverride = errors.New("fee detection: sender balance override had no effect")
+)
+
+// ERC20 transfer-related function selectors.
+var (
+	selectorBalanceOf = []byte{0x70, 0xa0, 0x82, 0x31} // balanceOf(address)
+	selectorTransfer  = []byte{0xa9, 0x05, 0x9c, 0xbb} // transfer(address,uint256)
+)
+
+// Synthetic holders used by NewSimulateV1Simulator. Nothing is special about these
+// addresses beyond being very unlikely to hold tokens or be blacklisted.
+var (
+	DefaultSimulationSender    = common.HexToAddress("0x5e4de55e4de55e4de55e4de55e4de55e4de50001")
+	DefaultSimulationRecipient = common.HexToAddress("0x5e4de55e4de55e4de55e4de55e4de55e4de50002")
+)
+
+// TransferSimulation is the outcome of one simulated transfer.
+type TransferSimulation struct {
+	Sent     *big.Int
+	Received *big.Int
+	GasUsed  uint64
+}
+
+// TransferSimulator simulates transferring amount of token between two holders without
+// touching real state. Implementations report a reverted transfer as ErrTransferReverted.
+type TransferSimulator interface {
+	SimulateTransfer(ctx context.Context, token common.Address, amount *big.Int) (TransferSimulation, error)
+}
+
+// RPCCaller is the subset of *rpc.Client used by SimulateV1Simulator.
+type RPCCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// SimulateV1Simulator simulates transfers with a single eth_simulateV1 request. It funds
+// the sender through a storage override of the token's balance mapping, then runs
+// balanceOf(sender), balanceOf(recipient), transfer(recipient, amount) and
+// balanceOf(recipient) again in one simulated block. The amount received is the growth
+// of the recipient's balance, so a recipient that already holds the token is measured
+// correctly.
+//
+// The override assumes a Solidity-style mapping(address => uint256) at BalanceSlot, or
+// the per-token slot in BalanceSlots. Tokens with other layouts are detected by the
+// balanceOf(sender) check and reported as ErrBalanceOverride.
+type SimulateV1Simulator struct {
+	client RPCCaller
+	// Sender and Recipient are the synthetic holders the transfer runs between.
+	Sender    common.Address
+	Recipient common.Address
+	// BalanceSlot is the storage slot of the balance mapping for tokens not in BalanceSlots.
+	BalanceSlot uint64
+	// BalanceSlots overrides BalanceSlot for individual tokens.
+	BalanceSlots map[common.Address]uint64
+	// Block is the block tag or number the simulation builds on. Empty means "latest".
+	Block string
+}
+
+// NewSimulateV1Simulator creates a SimulateV1Simulator using the default synthetic
+// holders and balance slot 0, which is correct for most OpenZeppelin-derived tokens.
+func NewSimulateV1Simulator(client RPCCaller) *SimulateV1Simulator {
+	return &SimulateV1Simulator{
+		client:       client,
+		Sender:       DefaultSimulationSender,
+		Recipient:    DefaultSimulationRecipient,
+		BalanceSlots: make(map[common.Address]uint64),
+	}
+}
+
+// simulateV1Call and simulateV1Result mirror the JSON shapes of eth_simulateV1.
+type simulateV1Call struct {
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Input hexutil.Bytes  `json:"input"`
+}
+
+type simulateV1Result struct {
+	ReturnData hexutil.Bytes    `json:"returnData"`
+	GasUsed    hexutil.Uint64   `json:"gasUsed"`
+	Status     hexutil.Uint64   `json:"status"`
+	Error      *simulateV1Error `json:"error,omitempty"`
+}
+
+type simulateV1Error struct {
+	Message string `json:"message"`
+}
+
+// SimulateTransfer implements TransferSimulator.
+func (s *SimulateV1Simulator) SimulateTransfer(ctx context.Context, token common.Address, amount *big.Int) (TransferSimulation, error) {
+	slot := s.BalanceSlot
+	if perToken, ok := s.BalanceSlots[token]; ok {
+		slot = perToken
+	}
+	block := s.Block
+	if block == "" {
+		block = "latest"
+	}
+
+	payload := map[string]interface{}{
+		"blockStateCalls": []interface{}{map[string]interface{}{
+			"stateOverrides": map[common.Address]interface{}{
+				token: map[string]interface{}{
+					"stateDiff": map[common.Hash]common.Hash{
+						mappingSlot(s.Sender, slot): common.BigToHash(amount),
+					},
+				},
+			},
+			"calls": []simulateV1Call{
+				{From: s.Sender, To: token, Input: balanceOfCall(s.Sender)},
+				{From: s.Sender, To: token, Input: balanceOfCall(s.Recipient)},
+				{From: s.Sender, To: token, Input: transferCall(s.Recipient, amount)},
+				{From: s.Sender, To: token, Input: balanceOfCall(s.Recipient)},
+			},
+		}},
+	}
+
+	var blocks []struct {
+		Calls []simulateV1Result `json:"calls"`
+	}
+	if err := s.client.CallContext(ctx, &blocks, "eth_simulateV1", payload, block); err != nil {
+		return TransferSimulation{}, err
+	}
+	if len(blocks) != 1 || len(blocks[0].Calls) != 4 {
+		return TransferSimulation{}, errors.New("eth_simulateV1: unexpected result shape")
+	}
+	calls := blocks[0].Calls
+
+	funded, err := decodeBalance(calls[0])
+	if err != nil || funded.Cmp(amount) != 0 {
+		return TransferSimulation{}, fmt.Errorf("%w: slot %d", ErrBalanceOverride, slot)
+	}
+	before, err := decodeBalance(calls[1])
+	if err != nil {
+		return TransferSimulation{}, err
+	}
+	transfer := calls[2]
+	if transfer.Status != 1 {
+		reason := "no reason"
+		if transfer.Error != nil {
+			reason = transfer.Error.Message
+		}
+		return TransferSimulation{}, fmt.Errorf("%w: %s", ErrTransferReverted, reason)
+	}
+	// Tokens that return nothing are treated as successful; an explicit false is not.
+	if ret := transfer.ReturnData; len(ret) >= 32 && new(big.Int).SetBytes(ret[:32]).Sign() == 0 {
+		return TransferSimulation{}, fmt.Errorf("%w: transfer returned false", ErrTransferReverted)
+	}
+	after, err := decodeBalance(calls[3])
+	if err != nil {
+		return TransferSimulation{}, err
+	}
+
+	return TransferSimulation{
+		Sent:     new(big.Int).Set(amount),
+		Received: after.Sub(after, before),
+		GasUsed:  uint64(transfer.GasUsed),
+	}, nil
+}
+
+// mappingSlot returns the storage slot of key in a Solidity mapping at slot.
+func mappingSlot(key common.Address, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(key.Bytes(), 32),
+		common.LeftPadBytes(new(big.Int).SetUint64(slot).Bytes(), 32),
+	)
+}
+
+func balanceOfCall(holder common.Address) []byte {
+	return append(append([]byte{}, selectorBalanceOf...), common.LeftPadBytes(holder.Bytes(), 32)...)
+}
+
+func transferCall(to common.Address, amount *big.Int) []byte {
+	input := append([]byte{}, selectorTransfer...)
+	input = append(input, common.LeftPadBytes(to.Bytes(), 32)...)
+	return append(input, common.LeftPadBytes(amount.Bytes(), 32)...)
+}
+
+func decodeBalance(res simulateV1Result) (*big.Int, error) {
+	if res.Status != 1 || len(res.ReturnData) < 32 {
+		return nil, fmt.Errorf("%w: balanceOf() failed", ErrInvalidMetadata)
+	}
+	return new(big.Int).SetBytes(res.ReturnData[:32]), nil
+}
+
+// FeeMeasurement is the result of a fee detection run.
+type FeeMeasurement struct {
+	FeeOnTransferPPM uint32
+	GasForTransfer   uint64
+	Simulation       TransferSimulation
+}
+
+// FeeDetector derives a token's fee-on-transfer rate and transfer gas by
+// comparing the amount sent with the amount received in a simulated transfer.
+type FeeDetector struct {
+	simulator TransferSimulator
+	// Amount is the raw amount transferred. Nil means one whole token, but never less
+	// than 10^6 raw units so that small fees remain measurable.
+	Amount *big.Int
+}
+
+// NewFeeDetector creates a FeeDetector that runs transfers through the given simulator.
+func NewFeeDetector(simulator TransferSimulator) *FeeDetector {
+	return &FeeDetector{simulator: simulator}
+}
+
+// Detect simulates a transfer of the token and measures its fee and gas.
+func (d *FeeDetector) Detect(ctx context.Context, view TokenView) (FeeMeasurement, error) {
+	amount := d.Amount
+	if amount == nil {
+		amount = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(view.Decimals)), nil)
+		if floor := big.NewInt(1_000_000); amount.Cmp(floor) < 0 {
+			amount = floor
+		}
+	}
+
+	sim, err := d.simulator.SimulateTransfer(ctx, view.Address, amount)
+	if err != nil {
+		return FeeMeasurement{}, err
+	}
+	switch {
+	case sim.Received.Sign() <= 0:
+		return FeeMeasurement{}, fmt.Errorf("%w: sent %s, received %s", ErrZeroReceived, sim.Sent, sim.Received)
+	case sim.Received.Cmp(sim.Sent) > 0:
+		return FeeMeasurement{}, fmt.Errorf("%w: sent %s, received %s", ErrReceivedMoreThanSent, sim.Sent, sim.Received)
+	}
+
+	// (sent - received) / sent in parts per million, rounded to the nearest unit.
+	fee := new(big.Int).Sub(sim.Sent, sim.Received)
+	fee.Mul(fee, bigFeeDenominator).Add(fee, new(big.Int).Rsh(sim.Sent, 1)).Quo(fee, sim.Sent)
+	return FeeMeasurement{
+		FeeOnTransferPPM: uint32(fee.Uint64()),
+		GasForTransfer:   sim.GasUsed,
+		Simulation:       sim,
+	}, nil
+}
+
+// DetectAndUpdate measures the fee and gas of the token with the given ID and stores
+// them with UpdateTokenPPM. The lock is not held during the simulation.
+func (d *FeeDetector) DetectAndUpdate(ctx context.Context, ts *TokenSystem, id uint64) (FeeMeasurement, error) {
+	view, err := ts.GetTokenByID(id)
+	if err != nil {
+		return FeeMeasurement{}, err
+	}
+	measurement, err := d.Detect(ctx, view)
+	if err != nil {
+		return FeeMeasurement{}, err
+	}
+	if err := ts.UpdateTokenPPM(id, measurement.FeeOnTransferPPM, measurement.GasForTransfer); err != nil {
+		return FeeMeasurement{}, err
+	}
+	return measurement, nil
+}
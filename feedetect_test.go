@@ -0,0 +1,197 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// fakeSimToken scripts how a token behaves in a simulated transfer.
+type fakeSimToken struct {
+	balanceSlot  uint64
+	feePercent   int64 // Whole-percent fee deducted from the received amount
+	bonus        int64 // Extra raw units credited to the recipient
+	held         int64 // Raw units the recipient holds before the transfer
+	revertReason string
+	returnFalse  bool
+}
+
+// fakeSimulateRPC answers eth_simulateV1 requests the way a node would for fakeSimTokens.
+type fakeSimulateRPC struct {
+	tokens map[common.Address]fakeSimToken
+	err    error
+}
+
+func (f *fakeSimulateRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if f.err != nil {
+		return f.err
+	}
+	if method != "eth_simulateV1" {
+		return errors.New("unexpected method " + method)
+	}
+
+	// Round-trip the request through JSON, exactly as it would reach a node.
+	raw, err := json.Marshal(args[0])
+	if err != nil {
+		return err
+	}
+	var req struct {
+		BlockStateCalls []struct {
+			StateOverrides map[common.Address]struct {
+				StateDiff map[common.Hash]common.Hash `json:"stateDiff"`
+			} `json:"stateOverrides"`
+			Calls []simulateV1Call `json:"calls"`
+		} `json:"blockStateCalls"`
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return err
+	}
+	block := req.BlockStateCalls[0]
+	tokenAddr := block.Calls[0].To
+	token := f.tokens[tokenAddr]
+	sender := block.Calls[0].From
+
+	funded := new(big.Int)
+	if v, ok := block.StateOverrides[tokenAddr].StateDiff[mappingSlot(sender, token.balanceSlot)]; ok {
+		funded = v.Big()
+	}
+	amount := new(big.Int).SetBytes(block.Calls[2].Input[36:68])
+	held := big.NewInt(token.held)
+
+	ok := func(data []byte, gas uint64) simulateV1Result {
+		return simulateV1Result{ReturnData: data, GasUsed: hexutil.Uint64(gas), Status: 1}
+	}
+	calls := []simulateV1Result{ok(common.BigToHash(funded).Bytes(), 24000), ok(common.BigToHash(held).Bytes(), 24000)}
+	switch {
+	case funded.Cmp(amount) < 0:
+		calls = append(calls, simulateV1Result{Error: &simulateV1Error{"execution reverted: insufficient balance"}})
+		calls = append(calls, ok(common.BigToHash(held).Bytes(), 24000))
+	case token.revertReason != "":
+		calls = append(calls, simulateV1Result{Error: &simulateV1Error{token.revertReason}})
+		calls = append(calls, ok(common.BigToHash(held).Bytes(), 24000))
+	case token.returnFalse:
+		calls = append(calls, ok(make([]byte, 32), 30000))
+		calls = append(calls, ok(common.BigToHash(held).Bytes(), 24000))
+	default:
+		received := new(big.Int).Mul(amount, big.NewInt(100-token.feePercent))
+		received.Div(received, big.NewInt(100))
+		received.Add(received, big.NewInt(token.bonus))
+		calls = append(calls, ok(common.BigToHash(big.NewInt(1)).Bytes(), 51234))
+		calls = append(calls, ok(common.BigToHash(received.Add(received, held)).Bytes(), 24000))
+	}
+
+	encoded, err := json.Marshal([]map[string]interface{}{{"calls": calls}})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, result)
+}
+
+func newFakeSimulateRPC() *fakeSimulateRPC {
+	return &fakeSimulateRPC{tokens: map[common.Address]fakeSimToken{
+		addr(1): {},
+		addr(2): {feePercent: 5},
+		addr(3): {balanceSlot: 9, feePercent: 1},
+		addr(4): {revertReason: "execution reverted: trading not enabled"},
+		addr(5): {feePercent: 100},
+		addr(6): {bonus: 7},
+		addr(7): {returnFalse: true},
+		addr(8): {feePercent: 5, held: 5_000_000},
+	}}
+}
+
+// --- Unit Tests ---
+
+func TestFeeDetector_Detect(t *testing.T) {
+	t.Parallel()
+	simulator := NewSimulateV1Simulator(newFakeSimulateRPC())
+	simulator.BalanceSlots[addr(3)] = 9
+	detector := NewFeeDetector(simulator)
+
+	testCases := []struct {
+		name        string
+		view        TokenView
+		expectedFee uint32
+		expectedErr error
+	}{
+		{name: "No fee", view: TokenView{Address: addr(1), Decimals: 18}, expectedFee: 0},
+		{name: "Five percent fee", view: TokenView{Address: addr(2), Decimals: 18}, expectedFee: 50_000},
+		{name: "Per-token balance slot", view: TokenView{Address: addr(3), Decimals: 6}, expectedFee: 10_000},
+		{name: "Transfer reverts", view: TokenView{Address: addr(4), Decimals: 18}, expectedErr: ErrTransferReverted},
+		{name: "Nothing received", view: TokenView{Address: addr(5), Decimals: 18}, expectedErr: ErrZeroReceived},
+		{name: "Received more than sent", view: TokenView{Address: addr(6), Decimals: 18}, expectedErr: ErrReceivedMoreThanSent},
+		{name: "Transfer returns false", view: TokenView{Address: addr(7), Decimals: 18}, expectedErr: ErrTransferReverted},
+		{name: "Recipient already holds the token", view: TokenView{Address: addr(8), Decimals: 6}, expectedFee: 50_000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := detector.Detect(context.Background(), tc.view)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFee, m.FeeOnTransferPPM)
+			assert.Equal(t, uint64(51234), m.GasForTransfer)
+		})
+	}
+}
+
+func TestFeeDetector_WrongBalanceSlot(t *testing.T) {
+	t.Parallel()
+	// Without the per-token slot, the override lands in the wrong place.
+	detector := NewFeeDetector(NewSimulateV1Simulator(newFakeSimulateRPC()))
+	_, err := detector.Detect(context.Background(), TokenView{Address: addr(3), Decimals: 6})
+	assert.ErrorIs(t, err, ErrBalanceOverride)
+}
+
+func TestFeeDetector_Amount(t *testing.T) {
+	t.Parallel()
+	detector := NewFeeDetector(NewSimulateV1Simulator(newFakeSimulateRPC()))
+
+	m, err := detector.Detect(context.Background(), TokenView{Address: addr(2), Decimals: 0})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1_000_000), m.Simulation.Sent, "low-decimal tokens use the minimum amount")
+
+	detector.Amount = big.NewInt(12345)
+	m, err = detector.Detect(context.Background(), TokenView{Address: addr(2), Decimals: 18})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(12345), m.Simulation.Sent)
+}
+
+func TestFeeDetector_DetectAndUpdate(t *testing.T) {
+	t.Parallel()
+	rpc := newFakeSimulateRPC()
+	detector := NewFeeDetector(NewSimulateV1Simulator(rpc))
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(2), "Taxed", "TAX", 18)
+	require.NoError(t, err)
+
+	_, err = detector.DetectAndUpdate(context.Background(), ts, id)
+	require.NoError(t, err)
+	view, err := ts.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(50_000), view.FeeOnTransferPPM)
+	assert.Equal(t, uint64(51234), view.GasForTransfer)
+
+	_, err = detector.DetectAndUpdate(context.Background(), ts, 999)
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	// A failed detection must leave the stored values untouched.
+	rpc.err = errors.New("connection refused")
+	_, err = detector.DetectAndUpdate(context.Background(), ts, id)
+	assert.ErrorIs(t, err, rpc.err)
+	view, err = ts.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(51234), view.GasForTransfer)
+}
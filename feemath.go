@@ -0,0 +1,217 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/holiman/uint256"
+)
+
+// FeeDenominator is the scale of fee rates in parts per million: a rate of 3_000 is a
+// 0.3% fee on every transfer, and FeeDenominator itself is 100%.
+const FeeDenominator = 1_000_000
+
+// MaxHops is the most transfers NetAmount and GrossAmount accept. Real routes are far
+// shorter, and the bound keeps the work done by GrossAmount, which searches once per
+// hop, small whatever the caller passes.
+const MaxHops = 64
+
+var (
+	// ErrInvalidFeeRate is returned when a fee rate is negative, not a number, or above 100%.
+	ErrInvalidFeeRate = errors.New("fee: rate outside 0-100%")
+	// ErrUnreachableAmount is returned by GrossAmount when no gross amount can deliver the
+	// requested net amount, which only happens with a 100% fee.
+	ErrUnreachableAmount = errors.New("fee: net amount unreachable")
+	// ErrInvalidHops is returned when a hop count is negative or above MaxHops.
+	ErrInvalidHops = fmt.Errorf("fee: hop count outside 0-%d", MaxHops)
+)
+
+var (
+	bigFeeDenominator  = big.NewInt(FeeDenominator)
+	bigHalfDenominator = big.NewInt(FeeDenominator / 2)
+)
+
+// FeePPMFromPercent converts a fee percentage such as 0.3 into parts per million,
+// rounding to the nearest unit. Negative, NaN and above-100% values are rejected with
+// ErrInvalidFeeRate, as is a fee too small to round to 1 ppm, so that a real fee is
+// never recorded as none.
+func FeePPMFromPercent(percent float64) (uint32, error) {
+	if math.IsNaN(percent) || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("%w: %v%%", ErrInvalidFeeRate, percent)
+	}
+	ppm := uint32(math.Round(percent * (FeeDenominator / 100)))
+	if ppm == 0 && percent != 0 {
+		return 0, fmt.Errorf("%w: %v%% is below 1 ppm", ErrInvalidFeeRate, percent)
+	}
+	return ppm, nil
+}
+
+// FeePercent converts a fee in parts per million into a percentage, for display.
+func FeePercent(ppm uint32) float64 {
+	return float64(ppm) / (FeeDenominator / 100)
+}
+
+// validateHops rejects hop counts outside 0 to MaxHops.
+func validateHops(hops int) error {
+	if hops < 0 || hops > MaxHops {
+		return fmt.Errorf("%w: %d", ErrInvalidHops, hops)
+	}
+	return nil
+}
+
+// validateFeePPM rejects fees above 100%.
+func validateFeePPM(ppm uint32) error {
+	if ppm > FeeDenominator {
+		return fmt.Errorf("%w: %d ppm", ErrInvalidFeeRate, ppm)
+	}
+	return nil
+}
+
+// transferFee returns the fee a token charging rate parts per million takes from a
+// transfer of amount, rounded to a whole raw unit. Most tokens compute
+// amount * rate / denominator in Solidity, which is RoundDown. RoundExact fails with
+// ErrPrecisionLoss if the fee is not a whole number of units.
+func transferFee(amount *big.Int, rate uint32, rounding Rounding) (*big.Int, error) {
+	fee, rem := new(big.Int).QuoRem(new(big.Int).Mul(amount, big.NewInt(int64(rate))), bigFeeDenominator, new(big.Int))
+	if rem.Sign() == 0 {
+		return fee, nil
+	}
+	var roundUp bool
+	switch rounding {
+	case RoundDown:
+	case RoundUp:
+		roundUp = true
+	case RoundHalfUp:
+		roundUp = rem.Cmp(bigHalfDenominator) >= 0
+	case RoundHalfEven:
+		c := rem.Cmp(bigHalfDenominator)
+		roundUp = c > 0 || c == 0 && fee.Bit(0) == 1
+	default:
+		return nil, fmt.Errorf("%w: fee on %s at %d ppm", ErrPrecisionLoss, amount, rate)
+	}
+	if roundUp {
+		fee.Add(fee, big.NewInt(1))
+	}
+	return fee, nil
+}
+
+// afterFee returns what arrives when amount is transferred once.
+func afterFee(amount *big.Int, rate uint32, rounding Rounding) (*big.Int, error) {
+	fee, err := transferFee(amount, rate, rounding)
+	if err != nil {
+		return nil, err
+	}
+	return fee.Sub(amount, fee), nil
+}
+
+// NetAmount returns what arrives after amount is transferred hops times through a token
+// charging rate parts per million on every transfer. The fee of each hop is rounded to a
+// whole raw unit according to rounding before the next hop. hops may be at most MaxHops.
+func NetAmount(amount *uint256.Int, rate uint32, hops int, rounding Rounding) (*uint256.Int, error) {
+	if err := validateFeePPM(rate); err != nil {
+		return nil, err
+	}
+	if err := validateHops(hops); err != nil {
+		return nil, err
+	}
+	net := amount.ToBig()
+	for i := 0; i < hops && net.Sign() > 0; i++ {
+		var err error
+		if net, err = afterFee(net, rate, rounding); err != nil {
+			return nil, err
+		}
+	}
+	out, _ := uint256.FromBig(net)
+	return out, nil
+}
+
+// GrossAmount returns the smallest amount that delivers at least net after hops transfers
+// through a token charging rate parts per million, with each fee rounded as by NetAmount.
+// Because fees are whole units, some net amounts cannot be delivered exactly and are
+// overshot by the smallest possible margin, so RoundExact is rejected with
+// ErrPrecisionLoss. It returns ErrAmountOverflow if the gross amount exceeds 256 bits.
+//
+// hops may be at most MaxHops. Each hop is inverted by a binary search of at most about
+// log2(FeeDenominator) steps, so a call costs at most a few thousand fee computations.
+func GrossAmount(net *uint256.Int, rate uint32, hops int, rounding Rounding) (*uint256.Int, error) {
+	if err := validateFeePPM(rate); err != nil {
+		return nil, err
+	}
+	if err := validateHops(hops); err != nil {
+		return nil, err
+	}
+	if rounding == RoundExact {
+		return nil, fmt.Errorf("%w: gross amounts need a rounding mode", ErrPrecisionLoss)
+	}
+	if net.IsZero() {
+		return new(uint256.Int), nil
+	}
+	if rate == FeeDenominator && hops > 0 {
+		return nil, fmt.Errorf("%w: %s at a 100%% fee", ErrUnreachableAmount, net)
+	}
+
+	// Invert one hop at a time, last hop first. The amount left after a hop never falls
+	// as the amount sent grows, so the smallest input for each hop's required output
+	// composes into the smallest input overall.
+	gross := net.ToBig()
+	for i := 0; i < hops; i++ {
+		gross = invertHop(gross, rate, rounding)
+		// The amount only grows, so stop as soon as it no longer fits.
+		if gross.BitLen() > 256 {
+			return nil, fmt.Errorf("%w: gross for %s over %d hops", ErrAmountOverflow, net, hops)
+		}
+	}
+
+	out, _ := uint256.FromBig(gross)
+	return out, nil
+}
+
+// invertHop returns the smallest amount that leaves at least target after one transfer.
+// Rounding the fee down leaves the most and rounding it up the least, so the answer for
+// any rounding lies between the closed-form answers for those two, and is found by
+// binary search over that range. Whatever the size of target, the range holds at most
+// FeeDenominator/(FeeDenominator-rate)+1 amounts, so the search takes at most 21 steps.
+func invertHop(target *big.Int, rate uint32, rounding Rounding) *big.Int {
+	keep := big.NewInt(int64(FeeDenominator - rate))
+
+	// With the fee rounded down, x arrives as ceil(x*keep/D), which reaches target once
+	// x > (target-1)*D/keep. With it rounded up, x arrives as floor(x*keep/D).
+	lo := new(big.Int).Sub(target, big.NewInt(1))
+	lo.Mul(lo, bigFeeDenominator).Quo(lo, keep).Add(lo, big.NewInt(1))
+	hi := new(big.Int).Mul(target, bigFeeDenominator)
+	hi.Add(hi, keep).Sub(hi, big.NewInt(1)).Quo(hi, keep)
+
+	for lo.Cmp(hi) < 0 {
+		mid := new(big.Int).Add(lo, hi)
+		mid.Rsh(mid, 1)
+		out, _ := afterFee(mid, rate, rounding)
+		if out.Cmp(target) >= 0 {
+			hi = mid
+		} else {
+			lo = mid.Add(mid, big.NewInt(1))
+		}
+	}
+	return lo
+}
+
+// NetReceived returns what arrives after amount of token id is transferred hops times,
+// applying the token's recorded fee-on-transfer to every hop. See NetAmount.
+func (ts *TokenSystem) NetReceived(id uint64, amount *uint256.Int, hops int, rounding Rounding) (*uint256.Int, error) {
+	token, err := ts.GetTokenByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return NetAmount(amount, token.FeeOnTransferPPM, hops, rounding)
+}
+
+// GrossForNet returns the smallest amount of token id that delivers at least net after
+// hops transfers, applying the token's recorded fee-on-transfer. See GrossAmount.
+func (ts *TokenSystem) GrossForNet(id uint64, net *uint256.Int, hops int, rounding Rounding) (*uint256.Int, error) {
+	token, err := ts.GetTokenByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return GrossAmount(net, token.FeeOnTransferPPM, hops, rounding)
+}
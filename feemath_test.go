@@ -0,0 +1,194 @@
+package token
+
+import (
+	"math"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Unit Tests ---
+
+func TestFeePPMFromPercent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		percent     float64
+		expected    uint32
+		expectedErr error
+	}{
+		{name: "Zero", percent: 0, expected: 0},
+		{name: "Fraction of a percent", percent: 0.3, expected: 3_000},
+		{name: "Rounded to nearest", percent: 0.00016, expected: 2},
+		{name: "Smallest fee", percent: 0.00005, expected: 1},
+		{name: "Below 1 ppm", percent: 0.00004, expectedErr: ErrInvalidFeeRate},
+		{name: "Everything", percent: 100, expected: FeeDenominator},
+		{name: "Negative", percent: -0.1, expectedErr: ErrInvalidFeeRate},
+		{name: "Above 100%", percent: 100.01, expectedErr: ErrInvalidFeeRate},
+		{name: "NaN", percent: math.NaN(), expectedErr: ErrInvalidFeeRate},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ppm, err := FeePPMFromPercent(tc.percent)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ppm)
+		})
+	}
+}
+
+func TestNetAmount(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		amount      uint64
+		rate        uint32
+		hops        int
+		rounding    Rounding
+		expected    uint64
+		expectedErr error
+	}{
+		{name: "No fee", amount: 1000, rate: 0, hops: 3, expected: 1000},
+		{name: "No hops", amount: 1000, rate: 50_000, hops: 0, expected: 1000},
+		{name: "One hop", amount: 1000, rate: 50_000, hops: 1, expected: 950},
+		{name: "Two hops", amount: 1000, rate: 50_000, hops: 2, rounding: RoundDown, expected: 903}, // 950 - 47
+		{name: "Fee rounded down", amount: 999, rate: 10_000, hops: 1, rounding: RoundDown, expected: 990},
+		{name: "Fee rounded up", amount: 999, rate: 10_000, hops: 1, rounding: RoundUp, expected: 989},
+		{name: "Half up tie", amount: 50, rate: 10_000, hops: 1, rounding: RoundHalfUp, expected: 49},
+		{name: "Half even tie", amount: 50, rate: 10_000, hops: 1, rounding: RoundHalfEven, expected: 50},
+		{name: "Half even odd tie", amount: 150, rate: 10_000, hops: 1, rounding: RoundHalfEven, expected: 148},
+		{name: "Exact fee", amount: 1000, rate: 10_000, hops: 1, rounding: RoundExact, expected: 990},
+		{name: "Inexact fee", amount: 999, rate: 10_000, hops: 1, rounding: RoundExact, expectedErr: ErrPrecisionLoss},
+		{name: "Full fee", amount: 1000, rate: FeeDenominator, hops: 1, expected: 0},
+		{name: "Rate above 100%", amount: 1000, rate: FeeDenominator + 1, hops: 1, expectedErr: ErrInvalidFeeRate},
+		{name: "Negative hops", amount: 1000, rate: 0, hops: -1, expectedErr: ErrInvalidHops},
+		{name: "Most hops", amount: 1000, rate: 0, hops: MaxHops, expected: 1000},
+		{name: "Too many hops", amount: 1000, rate: 0, hops: MaxHops + 1, expectedErr: ErrInvalidHops},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			net, err := NetAmount(uint256.NewInt(tc.amount), tc.rate, tc.hops, tc.rounding)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, net.Uint64())
+		})
+	}
+}
+
+func TestNetAmount_Uint256Max(t *testing.T) {
+	t.Parallel()
+	max := new(uint256.Int).SetAllOne()
+	net, err := NetAmount(max, 30_000, 2, RoundDown)
+	require.NoError(t, err)
+
+	// Solidity's amount - amount * rate / 1e6, hop by hop, with 512-bit intermediates.
+	expected := new(uint256.Int).Set(max)
+	for i := 0; i < 2; i++ {
+		fee, _ := new(uint256.Int).MulDivOverflow(expected, uint256.NewInt(30_000), uint256.NewInt(FeeDenominator))
+		expected.Sub(expected, fee)
+	}
+	assert.Equal(t, expected, net)
+}
+
+func TestGrossAmount_IsSmallestInverse(t *testing.T) {
+	t.Parallel()
+	for _, rate := range []uint32{0, 1, 3_000, 10_000, 333_333, 500_000, 999_999} {
+		for _, rounding := range []Rounding{RoundDown, RoundUp, RoundHalfUp, RoundHalfEven} {
+			for hops := 1; hops <= 3; hops++ {
+				for target := uint64(1); target <= 300; target += 7 {
+					gross, err := GrossAmount(uint256.NewInt(target), rate, hops, rounding)
+					require.NoError(t, err)
+					net, err := NetAmount(gross, rate, hops, rounding)
+					require.NoError(t, err)
+					require.GreaterOrEqual(t, net.Uint64(), target, "rate %d, rounding %d, hops %d", rate, rounding, hops)
+
+					less, err := NetAmount(new(uint256.Int).SubUint64(gross, 1), rate, hops, rounding)
+					require.NoError(t, err)
+					require.Less(t, less.Uint64(), target, "rate %d, rounding %d, hops %d: %s is not the smallest", rate, rounding, hops, gross)
+				}
+			}
+		}
+	}
+}
+
+func TestGrossAmount(t *testing.T) {
+	t.Parallel()
+
+	// 999 loses floor(49.95) = 49 and delivers 950 just as 1000 does.
+	gross, err := GrossAmount(uint256.NewInt(950), 50_000, 1, RoundDown)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(999), gross.Uint64())
+	gross, err = GrossAmount(uint256.NewInt(950), 50_000, 1, RoundUp)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), gross.Uint64())
+
+	gross, err = GrossAmount(uint256.NewInt(0), FeeDenominator, 1, RoundDown)
+	require.NoError(t, err)
+	assert.True(t, gross.IsZero())
+
+	_, err = GrossAmount(uint256.NewInt(1), FeeDenominator, 1, RoundDown)
+	assert.ErrorIs(t, err, ErrUnreachableAmount)
+
+	_, err = GrossAmount(new(uint256.Int).SetAllOne(), 10_000, 1, RoundDown)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	_, err = GrossAmount(uint256.NewInt(990), 10_000, 1, RoundExact)
+	assert.ErrorIs(t, err, ErrPrecisionLoss)
+
+	// A fee just short of 100% multiplies the amount by a million per hop, so the
+	// search ends at the first hop that overflows rather than running every hop.
+	_, err = GrossAmount(uint256.NewInt(1), FeeDenominator-1, MaxHops, RoundUp)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+	_, err = GrossAmount(uint256.NewInt(1), 0, MaxHops+1, RoundDown)
+	assert.ErrorIs(t, err, ErrInvalidHops)
+}
+
+func TestTokenSystem_FeeAdjustedAmounts(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Taxed", "TAX", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(id, 25_000, 0))
+
+	net, err := ts.NetReceived(id, uint256.NewInt(1_000_000), 2, RoundDown)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(950_625), net.Uint64())
+
+	gross, err := ts.GrossForNet(id, net, 2, RoundUp)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1_000_000), gross.Uint64())
+	gross, err = ts.GrossForNet(id, net, 2, RoundDown)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(999_998), gross.Uint64(), "rounding fees down lets slightly less deliver the same")
+
+	_, err = ts.GrossForNet(99, uint256.NewInt(1), 1, RoundDown)
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+// --- Benchmarking ---
+
+func BenchmarkFeeAdjustedAmounts(b *testing.B) {
+	amount := uint256.MustFromDecimal("123456789012345678901234567890")
+	b.Run("NetAmount", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = NetAmount(amount, 30_000, 3, RoundDown)
+		}
+	})
+	b.Run("GrossAmount", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = GrossAmount(amount, 30_000, 3, RoundDown)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownFlag is returned by ParseRiskFlags for a name that is not a defined flag.
+var ErrUnknownFlag = errors.New("unknown risk flag")
+
+// RiskFlags is a set of token behaviours that a router must take into account besides the
+// transfer fee. The bit values are stored in snapshots and the write-ahead log and must
+// never be renumbered.
+type RiskFlags uint32
+
+const (
+	// FlagRebasing marks a token whose balances change without transfers.
+	FlagRebasing RiskFlags = 1 << iota
+	// FlagBlacklistable marks a token whose issuer can block transfers from or to an address.
+	FlagBlacklistable
+	// FlagPausable marks a token whose transfers can be paused.
+	FlagPausable
+	// FlagUpgradeable marks a token behind an upgradeable proxy.
+	FlagUpgradeable
+	// FlagHoneypot marks a known honeypot: a token that can be bought but not sold.
+	FlagHoneypot
+)
+
+// flagNames lists every defined flag in bit order, for String and ParseRiskFlags.
+var flagNames = []struct {
+	flag RiskFlags
+	name string
+}{
+	{FlagRebasing, "rebasing"},
+	{FlagBlacklistable, "blacklistable"},
+	{FlagPausable, "pausable"},
+	{FlagUpgradeable, "upgradeable"},
+	{FlagHoneypot, "honeypot"},
+}
+
+// Has reports whether every flag in flag is set.
+func (f RiskFlags) Has(flag RiskFlags) bool {
+	return f&flag == flag
+}
+
+// String lists the set flags separated by "|", such as "rebasing|pausable". Undefined
+// bits are printed in hexadecimal, and no flags at all as "none".
+func (f RiskFlags) String() string {
+	if f == 0 {
+		return "none"
+	}
+	var names []string
+	for _, n := range flagNames {
+		if f.Has(n.flag) {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseRiskFlags parses flag names separated by "|" or ",", such as "rebasing|pausable",
+// as printed by String. Names are case-insensitive, and "none" or an empty string is no
+// flags.
+func ParseRiskFlags(s string) (RiskFlags, error) {
+	var flags RiskFlags
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		name = strings.TrimSpace(name)
+		if strings.EqualFold(name, "none") {
+			continue
+		}
+		flag, ok := flagByName(name)
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrUnknownFlag, name)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// flagByName looks up a defined flag by name, ignoring case.
+func flagByName(name string) (RiskFlags, bool) {
+	for _, n := range flagNames {
+		if strings.EqualFold(n.name, name) {
+			return n.flag, true
+		}
+	}
+	return 0, false
+}
+
+// FlagFilter selects tokens by their RiskFlags. The zero value matches every token.
+type FlagFilter struct {
+	// Require lists flags a token must all have.
+	Require RiskFlags
+	// Exclude lists flags a token must have none of.
+	Exclude RiskFlags
+}
+
+// Matches reports whether a token with the given flags passes the filter.
+func (f FlagFilter) Matches(flags RiskFlags) bool {
+	return flags.Has(f.Require) && flags&f.Exclude == 0
+}
+
+// setTokenFlags replaces the flags of a token.
+func setTokenFlags(id uint64, flags RiskFlags, registry *TokenRegistry) error {
+	index, ok := registry.idToIndex[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	registry.flags[index] = flags
+	return nil
+}
+
+// viewFiltered returns views of the tokens that pass filter. It checks the flags column
+// first, so rejected tokens are never copied into a view.
+func viewFiltered(filter FlagFilter, registry *TokenRegistry) []TokenView {
+	var views []TokenView
+	for i, flags := range registry.flags {
+		if filter.Matches(flags) {
+			views = append(views, viewAt(i, registry))
+		}
+	}
+	return views
+}
+
+// flagsMutation returns the mutation that sets and then clears flags on a token.
+func flagsMutation(id uint64, set, clear RiskFlags, registry *TokenRegistry) (mutation, error) {
+	index, ok := registry.idToIndex[id]
+	if !ok {
+		return mutation{}, ErrTokenNotFound
+	}
+	return mutation{kind: mutationFlags, id: id, flags: (registry.flags[index] | set) &^ clear}, nil
+}
+
+// SetFlags adds flags to a token, leaving its other flags as they are.
+// It acquires a full write lock.
+func (ts *TokenSystem) SetFlags(id uint64, flags RiskFlags) error {
+	return ts.changeFlags(id, flags, 0)
+}
+
+// ClearFlags removes flags from a token, leaving its other flags as they are.
+// It acquires a full write lock.
+func (ts *TokenSystem) ClearFlags(id uint64, flags RiskFlags) error {
+	return ts.changeFlags(id, 0, flags)
+}
+
+// changeFlags sets and then clears flags on a token under the write lock.
+func (ts *TokenSystem) changeFlags(id uint64, set, clear RiskFlags) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	m, err := flagsMutation(id, set, clear, ts.registry)
+	if err != nil {
+		return err
+	}
+	return ts.commit(m)
+}
+
+// ViewFiltered is like View but returns only the tokens that pass filter, for example
+// every token without FlagHoneypot or FlagPausable:
+//
+//	ts.ViewFiltered(FlagFilter{Exclude: FlagHoneypot | FlagPausable})
+//
+// Tokens that fail the filter cost only a check of their flags.
+func (ts *TokenSystem) ViewFiltered(filter FlagFilter) []TokenView {
+	if registry := ts.published.Load(); registry != nil {
+		return viewFiltered(filter, registry)
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return viewFiltered(filter, ts.registry)
+}
+
+// SetFlags adds flags to a token within the transaction.
+func (tx *Tx) SetFlags(id uint64, flags RiskFlags) error {
+	return tx.changeFlags(id, flags, 0)
+}
+
+// ClearFlags removes flags from a token within the transaction.
+func (tx *Tx) ClearFlags(id uint64, flags RiskFlags) error {
+	return tx.changeFlags(id, 0, flags)
+}
+
+// changeFlags sets and then clears flags on a token within the transaction.
+func (tx *Tx) changeFlags(id uint64, set, clear RiskFlags) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	m, err := flagsMutation(id, set, clear, tx.registry)
+	if err != nil {
+		return err
+	}
+	return tx.apply(m)
+}
@@ -0,0 +1,187 @@
+package token
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// newFlagsTestSystem registers four tokens carrying different flags.
+func newFlagsTestSystem(t *testing.T, opts ...Option) *TokenSystem {
+	ts := NewTokenSystem(opts...)
+	for i, flags := range []RiskFlags{0, FlagPausable, FlagPausable | FlagUpgradeable, FlagHoneypot} {
+		id, err := ts.AddToken(addr(byte(i+1)), "Token", "TKN", 18)
+		require.NoError(t, err)
+		if flags != 0 {
+			require.NoError(t, ts.SetFlags(id, flags))
+		}
+	}
+	return ts
+}
+
+// --- Unit Tests ---
+
+func TestRiskFlags_String(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "none", RiskFlags(0).String())
+	assert.Equal(t, "rebasing", FlagRebasing.String())
+	assert.Equal(t, "pausable|honeypot", (FlagHoneypot | FlagPausable).String())
+	assert.Equal(t, "blacklistable|0x100", (FlagBlacklistable | 1<<8).String())
+}
+
+func TestParseRiskFlags(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []RiskFlags{0, FlagRebasing, FlagHoneypot | FlagPausable, FlagBlacklistable | FlagUpgradeable} {
+		parsed, err := ParseRiskFlags(f.String())
+		require.NoError(t, err)
+		assert.Equal(t, f, parsed, "round trip of %s", f)
+	}
+	parsed, err := ParseRiskFlags(" Pausable, HONEYPOT ")
+	require.NoError(t, err)
+	assert.Equal(t, FlagPausable|FlagHoneypot, parsed)
+	parsed, err = ParseRiskFlags("")
+	require.NoError(t, err)
+	assert.Zero(t, parsed)
+
+	_, err = ParseRiskFlags("pausable|mintable")
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+}
+
+func TestFlagFilter_Matches(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		filter   FlagFilter
+		flags    RiskFlags
+		expected bool
+	}{
+		{name: "Zero filter", flags: FlagHoneypot, expected: true},
+		{name: "Excluded", filter: FlagFilter{Exclude: FlagHoneypot | FlagPausable}, flags: FlagPausable | FlagRebasing},
+		{name: "Not excluded", filter: FlagFilter{Exclude: FlagHoneypot | FlagPausable}, flags: FlagRebasing, expected: true},
+		{name: "Required", filter: FlagFilter{Require: FlagPausable | FlagUpgradeable}, flags: FlagPausable | FlagUpgradeable, expected: true},
+		{name: "Partly required", filter: FlagFilter{Require: FlagPausable | FlagUpgradeable}, flags: FlagPausable},
+		{name: "Required and excluded", filter: FlagFilter{Require: FlagPausable, Exclude: FlagHoneypot}, flags: FlagPausable | FlagHoneypot},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, tc.filter.Matches(tc.flags), tc.name)
+	}
+}
+
+func TestTokenSystem_Flags(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	sub := ts.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+
+	require.NoError(t, ts.SetFlags(id, FlagPausable))
+	require.NoError(t, ts.SetFlags(id, FlagBlacklistable|FlagPausable))
+	view, err := ts.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, FlagPausable|FlagBlacklistable, view.Flags)
+
+	require.NoError(t, ts.ClearFlags(id, FlagPausable|FlagHoneypot))
+	view, err = ts.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, FlagBlacklistable, view.Flags)
+
+	ev := <-sub.C
+	assert.Equal(t, TokenUpdated, ev.Kind)
+	assert.Equal(t, RiskFlags(0), ev.Previous.Flags)
+	assert.Equal(t, FlagPausable, ev.Token.Flags)
+
+	assert.ErrorIs(t, ts.SetFlags(99, FlagHoneypot), ErrTokenNotFound)
+	assert.ErrorIs(t, ts.ClearFlags(99, FlagHoneypot), ErrTokenNotFound)
+
+	// Flags move with the token when a delete swaps it into a new slot.
+	other, err := ts.AddToken(addr(2), "Token B", "TKB", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.SetFlags(other, FlagRebasing))
+	require.NoError(t, ts.DeleteToken(id))
+	view, err = ts.GetTokenByID(other)
+	require.NoError(t, err)
+	assert.Equal(t, FlagRebasing, view.Flags)
+}
+
+func TestTokenSystem_ViewFiltered(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Locked"},
+		{name: "LockFree", opts: []Option{WithLockFreeReads()}},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			ts := newFlagsTestSystem(t, mode.opts...)
+			assert.ElementsMatch(t, []uint64{1, 2, 3, 4}, ids(ts.ViewFiltered(FlagFilter{})))
+			assert.ElementsMatch(t, []uint64{1}, ids(ts.ViewFiltered(FlagFilter{Exclude: FlagHoneypot | FlagPausable})))
+			assert.ElementsMatch(t, []uint64{2, 3}, ids(ts.ViewFiltered(FlagFilter{Require: FlagPausable})))
+			assert.ElementsMatch(t, []uint64{2}, ids(ts.ViewFiltered(FlagFilter{Require: FlagPausable, Exclude: FlagUpgradeable})))
+			assert.Empty(t, ts.ViewFiltered(FlagFilter{Require: FlagRebasing}))
+		})
+	}
+}
+
+func TestTx_Flags(t *testing.T) {
+	t.Parallel()
+	ts := newFlagsTestSystem(t)
+	errAbort := errors.New("abort")
+
+	err := ts.Update(func(tx *Tx) error {
+		require.NoError(t, tx.SetFlags(1, FlagHoneypot))
+		require.NoError(t, tx.ClearFlags(2, FlagPausable))
+		view, err := tx.GetTokenByID(1)
+		require.NoError(t, err)
+		assert.Equal(t, FlagHoneypot, view.Flags, "the transaction sees its own changes")
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+	assert.ElementsMatch(t, []uint64{1}, ids(ts.ViewFiltered(FlagFilter{Exclude: FlagHoneypot | FlagPausable})))
+
+	var closed *Tx
+	require.NoError(t, ts.Update(func(tx *Tx) error {
+		closed = tx
+		return tx.SetFlags(1, FlagHoneypot)
+	}))
+	assert.Empty(t, ts.ViewFiltered(FlagFilter{Exclude: FlagHoneypot | FlagPausable}))
+	assert.ErrorIs(t, closed.SetFlags(1, FlagRebasing), ErrTxClosed)
+}
+
+// --- Benchmarking ---
+
+// BenchmarkViewFiltered compares a filter that keeps few tokens with a full View.
+func BenchmarkViewFiltered(b *testing.B) {
+	ts := NewTokenSystem()
+	for i := 1; i <= 10_000; i++ {
+		a := common.Address{}
+		a[0] = byte(i / 256)
+		a[1] = byte(i % 256)
+		id, _ := ts.AddToken(a, "bench", "B", 18)
+		if i%100 != 0 {
+			_ = ts.SetFlags(id, FlagHoneypot)
+		}
+	}
+	filter := FlagFilter{Exclude: FlagHoneypot}
+
+	b.Run("ViewFiltered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = ts.ViewFiltered(filter)
+		}
+	})
+	b.Run("View", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = ts.View()
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package token
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// benchAddr derives a distinct address from an integer.
+func benchAddr(i int) common.Address {
+	var a common.Address
+	a[0] = byte(i >> 16)
+	a[1] = byte(i >> 8)
+	a[2] = byte(i)
+	a[19] = 0xbe
+	return a
+}
+
+// newBenchSystem creates a TokenSystem holding n tokens.
+func newBenchSystem(b *testing.B, n int, opts ...Option) *TokenSystem {
+	ts := NewTokenSystem(opts...)
+	for i := 0; i < n; i++ {
+		if _, err := ts.AddToken(benchAddr(i), "bench", "B", 18); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return ts
+}
+
+// --- Unit Tests ---
+
+func TestCloneRegistry(t *testing.T) {
+	t.Parallel()
+	registry, ids := newTestRegistry(t)
+	require.NoError(t, deleteToken(ids[0], registry))
+	id2 := ids[1]
+
+	clone := cloneRegistry(registry)
+	assert.Equal(t, registry, clone)
+
+	// Changes to the clone must not be visible through the original.
+	require.NoError(t, updateToken(id2, 30_000, 50000, clone))
+	_, err := addToken(addr(5), "Token E", "TKE", 8, clone)
+	require.NoError(t, err)
+	require.NoError(t, deleteToken(id2, clone))
+
+	view, err := getTokenByID(id2, registry)
+	require.NoError(t, err)
+	assert.Zero(t, view.FeeOnTransferPPM)
+	assert.Len(t, viewRegistry(registry), 3)
+	assert.NotContains(t, registry.tombstones, id2)
+	assert.Equal(t, ids[3]+1, registry.nextID)
+}
+
+func TestTokenSystem_LockFreeReads(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem(WithLockFreeReads())
+	before := ts.published.Load()
+
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(id, 15_000, 40000))
+
+	assert.Empty(t, viewRegistry(before), "a published registry is never modified")
+	assert.Same(t, ts.registry, ts.published.Load())
+
+	view, err := ts.GetTokenByAddress(addr(1))
+	require.NoError(t, err)
+	assert.Equal(t, TokenView{ID: id, Address: addr(1), Name: "Token A", Symbol: "TKA", Decimals: 18, FeeOnTransferPPM: 15_000, GasForTransfer: 40000}, view)
+	assert.Equal(t, []TokenView{view}, ts.View())
+
+	require.NoError(t, ts.DeleteToken(id))
+	_, err = ts.GetTokenByID(id)
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	assert.ErrorIs(t, ts.UpdateTokenPPM(id, 10_000, 1), ErrTokenNotFound)
+}
+
+func TestTokenSystem_LockFreeReadsWithWAL(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	ts, err := OpenTokenSystem(opts, WithLockFreeReads())
+	require.NoError(t, err)
+
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(id, 20_000, 60000))
+	require.NoError(t, ts.Compact())
+	_, err = ts.AddToken(addr(2), "Token B", "TKB", 6)
+	require.NoError(t, err)
+	expected := ts.View()
+	require.NoError(t, ts.Close())
+
+	recovered, err := OpenTokenSystem(opts, WithLockFreeReads())
+	require.NoError(t, err)
+	defer recovered.Close()
+	assert.Equal(t, expected, recovered.View())
+}
+
+func TestTokenSystem_LockFreeConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem(WithLockFreeReads())
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				a := benchAddr(w*1000 + i)
+				if _, err := ts.AddToken(a, "T", "T", 18); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := ts.UpdateTokenPPM(id, uint32(i), uint64(i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				view, err := ts.GetTokenByID(id)
+				if err != nil || view.Address != addr(1) {
+					t.Errorf("read %d: unexpected view %+v (err %v)", i, view, err)
+					return
+				}
+				_ = ts.View()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, ts.View(), 401)
+}
+
+// --- Benchmarking ---
+
+// BenchmarkTokenSystem_MixedModes runs the BenchmarkTokenSystem_Mixed workload against a
+// populated registry in both read modes. Writes are UpdateTokenPPM calls, which is where
+// readers contend with writers in practice.
+func BenchmarkTokenSystem_MixedModes(b *testing.B) {
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Locked"},
+		{name: "LockFree", opts: []Option{WithLockFreeReads()}},
+	}
+
+	for _, size := range []int{100, 10_000} {
+		for _, writePercent := range []int{1, 10} {
+			for _, mode := range modes {
+				name := fmt.Sprintf("%s/tokens=%d/writes=%d%%", mode.name, size, writePercent)
+				b.Run(name, func(b *testing.B) {
+					ts := newBenchSystem(b, size, mode.opts...)
+					b.ResetTimer()
+
+					b.RunParallel(func(pb *testing.PB) {
+						r := rand.New(rand.NewSource(time.Now().UnixNano()))
+						for pb.Next() {
+							id := uint64(r.Intn(size) + 1)
+							if r.Intn(100) < writePercent {
+								_ = ts.UpdateTokenPPM(id, 5_000, 50000)
+							} else {
+								_, _ = ts.GetTokenByID(id)
+							}
+						}
+					})
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkTokenSystem_ReadsDuringWrites measures read latency while a single writer
+// updates tokens continuously, isolating the cost readers pay for writer contention.
+func BenchmarkTokenSystem_ReadsDuringWrites(b *testing.B) {
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Locked"},
+		{name: "LockFree", opts: []Option{WithLockFreeReads()}},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			ts := newBenchSystem(b, 1000, mode.opts...)
+
+			// A dedicated writer updates continuously while the benchmark measures reads.
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						return
+					default:
+						_ = ts.UpdateTokenPPM(uint64(i%1000+1), 5_000, uint64(i))
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var id uint64
+				for pb.Next() {
+					id = id%1000 + 1
+					_, _ = ts.GetTokenByID(id)
+				}
+			})
+			b.StopTimer()
+			close(done)
+			wg.Wait()
+		})
+	}
+}
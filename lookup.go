@@ -0,0 +1,185 @@
+package token
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// SearchMatch selects how SearchTokens compares the query with symbols and names.
+type SearchMatch uint8
+
+const (
+	// MatchPrefix matches symbols and names that start with the query.
+	MatchPrefix SearchMatch = iota
+	// MatchSubstring matches symbols and names that contain the query anywhere.
+	MatchSubstring
+)
+
+// SearchOptions configures SearchTokens.
+type SearchOptions struct {
+	Match SearchMatch
+	// Limit caps the number of results. Zero or negative means no limit.
+	Limit int
+}
+
+// Search ranks, from best to worst. Results with the same rank are ordered by ID.
+const (
+	rankExactSymbol = iota
+	rankSymbolPrefix
+	rankNamePrefix
+	rankSymbolSubstring
+	rankNameSubstring
+	rankNoMatch
+)
+
+// symbolKey is the key of the symbol index. Symbols that differ only in case share a key.
+func symbolKey(symbol string) string {
+	return strings.ToLower(symbol)
+}
+
+// indexSymbol adds id to the symbol index.
+func indexSymbol(id uint64, symbol string, registry *TokenRegistry) {
+	addToIndex(registry.symbolToIDs, symbolKey(symbol), id)
+}
+
+// unindexSymbol removes id from the symbol index.
+func unindexSymbol(id uint64, symbol string, registry *TokenRegistry) {
+	removeFromIndex(registry.symbolToIDs, symbolKey(symbol), id)
+}
+
+// addToIndex adds id under key. Like removeFromIndex, it never writes to an existing ID
+// slice, because cloned registries share them.
+func addToIndex(index map[string][]uint64, key string, id uint64) {
+	index[key] = append(slices.Clip(index[key]), id)
+}
+
+// removeFromIndex removes id from under key, deleting the key once it has no IDs left.
+func removeFromIndex(index map[string][]uint64, key string, id uint64) {
+	ids := index[key]
+	if len(ids) <= 1 {
+		delete(index, key)
+		return
+	}
+	index[key] = slices.DeleteFunc(slices.Clone(ids), func(other uint64) bool { return other == id })
+}
+
+// getTokensBySymbol returns every token whose symbol matches, ordered by ID. With fold,
+// symbols are compared case-insensitively.
+func getTokensBySymbol(symbol string, fold bool, registry *TokenRegistry) []TokenView {
+	var views []TokenView
+	for _, id := range registry.symbolToIDs[symbolKey(symbol)] {
+		index := registry.idToIndex[id]
+		if !fold && registry.symbol[index] != symbol {
+			continue
+		}
+		view, _ := getTokenByID(id, registry)
+		views = append(views, view)
+	}
+	slices.SortFunc(views, func(a, b TokenView) int { return cmp.Compare(a.ID, b.ID) })
+	return views
+}
+
+// searchTokens returns tokens whose symbol or name matches query case-insensitively, best
+// matches first: an exact symbol, then symbol and name prefixes, then symbol and name
+// substrings when opts.Match is MatchSubstring.
+func searchTokens(query string, opts SearchOptions, registry *TokenRegistry) []TokenView {
+	if query == "" {
+		return nil
+	}
+	type match struct {
+		rank  int
+		index int
+	}
+	var matches []match
+	for i := range registry.id {
+		if rank := searchRank(registry.symbol[i], registry.name[i], query, opts.Match); rank != rankNoMatch {
+			matches = append(matches, match{rank: rank, index: i})
+		}
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.rank != b.rank {
+			return cmp.Compare(a.rank, b.rank)
+		}
+		return cmp.Compare(registry.id[a.index], registry.id[b.index])
+	})
+	if opts.Limit > 0 && len(matches) > opts.Limit {
+		matches = matches[:opts.Limit]
+	}
+
+	views := make([]TokenView, len(matches))
+	for i, m := range matches {
+		views[i], _ = getTokenByID(registry.id[m.index], registry)
+	}
+	return views
+}
+
+// searchRank ranks how well a token's symbol and name match the query.
+func searchRank(symbol, name, query string, mode SearchMatch) int {
+	switch {
+	case strings.EqualFold(symbol, query):
+		return rankExactSymbol
+	case hasPrefixFold(symbol, query):
+		return rankSymbolPrefix
+	case hasPrefixFold(name, query):
+		return rankNamePrefix
+	case mode != MatchSubstring:
+		return rankNoMatch
+	case containsFold(symbol, query):
+		return rankSymbolSubstring
+	case containsFold(name, query):
+		return rankNameSubstring
+	default:
+		return rankNoMatch
+	}
+}
+
+// hasPrefixFold is a case-insensitive strings.HasPrefix that does not allocate.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// containsFold is a case-insensitive strings.Contains that does not allocate.
+func containsFold(s, substr string) bool {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTokensBySymbol returns every token with exactly the given symbol, ordered by ID.
+// Symbols are not unique, so there may be several.
+func (ts *TokenSystem) GetTokensBySymbol(symbol string) []TokenView {
+	if registry := ts.published.Load(); registry != nil {
+		return getTokensBySymbol(symbol, false, registry)
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return getTokensBySymbol(symbol, false, ts.registry)
+}
+
+// GetTokensBySymbolFold is like GetTokensBySymbol but compares symbols case-insensitively,
+// so "usdc" matches "USDC" and "UsDC".
+func (ts *TokenSystem) GetTokensBySymbolFold(symbol string) []TokenView {
+	if registry := ts.published.Load(); registry != nil {
+		return getTokensBySymbol(symbol, true, registry)
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return getTokensBySymbol(symbol, true, ts.registry)
+}
+
+// SearchTokens finds tokens whose symbol or name starts with, or with MatchSubstring
+// contains, the query, ignoring case. Exact symbol matches come first, then symbol
+// matches, then name matches; ties are ordered by ID. An empty query matches nothing.
+// The search scans every token.
+func (ts *TokenSystem) SearchTokens(query string, opts SearchOptions) []TokenView {
+	if registry := ts.published.Load(); registry != nil {
+		return searchTokens(query, opts, registry)
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return searchTokens(query, opts, ts.registry)
+}
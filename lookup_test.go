@@ -0,0 +1,173 @@
+package token
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// newSymbolTestSystem registers tokens with overlapping symbols and names.
+func newSymbolTestSystem(t *testing.T, opts ...Option) *TokenSystem {
+	ts := NewTokenSystem(opts...)
+	for i, tok := range []struct{ name, symbol string }{
+		{"USD Coin", "USDC"},
+		{"Bridged USD Coin", "USDC.e"},
+		{"Fake USD Coin", "usdc"},
+		{"Tether USD", "USDT"},
+		{"Wrapped Ether", "WETH"},
+		{"USD Coin (Wormhole)", "USDC"},
+	} {
+		_, err := ts.AddToken(addr(byte(i+1)), tok.name, tok.symbol, 6)
+		require.NoError(t, err)
+	}
+	return ts
+}
+
+// ids extracts the IDs of views.
+func ids(views []TokenView) []uint64 {
+	out := make([]uint64, len(views))
+	for i, v := range views {
+		out[i] = v.ID
+	}
+	return out
+}
+
+// requireSymbolIndexConsistent checks the symbol index against a fresh rebuild.
+func requireSymbolIndexConsistent(t *testing.T, registry *TokenRegistry) {
+	rebuilt, err := NewTokenRegistryFromViews(viewRegistry(registry))
+	require.NoError(t, err)
+	require.Equal(t, len(rebuilt.symbolToIDs), len(registry.symbolToIDs))
+	for key, expected := range rebuilt.symbolToIDs {
+		require.ElementsMatch(t, expected, registry.symbolToIDs[key], "symbol key %q", key)
+	}
+}
+
+// --- Unit Tests ---
+
+func TestTokenSystem_GetTokensBySymbol(t *testing.T) {
+	t.Parallel()
+	ts := newSymbolTestSystem(t)
+
+	assert.Equal(t, []uint64{1, 6}, ids(ts.GetTokensBySymbol("USDC")))
+	assert.Equal(t, []uint64{3}, ids(ts.GetTokensBySymbol("usdc")))
+	assert.Empty(t, ts.GetTokensBySymbol("Usdc"))
+	assert.Empty(t, ts.GetTokensBySymbol("DAI"))
+
+	assert.Equal(t, []uint64{1, 3, 6}, ids(ts.GetTokensBySymbolFold("Usdc")))
+	assert.Equal(t, []uint64{5}, ids(ts.GetTokensBySymbolFold("weth")))
+}
+
+func TestSymbolIndex_SwapAndPop(t *testing.T) {
+	t.Parallel()
+	ts := newSymbolTestSystem(t)
+
+	// Deleting the first token moves the last one, which shares its symbol, into its slot.
+	require.NoError(t, ts.DeleteToken(1))
+	requireSymbolIndexConsistent(t, ts.registry)
+	views := ts.GetTokensBySymbol("USDC")
+	require.Len(t, views, 1)
+	assert.Equal(t, "USD Coin (Wormhole)", views[0].Name)
+
+	require.NoError(t, ts.DeleteToken(6))
+	require.NoError(t, ts.DeleteToken(3))
+	requireSymbolIndexConsistent(t, ts.registry)
+	assert.Empty(t, ts.GetTokensBySymbolFold("USDC"))
+	assert.NotContains(t, ts.registry.symbolToIDs, "usdc", "empty entries are removed")
+
+	_, err := ts.AddToken(addr(9), "USD Coin", "USDC", 6)
+	require.NoError(t, err)
+	requireSymbolIndexConsistent(t, ts.registry)
+	assert.Len(t, ts.GetTokensBySymbol("USDC"), 1)
+}
+
+func TestSymbolIndex_FromViews(t *testing.T) {
+	t.Parallel()
+	original := newSymbolTestSystem(t)
+	require.NoError(t, original.DeleteToken(2))
+
+	restored, err := NewTokenSystemFromViews(original.View())
+	require.NoError(t, err)
+	assert.Equal(t, original.GetTokensBySymbolFold("USDC"), restored.GetTokensBySymbolFold("USDC"))
+	assert.Empty(t, restored.GetTokensBySymbol("USDC.e"))
+	requireSymbolIndexConsistent(t, restored.registry)
+}
+
+func TestSymbolIndex_CloneIsolation(t *testing.T) {
+	t.Parallel()
+	ts := newSymbolTestSystem(t, WithLockFreeReads())
+	before := ts.published.Load()
+
+	require.NoError(t, ts.Update(func(tx *Tx) error {
+		if err := tx.DeleteToken(1); err != nil {
+			return err
+		}
+		_, err := tx.AddToken(addr(20), "USD Coin v2", "USDC", 6)
+		return err
+	}))
+
+	assert.Equal(t, []uint64{1, 6}, ids(getTokensBySymbol("USDC", false, before)), "a published registry is never modified")
+	assert.Equal(t, []uint64{6, 7}, ids(ts.GetTokensBySymbol("USDC")))
+	requireSymbolIndexConsistent(t, before)
+	requireSymbolIndexConsistent(t, ts.registry)
+}
+
+func TestTokenSystem_SearchTokens(t *testing.T) {
+	t.Parallel()
+	ts := newSymbolTestSystem(t)
+
+	testCases := []struct {
+		name     string
+		query    string
+		opts     SearchOptions
+		expected []uint64
+	}{
+		{name: "Exact symbols first", query: "usdc", expected: []uint64{1, 3, 6, 2}},
+		{name: "Name prefix", query: "wrapped", expected: []uint64{5}},
+		{name: "Symbol before name prefix", query: "US", expected: []uint64{1, 2, 3, 4, 6}},
+		{name: "Limit", query: "usd", opts: SearchOptions{Limit: 2}, expected: []uint64{1, 2}},
+		{name: "Prefix ignores substrings", query: "coin", expected: []uint64{}},
+		{name: "Substring", query: "coin", opts: SearchOptions{Match: MatchSubstring}, expected: []uint64{1, 2, 3, 6}},
+		{name: "Symbol substring before name substring", query: "eth", opts: SearchOptions{Match: MatchSubstring}, expected: []uint64{5, 4}},
+		{name: "Empty query", query: "", expected: []uint64{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ids(ts.SearchTokens(tc.query, tc.opts)))
+		})
+	}
+}
+
+// --- Benchmarking ---
+
+func BenchmarkTokenSystem_Lookup(b *testing.B) {
+	ts := NewTokenSystem()
+	for i := 0; i < 10_000; i++ {
+		_, _ = ts.AddToken(benchAddr(i), fmt.Sprintf("Token %d", i), fmt.Sprintf("TK%d", i%2000), 18)
+	}
+
+	b.Run("BySymbol", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = ts.GetTokensBySymbol("TK42")
+		}
+	})
+	b.Run("BySymbolFold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = ts.GetTokensBySymbolFold("tk42")
+		}
+	})
+	b.Run("SearchPrefix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = ts.SearchTokens("tk19", SearchOptions{Limit: 20})
+		}
+	})
+	b.Run("SearchSubstring", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = ts.SearchTokens("99", SearchOptions{Match: MatchSubstring, Limit: 20})
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Multicall3Address is the canonical Multicall3 deployment, available at the same address
+// on Ethereum and most EVM chains.
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// DefaultMulticallChunkSize is the number of token addresses packed into one aggregate3
+// request by NewMulticallResolver. Each address costs three calls.
+const DefaultMulticallChunkSize = 100
+
+const multicall3ABIJSON = `[{
+	"name": "aggregate3",
+	"type": "function",
+	"stateMutability": "payable",
+	"inputs": [{"name": "calls", "type": "tuple[]", "components": [
+		{"name": "target", "type": "address"},
+		{"name": "allowFailure", "type": "bool"},
+		{"name": "callData", "type": "bytes"}
+	]}],
+	"outputs": [{"name": "returnData", "type": "tuple[]", "components": [
+		{"name": "success", "type": "bool"},
+		{"name": "returnData", "type": "bytes"}
+	]}]
+}]`
+
+var multicall3ABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(multicall3ABIJSON))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// multicall3Call and multicall3Result mirror Multicall3's Call3 and Result structs.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// BatchMetadataResolver resolves metadata for many addresses at once. Addresses that
+// cannot be resolved are reported in the failed map rather than failing the whole batch.
+type BatchMetadataResolver interface {
+	ResolveMetadataBatch(ctx context.Context, addrs []common.Address) (resolved []TokenMetadata, failed map[common.Address]error)
+}
+
+// BatchResult reports the outcome of a bulk add, keyed by token address.
+type BatchResult struct {
+	Added  map[common.Address]uint64
+	Failed map[common.Address]error
+}
+
+// MulticallResolver resolves metadata by packing name(), symbol() and decimals() calls for
+// many tokens into Multicall3 aggregate3 requests. Return data is decoded exactly as by
+// ChainResolver, except that no code check is made: an address without code reports
+// ErrMissingDecimals instead of ErrNotContract.
+type MulticallResolver struct {
+	caller bind.ContractCaller
+	// Multicall is the address of the Multicall3 contract.
+	Multicall common.Address
+	// ChunkSize is the maximum number of token addresses per aggregate3 request.
+	ChunkSize int
+	// AllowFailure lets an individual call revert without reverting its whole request.
+	// When false, a single failing token fails every token in the same chunk.
+	AllowFailure bool
+	// BlockNumber pins every request to a block. Nil means the latest block.
+	BlockNumber *big.Int
+}
+
+// NewMulticallResolver creates a MulticallResolver using the canonical Multicall3 address,
+// DefaultMulticallChunkSize and per-call failure tolerance.
+func NewMulticallResolver(caller bind.ContractCaller) *MulticallResolver {
+	return &MulticallResolver{
+		caller:       caller,
+		Multicall:    Multicall3Address,
+		ChunkSize:    DefaultMulticallChunkSize,
+		AllowFailure: true,
+	}
+}
+
+// ResolveMetadata resolves a single address, so a MulticallResolver can also be used
+// with WithResolver.
+func (r *MulticallResolver) ResolveMetadata(ctx context.Context, addr common.Address) (TokenMetadata, error) {
+	resolved, failed := r.ResolveMetadataBatch(ctx, []common.Address{addr})
+	if err := failed[addr]; err != nil {
+		return TokenMetadata{}, err
+	}
+	return resolved[0], nil
+}
+
+// ResolveMetadataBatch resolves every address, chunk by chunk. A request-level failure,
+// such as a transport error, is reported against every address in that chunk.
+func (r *MulticallResolver) ResolveMetadataBatch(ctx context.Context, addrs []common.Address) ([]TokenMetadata, map[common.Address]error) {
+	chunkSize := r.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultMulticallChunkSize
+	}
+
+	resolved := make([]TokenMetadata, 0, len(addrs))
+	failed := make(map[common.Address]error)
+	for start := 0; start < len(addrs); start += chunkSize {
+		chunk := addrs[start:min(start+chunkSize, len(addrs))]
+		results, err := r.aggregate(ctx, chunk)
+		if err != nil {
+			for _, a := range chunk {
+				failed[a] = err
+			}
+			continue
+		}
+		for i, a := range chunk {
+			meta, err := decodeMulticallMetadata(a, results[3*i:3*i+3])
+			if err != nil {
+				failed[a] = err
+				continue
+			}
+			resolved = append(resolved, meta)
+		}
+	}
+	return resolved, failed
+}
+
+// aggregate issues one aggregate3 request with three calls per address.
+func (r *MulticallResolver) aggregate(ctx context.Context, chunk []common.Address) ([]multicall3Result, error) {
+	calls := make([]multicall3Call, 0, 3*len(chunk))
+	for _, a := range chunk {
+		for _, selector := range [][]byte{selectorName, selectorSymbol, selectorDecimals} {
+			calls = append(calls, multicall3Call{Target: a, AllowFailure: r.AllowFailure, CallData: selector})
+		}
+	}
+	input, err := multicall3ABI.Pack("aggregate3", calls)
+	if err != nil {
+		return nil, err
+	}
+
+	multicall := r.Multicall
+	output, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &multicall, Data: input}, r.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("multicall aggregate3: %w", err)
+	}
+	unpacked, err := multicall3ABI.Unpack("aggregate3", output)
+	if err != nil {
+		return nil, fmt.Errorf("%w: aggregate3: %v", ErrInvalidMetadata, err)
+	}
+	results := *abi.ConvertType(unpacked[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("%w: aggregate3 returned %d results for %d calls", ErrInvalidMetadata, len(results), len(calls))
+	}
+	return results, nil
+}
+
+// decodeMulticallMetadata decodes the name, symbol and decimals results for one token.
+func decodeMulticallMetadata(addr common.Address, results []multicall3Result) (TokenMetadata, error) {
+	data := func(res multicall3Result) []byte {
+		if !res.Success {
+			return nil
+		}
+		return res.ReturnData
+	}
+	decimals, err := decodeDecimalsResult(data(results[2]))
+	if err != nil {
+		return TokenMetadata{}, fmt.Errorf("%s: %w", addr.Hex(), err)
+	}
+	return TokenMetadata{
+		Address:  addr,
+		Name:     decodeStringResult(data(results[0])),
+		Symbol:   decodeStringResult(data(results[1])),
+		Decimals: decimals,
+	}, nil
+}
+
+// AddTokens adds many tokens under a single write-lock acquisition, assigning IDs in
+// input order. Each token is validated against the registry as the tokens before it leave
+// it. A token that fails, for example with ErrAlreadyExists, is reported in Failed without
+// affecting the rest, and repeats of an address within the input are ignored. The batch
+// is built on a copy of the registry, which costs O(n) in the number of tokens. When a
+// write-ahead log is attached, the whole batch is written as one record.
+func (ts *TokenSystem) AddTokens(tokens []TokenMetadata) BatchResult {
+	result := BatchResult{
+		Added:  make(map[common.Address]uint64, len(tokens)),
+		Failed: make(map[common.Address]error),
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	staged := cloneRegistry(ts.registry)
+	mutations := make([]mutation, 0, len(tokens))
+	events := make([]Event, 0, len(tokens))
+	for _, t := range tokens {
+		if _, batched := result.Added[t.Address]; batched {
+			continue
+		}
+		if _, registered := staged.addressToID[t.Address]; registered {
+			result.Failed[t.Address] = ErrAlreadyExists
+			continue
+		}
+		m := mutation{
+			kind:     mutationAdd,
+			id:       staged.nextID,
+			address:  t.Address,
+			name:     t.Name,
+			symbol:   t.Symbol,
+			decimals: t.Decimals,
+		}
+		// A failed mutation leaves staged untouched, so the batch carries on without it.
+		ev, err := ts.stage(m, staged)
+		if err != nil {
+			result.Failed[t.Address] = err
+			continue
+		}
+		mutations = append(mutations, m)
+		events = append(events, ev)
+		result.Added[t.Address] = m.id
+	}
+
+	if err := ts.install(staged, mutations, events); err != nil {
+		for _, m := range mutations {
+			delete(result.Added, m.address)
+			result.Failed[m.address] = err
+		}
+	}
+	return result
+}
+
+// AddTokensFromChain resolves the metadata of every address and adds the successes with
+// AddTokens. If the configured resolver implements BatchMetadataResolver, such as
+// MulticallResolver, the addresses are resolved in bulk; otherwise one at a time. The
+// lock is only held for the final insert, not while resolving.
+func (ts *TokenSystem) AddTokensFromChain(ctx context.Context, addrs []common.Address) (BatchResult, error) {
+	if ts.resolver == nil {
+		return BatchResult{}, ErrNoResolver
+	}
+
+	// Avoid the network round trips for addresses that are already registered.
+	known := make(map[common.Address]error)
+	pending := make([]common.Address, 0, len(addrs))
+	ts.mu.RLock()
+	for _, a := range addrs {
+		if _, exists := ts.registry.addressToID[a]; exists {
+			known[a] = ErrAlreadyExists
+		} else {
+			pending = append(pending, a)
+		}
+	}
+	ts.mu.RUnlock()
+
+	var resolved []TokenMetadata
+	var failed map[common.Address]error
+	if batch, ok := ts.resolver.(BatchMetadataResolver); ok {
+		resolved, failed = batch.ResolveMetadataBatch(ctx, pending)
+	} else {
+		failed = make(map[common.Address]error)
+		for _, a := range pending {
+			meta, err := ts.resolver.ResolveMetadata(ctx, a)
+			if err != nil {
+				failed[a] = err
+				continue
+			}
+			resolved = append(resolved, meta)
+		}
+	}
+
+	result := ts.AddTokens(resolved)
+	for a, err := range failed {
+		result.Failed[a] = err
+	}
+	for a, err := range known {
+		result.Failed[a] = err
+	}
+	return result, nil
+}
@@ -0,0 +1,229 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// fakeMulticaller extends fakeCaller with an in-memory Multicall3 at Multicall3Address.
+type fakeMulticaller struct {
+	*fakeCaller
+	requests int
+}
+
+func (c *fakeMulticaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if *call.To != Multicall3Address || c.err != nil {
+		return c.fakeCaller.CallContract(ctx, call, blockNumber)
+	}
+	c.requests++
+
+	method := multicall3ABI.Methods["aggregate3"]
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls := *abi.ConvertType(args[0], new([]multicall3Call)).(*[]multicall3Call)
+
+	results := make([]multicall3Result, len(calls))
+	for i, sub := range calls {
+		target := sub.Target
+		data, err := c.fakeCaller.CallContract(ctx, ethereum.CallMsg{To: &target, Data: sub.CallData}, blockNumber)
+		if err != nil {
+			if !sub.AllowFailure {
+				return nil, revertError{}
+			}
+			continue
+		}
+		results[i] = multicall3Result{Success: true, ReturnData: data}
+	}
+	return method.Outputs.Pack(results)
+}
+
+func newFakeMulticaller() *fakeMulticaller {
+	caller := &fakeMulticaller{fakeCaller: newFakeCaller()}
+	caller.deploy(addr(1), abiString("USD Coin"), abiString("USDC"), abiUint(6))
+	caller.deploy(addr(2), abiBytes32("Maker"), abiBytes32("MKR"), abiUint(18))
+	caller.deploy(addr(3), nil, nil, abiUint(8))
+	caller.deploy(addr(4), abiString("No Decimals"), abiString("NOD"), nil)
+	caller.deploy(addr(5), abiString("Wrapped Ether"), abiString("WETH"), abiUint(18))
+	return caller
+}
+
+// countingValidator accepts everything and counts the adds it checked.
+type countingValidator struct{ adds int }
+
+func (v *countingValidator) ValidateAdd(TokenView) error                    { v.adds++; return nil }
+func (v *countingValidator) ValidateUpdate(TokenView, uint32, uint64) error { return nil }
+
+// --- Unit Tests ---
+
+func TestMulticallResolver_ResolveMetadataBatch(t *testing.T) {
+	t.Parallel()
+	caller := newFakeMulticaller()
+	resolver := NewMulticallResolver(caller)
+	resolver.ChunkSize = 2
+
+	addrs := []common.Address{addr(1), addr(2), addr(3), addr(4), addr(5), addr(99)}
+	resolved, failed := resolver.ResolveMetadataBatch(context.Background(), addrs)
+
+	assert.Equal(t, 3, caller.requests, "six addresses in chunks of two")
+	assert.Equal(t, []TokenMetadata{
+		{Address: addr(1), Name: "USD Coin", Symbol: "USDC", Decimals: 6},
+		{Address: addr(2), Name: "Maker", Symbol: "MKR", Decimals: 18},
+		{Address: addr(3), Decimals: 8},
+		{Address: addr(5), Name: "Wrapped Ether", Symbol: "WETH", Decimals: 18},
+	}, resolved)
+	require.Len(t, failed, 2)
+	assert.ErrorIs(t, failed[addr(4)], ErrMissingDecimals)
+	assert.ErrorIs(t, failed[addr(99)], ErrMissingDecimals, "an address without code has no decimals")
+}
+
+func TestMulticallResolver_StrictChunks(t *testing.T) {
+	t.Parallel()
+	caller := newFakeMulticaller()
+	resolver := NewMulticallResolver(caller)
+	resolver.ChunkSize = 2
+	resolver.AllowFailure = false
+
+	// addr(3) reverts on name(), taking addr(5) in the same chunk down with it.
+	resolved, failed := resolver.ResolveMetadataBatch(context.Background(), []common.Address{addr(1), addr(2), addr(3), addr(5)})
+	assert.Len(t, resolved, 2)
+	require.Len(t, failed, 2)
+	assert.Contains(t, failed, addr(3))
+	assert.Contains(t, failed, addr(5))
+}
+
+func TestMulticallResolver_TransportError(t *testing.T) {
+	t.Parallel()
+	caller := newFakeMulticaller()
+	caller.err = errors.New("connection refused")
+
+	resolved, failed := NewMulticallResolver(caller).ResolveMetadataBatch(context.Background(), []common.Address{addr(1), addr(2)})
+	assert.Empty(t, resolved)
+	assert.ErrorIs(t, failed[addr(1)], caller.err)
+	assert.ErrorIs(t, failed[addr(2)], caller.err)
+
+	_, err := NewMulticallResolver(caller).ResolveMetadata(context.Background(), addr(1))
+	assert.ErrorIs(t, err, caller.err)
+}
+
+func TestTokenSystem_AddTokens(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	existing, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+
+	result := ts.AddTokens([]TokenMetadata{
+		{Address: addr(1), Name: "Dup", Symbol: "DUP"},
+		{Address: addr(2), Name: "Token B", Symbol: "TKB", Decimals: 6},
+		{Address: addr(3), Name: "Token C", Symbol: "TKC", Decimals: 8},
+		{Address: addr(2), Name: "Repeat", Symbol: "REP"},
+	})
+
+	assert.Equal(t, map[common.Address]uint64{addr(2): existing + 1, addr(3): existing + 2}, result.Added)
+	require.Len(t, result.Failed, 1)
+	assert.ErrorIs(t, result.Failed[addr(1)], ErrAlreadyExists)
+
+	view, err := ts.GetTokenByAddress(addr(2))
+	require.NoError(t, err)
+	assert.Equal(t, "Token B", view.Name, "the first occurrence of a repeated address wins")
+}
+
+func TestTokenSystem_AddTokensValidatesInOrder(t *testing.T) {
+	t.Parallel()
+	validator := &countingValidator{}
+	ts := NewTokenSystem(WithValidator(validator), WithCanonicalGuard())
+	ts.SetCanonical(addr(1), true)
+
+	// The look-alike is checked against the canonical token added before it in the batch.
+	result := ts.AddTokens([]TokenMetadata{
+		{Address: addr(1), Name: "USD Coin", Symbol: "USDC"},
+		{Address: addr(2), Name: "Fake", Symbol: "USDС"},
+		{Address: addr(3), Name: "Token C", Symbol: "TKC"},
+	})
+	assert.Len(t, result.Added, 2)
+	assert.ErrorIs(t, result.Failed[addr(2)], ErrImpersonation)
+	assert.Equal(t, 3, validator.adds, "each token is validated once")
+}
+
+func TestTokenSystem_CommitIsAtomic(t *testing.T) {
+	t.Parallel()
+	for _, opts := range [][]Option{nil, {WithLockFreeReads()}} {
+		ts := NewTokenSystem(opts...)
+		_, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+		require.NoError(t, err)
+		before := ts.State()
+
+		ts.mu.Lock()
+		err = ts.commit(
+			mutation{kind: mutationAdd, id: 2, address: addr(2), symbol: "TKB"},
+			mutation{kind: mutationAdd, id: 3, address: addr(2), symbol: "DUP"},
+		)
+		ts.mu.Unlock()
+		assert.ErrorIs(t, err, ErrAlreadyExists, "the second add is checked after the first")
+		assert.Equal(t, before, ts.State(), "nothing of a failed batch is applied")
+	}
+}
+
+func TestTokenSystem_AddTokensWithWAL(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	opts := WALOptions{
+		SnapshotPath: filepath.Join(dir, "tokens.snap"),
+		WALPath:      filepath.Join(dir, "tokens.wal"),
+		NoSync:       true,
+	}
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+
+	result := ts.AddTokens([]TokenMetadata{{Address: addr(1), Symbol: "TKA"}, {Address: addr(2), Symbol: "TKB"}})
+	assert.Len(t, result.Added, 2)
+	expected := ts.View()
+	require.NoError(t, ts.Close())
+
+	recovered, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assert.Equal(t, expected, recovered.View())
+}
+
+func TestTokenSystem_AddTokensFromChain(t *testing.T) {
+	t.Parallel()
+	caller := newFakeMulticaller()
+	ts := NewTokenSystem(WithResolver(NewMulticallResolver(caller)))
+	_, err := ts.AddToken(addr(5), "Wrapped Ether", "WETH", 18)
+	require.NoError(t, err)
+
+	result, err := ts.AddTokensFromChain(context.Background(), []common.Address{addr(1), addr(2), addr(4), addr(5)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, caller.requests, "known addresses are skipped and the rest resolved in one request")
+	assert.Len(t, result.Added, 2)
+	assert.ErrorIs(t, result.Failed[addr(4)], ErrMissingDecimals)
+	assert.ErrorIs(t, result.Failed[addr(5)], ErrAlreadyExists)
+	assert.Len(t, ts.View(), 3)
+}
+
+func TestTokenSystem_AddTokensFromChainSequential(t *testing.T) {
+	t.Parallel()
+	// A plain MetadataResolver is used one address at a time.
+	ts := NewTokenSystem(WithResolver(NewChainResolver(newFakeMulticaller().fakeCaller)))
+
+	result, err := ts.AddTokensFromChain(context.Background(), []common.Address{addr(1), addr(99)})
+	require.NoError(t, err)
+	assert.Contains(t, result.Added, addr(1))
+	assert.ErrorIs(t, result.Failed[addr(99)], ErrNotContract)
+
+	_, err = NewTokenSystem().AddTokensFromChain(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNoResolver)
+}
@@ -0,0 +1,330 @@
+package token
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Multi-chain snapshot layout (all integers little-endian), framed like a registry snapshot:
+//
+//	magic       [4]byte  "IWMC"
+//	version     uint16
+//	payloadLen  uint64
+//	payload:
+//	  idSpace   uint8
+//	  nextID    uint64   next global ID; zero for PerChainIDs
+//	  count     uint32   number of chains
+//	  chains    [count](chainID uint64, snapshotLen uint64, registry snapshot)
+//	checksum    uint32   CRC-32 (Castagnoli) of every preceding byte
+const (
+	multiChainSnapshotMagic   = "IWMC"
+	multiChainSnapshotVersion = uint16(1)
+)
+
+// ErrNotGlobalIDSpace is returned by FindTokenByID when token IDs are only unique per chain.
+var ErrNotGlobalIDSpace = errors.New("multi-chain: token IDs are not globally unique")
+
+// IDSpace selects how a MultiChainTokenSystem assigns token IDs.
+type IDSpace uint8
+
+const (
+	// PerChainIDs gives every chain its own ID sequence, so the same ID can name different
+	// tokens on different chains.
+	PerChainIDs IDSpace = iota
+	// GlobalIDs draws every ID from one sequence shared by all chains, so an ID identifies
+	// a token on its own. Adds are serialised across chains.
+	GlobalIDs
+)
+
+// MultiChainTokenSystem manages one TokenSystem per chain, scoping every operation by
+// chain ID. Chains are created on their first write; reading a chain that has none
+// behaves like reading an empty one.
+type MultiChainTokenSystem struct {
+	// mu guards chains and nextID. Every operation holds it for reading while it runs, so
+	// the write lock gives WriteSnapshot a consistent cut across all chains.
+	mu      sync.RWMutex
+	chains  map[uint64]*TokenSystem
+	idSpace IDSpace
+	nextID  uint64 // Next global ID; only used with GlobalIDs
+	opts    []Option
+}
+
+// NewMultiChainTokenSystem creates an empty MultiChainTokenSystem. The options are applied
+// to the TokenSystem of every chain.
+func NewMultiChainTokenSystem(idSpace IDSpace, opts ...Option) *MultiChainTokenSystem {
+	return &MultiChainTokenSystem{
+		chains:  make(map[uint64]*TokenSystem),
+		idSpace: idSpace,
+		nextID:  1,
+		opts:    opts,
+	}
+}
+
+// chain returns the TokenSystem for chainID, or nil. Callers must hold mu.
+func (m *MultiChainTokenSystem) chain(chainID uint64) *TokenSystem {
+	return m.chains[chainID]
+}
+
+// chainForWrite returns the TokenSystem for chainID, creating it if needed. Callers must
+// hold the write lock.
+func (m *MultiChainTokenSystem) chainForWrite(chainID uint64) *TokenSystem {
+	ts, ok := m.chains[chainID]
+	if !ok {
+		ts = NewTokenSystem(m.opts...)
+		m.chains[chainID] = ts
+	}
+	return ts
+}
+
+// IDSpace reports how token IDs are assigned.
+func (m *MultiChainTokenSystem) IDSpace() IDSpace {
+	return m.idSpace
+}
+
+// Chains returns the IDs of every chain that has been written to, in ascending order.
+func (m *MultiChainTokenSystem) Chains() []uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sortedChainIDs()
+}
+
+// sortedChainIDs returns the IDs of every chain in ascending order. Callers must hold mu.
+func (m *MultiChainTokenSystem) sortedChainIDs() []uint64 {
+	chainIDs := make([]uint64, 0, len(m.chains))
+	for chainID := range m.chains {
+		chainIDs = append(chainIDs, chainID)
+	}
+	slices.Sort(chainIDs)
+	return chainIDs
+}
+
+// AddToken adds a token to the given chain and returns its ID.
+func (m *MultiChainTokenSystem) AddToken(chainID uint64, addr common.Address, name, symbol string, decimals uint8) (uint64, error) {
+	if m.idSpace == GlobalIDs {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		ts := m.chainForWrite(chainID)
+		id := m.nextID
+		if err := ts.addTokenWithID(id, addr, name, symbol, decimals); err != nil {
+			return 0, err
+		}
+		m.nextID++
+		return id, nil
+	}
+
+	m.mu.RLock()
+	ts := m.chain(chainID)
+	if ts != nil {
+		defer m.mu.RUnlock()
+		return ts.AddToken(addr, name, symbol, decimals)
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.chainForWrite(chainID).AddToken(addr, name, symbol, decimals)
+}
+
+// DeleteToken removes a token from the given chain.
+func (m *MultiChainTokenSystem) DeleteToken(chainID, id uint64) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ts := m.chain(chainID)
+	if ts == nil {
+		return ErrTokenNotFound
+	}
+	return ts.DeleteToken(id)
+}
+
+// UpdateTokenPPM updates the fee and transfer gas of a token on the given chain.
+func (m *MultiChainTokenSystem) UpdateTokenPPM(chainID, id uint64, feePPM uint32, gas uint64) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ts := m.chain(chainID)
+	if ts == nil {
+		return ErrTokenNotFound
+	}
+	return ts.UpdateTokenPPM(id, feePPM, gas)
+}
+
+// GetTokenByID looks up a token on the given chain.
+func (m *MultiChainTokenSystem) GetTokenByID(chainID, id uint64) (TokenView, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ts := m.chain(chainID)
+	if ts == nil {
+		return TokenView{}, ErrTokenNotFound
+	}
+	return ts.GetTokenByID(id)
+}
+
+// GetTokenByAddress looks up a token on the given chain.
+func (m *MultiChainTokenSystem) GetTokenByAddress(chainID uint64, addr common.Address) (TokenView, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ts := m.chain(chainID)
+	if ts == nil {
+		return TokenView{}, ErrTokenNotFound
+	}
+	return ts.GetTokenByAddress(addr)
+}
+
+// GetTokensBySymbol returns every token on the given chain with exactly the given symbol.
+func (m *MultiChainTokenSystem) GetTokensBySymbol(chainID uint64, symbol string) []TokenView {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ts := m.chain(chainID)
+	if ts == nil {
+		return nil
+	}
+	return ts.GetTokensBySymbol(symbol)
+}
+
+// View returns a view of every token on the given chain.
+func (m *MultiChainTokenSystem) View(chainID uint64) []TokenView {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ts := m.chain(chainID)
+	if ts == nil {
+		return []TokenView{}
+	}
+	return ts.View()
+}
+
+// FindTokenByID looks up a token by ID across all chains and returns the chain it is on.
+// It requires GlobalIDs, and otherwise returns ErrNotGlobalIDSpace.
+func (m *MultiChainTokenSystem) FindTokenByID(id uint64) (uint64, TokenView, error) {
+	if m.idSpace != GlobalIDs {
+		return 0, TokenView{}, ErrNotGlobalIDSpace
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for chainID, ts := range m.chains {
+		if view, err := ts.GetTokenByID(id); err == nil {
+			return chainID, view, nil
+		}
+	}
+	return 0, TokenView{}, ErrTokenNotFound
+}
+
+// addTokenWithID adds a token under an ID chosen by the caller, which must never have
+// been used in this registry.
+func (ts *TokenSystem) addTokenWithID(id uint64, addr common.Address, name, symbol string, decimals uint8) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.commit(mutation{
+		kind:     mutationAdd,
+		id:       id,
+		address:  addr,
+		name:     name,
+		symbol:   symbol,
+		decimals: decimals,
+	})
+}
+
+// WriteSnapshot encodes every chain, the ID space and the global ID counter into one
+// snapshot. All chains are captured at the same instant.
+func (m *MultiChainTokenSystem) WriteSnapshot(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chainIDs := m.sortedChainIDs()
+	payload := []byte{byte(m.idSpace)}
+	nextID := m.nextID
+	if m.idSpace != GlobalIDs {
+		nextID = 0
+	}
+	payload = binary.LittleEndian.AppendUint64(payload, nextID)
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(chainIDs)))
+	var chainSnapshot bytes.Buffer
+	for _, chainID := range chainIDs {
+		chainSnapshot.Reset()
+		if err := m.chains[chainID].WriteSnapshot(&chainSnapshot); err != nil {
+			return err
+		}
+		payload = binary.LittleEndian.AppendUint64(payload, chainID)
+		payload = binary.LittleEndian.AppendUint64(payload, uint64(chainSnapshot.Len()))
+		payload = append(payload, chainSnapshot.Bytes()...)
+	}
+
+	_, err := writeSnapshotFrame(w, multiChainSnapshotMagic, multiChainSnapshotVersion, payload)
+	return err
+}
+
+// NewMultiChainTokenSystemFromSnapshot restores every chain from a snapshot written by
+// MultiChainTokenSystem.WriteSnapshot. The ID space is taken from the snapshot; the
+// options are applied to the TokenSystem of every chain. Each chain is validated as by
+// NewTokenRegistryFromSnapshot, and with GlobalIDs no ID may appear on two chains.
+func NewMultiChainTokenSystemFromSnapshot(r io.Reader, opts ...Option) (*MultiChainTokenSystem, error) {
+	payload, _, err := readSnapshotFrame(r, multiChainSnapshotMagic, multiChainSnapshotVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &binaryDecoder{buf: payload, errCorrupt: ErrCorruptSnapshot}
+	idSpace := IDSpace(d.uint8())
+	nextID := d.uint64()
+	count := d.uint32()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if idSpace > GlobalIDs {
+		return nil, fmt.Errorf("%w: unknown ID space %d", ErrCorruptSnapshot, idSpace)
+	}
+
+	if idSpace == GlobalIDs && nextID == 0 {
+		return nil, fmt.Errorf("%w: global next ID is zero", ErrCorruptSnapshot)
+	}
+
+	m := NewMultiChainTokenSystem(idSpace, opts...)
+	if idSpace == GlobalIDs {
+		m.nextID = nextID
+	}
+	usedIDs := make(map[uint64]uint64) // ID -> chain, only tracked with GlobalIDs
+	for i := uint32(0); i < count; i++ {
+		chainID := d.uint64()
+		snapshotLen := d.uint64()
+		if d.err == nil && snapshotLen > uint64(len(d.buf)) {
+			return nil, fmt.Errorf("%w: chain %d snapshot exceeds payload size", ErrCorruptSnapshot, chainID)
+		}
+		chainSnapshot := d.bytes(int(snapshotLen))
+		if d.err != nil {
+			return nil, d.err
+		}
+		if _, dup := m.chains[chainID]; dup {
+			return nil, fmt.Errorf("%w: chain %d appears twice", ErrCorruptSnapshot, chainID)
+		}
+
+		registry, err := NewTokenRegistryFromSnapshot(bytes.NewReader(chainSnapshot))
+		if err != nil {
+			return nil, fmt.Errorf("chain %d: %w", chainID, err)
+		}
+		if idSpace == GlobalIDs {
+			tokenIDs := slices.Clone(registry.id)
+			for id := range registry.tombstones {
+				tokenIDs = append(tokenIDs, id)
+			}
+			for _, id := range tokenIDs {
+				if other, dup := usedIDs[id]; dup {
+					return nil, fmt.Errorf("%w: ID %d used on chains %d and %d", ErrCorruptSnapshot, id, other, chainID)
+				}
+				if id >= m.nextID {
+					return nil, fmt.Errorf("%w: chain %d ID %d is not below the global next ID %d", ErrCorruptSnapshot, chainID, id, m.nextID)
+				}
+				usedIDs[id] = chainID
+			}
+		}
+		m.chains[chainID] = newTokenSystem(registry, opts)
+	}
+	if len(d.buf) != 0 {
+		return nil, fmt.Errorf("%w: %d unread payload bytes", ErrCorruptSnapshot, len(d.buf))
+	}
+	return m, nil
+}
@@ -0,0 +1,236 @@
+package token
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Chain IDs used throughout the multi-chain tests.
+const (
+	chainEthereum = 1
+	chainBSC      = 56
+	chainBase     = 8453
+)
+
+// --- Test Helpers ---
+
+// populateMultiChain adds the same address on two chains plus a chain-specific token.
+func populateMultiChain(t *testing.T, m *MultiChainTokenSystem) {
+	for _, tok := range []struct {
+		chainID uint64
+		addr    byte
+		symbol  string
+	}{
+		{chainEthereum, 1, "USDC"},
+		{chainBase, 1, "USDbC"},
+		{chainEthereum, 2, "WETH"},
+		{chainBSC, 3, "BUSD"},
+	} {
+		_, err := m.AddToken(tok.chainID, addr(tok.addr), tok.symbol, tok.symbol, 18)
+		require.NoError(t, err)
+	}
+}
+
+// --- Unit Tests ---
+
+func TestMultiChainTokenSystem_PerChainIDs(t *testing.T) {
+	t.Parallel()
+	m := NewMultiChainTokenSystem(PerChainIDs)
+	populateMultiChain(t, m)
+
+	assert.Equal(t, []uint64{chainEthereum, chainBSC, chainBase}, m.Chains())
+	ethUSDC, err := m.GetTokenByAddress(chainEthereum, addr(1))
+	require.NoError(t, err)
+	baseUSDC, err := m.GetTokenByAddress(chainBase, addr(1))
+	require.NoError(t, err)
+	assert.Equal(t, "USDC", ethUSDC.Symbol)
+	assert.Equal(t, "USDbC", baseUSDC.Symbol, "the same address is a different token on each chain")
+	assert.Equal(t, ethUSDC.ID, baseUSDC.ID, "each chain has its own ID sequence")
+
+	_, _, err = m.FindTokenByID(1)
+	assert.ErrorIs(t, err, ErrNotGlobalIDSpace)
+}
+
+func TestMultiChainTokenSystem_GlobalIDs(t *testing.T) {
+	t.Parallel()
+	m := NewMultiChainTokenSystem(GlobalIDs)
+	populateMultiChain(t, m)
+
+	views := append(append(m.View(chainEthereum), m.View(chainBase)...), m.View(chainBSC)...)
+	assert.ElementsMatch(t, []uint64{1, 2, 3, 4}, ids(views))
+
+	chainID, view, err := m.FindTokenByID(4)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(chainBSC), chainID)
+	assert.Equal(t, "BUSD", view.Symbol)
+
+	// A failed add consumes no ID, and deleted IDs are never reissued on any chain.
+	_, err = m.AddToken(chainEthereum, addr(1), "Dup", "DUP", 18)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	require.NoError(t, m.DeleteToken(chainBSC, 4))
+	id, err := m.AddToken(chainBase, addr(9), "New", "NEW", 18)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), id)
+}
+
+func TestMultiChainTokenSystem_ScopedOperations(t *testing.T) {
+	t.Parallel()
+	m := NewMultiChainTokenSystem(PerChainIDs, WithLockFreeReads())
+	populateMultiChain(t, m)
+	eth, err := m.GetTokenByAddress(chainEthereum, addr(1))
+	require.NoError(t, err)
+
+	require.NoError(t, m.UpdateTokenPPM(chainEthereum, eth.ID, 10_000, 50000))
+	view, err := m.GetTokenByID(chainEthereum, eth.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(50000), view.GasForTransfer)
+	base, err := m.GetTokenByAddress(chainBase, addr(1))
+	require.NoError(t, err)
+	assert.Zero(t, base.GasForTransfer, "updates do not leak across chains")
+
+	assert.Len(t, m.GetTokensBySymbol(chainEthereum, "WETH"), 1)
+	assert.Empty(t, m.GetTokensBySymbol(chainBase, "WETH"))
+
+	require.NoError(t, m.DeleteToken(chainEthereum, eth.ID))
+	_, err = m.GetTokenByAddress(chainBase, addr(1))
+	assert.NoError(t, err)
+
+	// Unknown chains read as empty and are not created by reads.
+	const unknown = 424242
+	assert.Empty(t, m.View(unknown))
+	_, err = m.GetTokenByID(unknown, 1)
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	assert.ErrorIs(t, m.DeleteToken(unknown, 1), ErrTokenNotFound)
+	assert.ErrorIs(t, m.UpdateTokenPPM(unknown, 1, 0, 0), ErrTokenNotFound)
+	assert.NotContains(t, m.Chains(), uint64(unknown))
+}
+
+func TestMultiChainTokenSystem_Snapshot(t *testing.T) {
+	t.Parallel()
+	for _, idSpace := range []IDSpace{PerChainIDs, GlobalIDs} {
+		m := NewMultiChainTokenSystem(idSpace)
+		populateMultiChain(t, m)
+		weth, err := m.GetTokenByAddress(chainEthereum, addr(2))
+		require.NoError(t, err)
+		require.NoError(t, m.DeleteToken(chainEthereum, weth.ID))
+
+		var buf bytes.Buffer
+		require.NoError(t, m.WriteSnapshot(&buf))
+		restored, err := NewMultiChainTokenSystemFromSnapshot(&buf)
+		require.NoError(t, err)
+
+		assert.Equal(t, idSpace, restored.IDSpace())
+		assert.Equal(t, m.Chains(), restored.Chains())
+		for _, chainID := range m.Chains() {
+			assert.Equal(t, m.chains[chainID].State(), restored.chains[chainID].State())
+		}
+
+		// The ID counters continue where they left off.
+		expected, err := m.AddToken(chainBase, addr(7), "Next", "NXT", 18)
+		require.NoError(t, err)
+		actual, err := restored.AddToken(chainBase, addr(7), "Next", "NXT", 18)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestMultiChainTokenSystem_SnapshotRejects(t *testing.T) {
+	t.Parallel()
+
+	// Build a GlobalIDs snapshot where the same ID appears on two chains.
+	chainSnapshot := func() []byte {
+		ts := NewTokenSystem()
+		_, err := ts.AddToken(addr(1), "Token", "TKN", 18)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, ts.WriteSnapshot(&buf))
+		return buf.Bytes()
+	}()
+	encode := func(idSpace IDSpace, nextID uint64, chainIDs ...uint64) []byte {
+		payload := []byte{byte(idSpace)}
+		payload = binary.LittleEndian.AppendUint64(payload, nextID)
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(len(chainIDs)))
+		for _, chainID := range chainIDs {
+			payload = binary.LittleEndian.AppendUint64(payload, chainID)
+			payload = binary.LittleEndian.AppendUint64(payload, uint64(len(chainSnapshot)))
+			payload = append(payload, chainSnapshot...)
+		}
+		var buf bytes.Buffer
+		_, err := writeSnapshotFrame(&buf, multiChainSnapshotMagic, multiChainSnapshotVersion, payload)
+		require.NoError(t, err)
+		return buf.Bytes()
+	}
+
+	testCases := []struct {
+		name        string
+		data        []byte
+		expectedErr error
+	}{
+		{name: "Valid per-chain", data: encode(PerChainIDs, 0, 1, 2)},
+		{name: "Shared global ID", data: encode(GlobalIDs, 10, 1, 2), expectedErr: ErrCorruptSnapshot},
+		{name: "ID beyond global counter", data: encode(GlobalIDs, 1, 1), expectedErr: ErrCorruptSnapshot},
+		{name: "Zero global counter", data: encode(GlobalIDs, 0), expectedErr: ErrCorruptSnapshot},
+		{name: "Duplicate chain", data: encode(PerChainIDs, 0, 1, 1), expectedErr: ErrCorruptSnapshot},
+		{name: "Unknown ID space", data: encode(IDSpace(7), 0), expectedErr: ErrCorruptSnapshot},
+		{name: "Registry snapshot", data: chainSnapshot, expectedErr: ErrInvalidSnapshotMagic},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewMultiChainTokenSystemFromSnapshot(bytes.NewReader(tc.data))
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestMultiChainTokenSystem_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	m := NewMultiChainTokenSystem(GlobalIDs)
+
+	var wg sync.WaitGroup
+	for _, chainID := range []uint64{chainEthereum, chainBSC, chainBase} {
+		wg.Add(1)
+		go func(chainID uint64) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := m.AddToken(chainID, benchAddr(i), "T", "T", 18); err != nil {
+					t.Error(err)
+					return
+				}
+				_ = m.View(chainID)
+			}
+		}(chainID)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			var buf bytes.Buffer
+			if err := m.WriteSnapshot(&buf); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	var all []TokenView
+	for _, chainID := range m.Chains() {
+		all = append(all, m.View(chainID)...)
+	}
+	assert.Len(t, all, 150)
+	seen := make(map[uint64]bool)
+	for _, v := range all {
+		assert.False(t, seen[v.ID], "ID %d issued twice", v.ID)
+		seen[v.ID] = true
+	}
+}
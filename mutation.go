@@ -0,0 +1,87 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// mutationKind identifies the registry operation a mutation performs.
+// The numeric values are part of the WAL format and must never be renumbered.
+type mutationKind uint8
+
+const (
+	mutationAdd    mutationKind = 1
+	mutationDelete mutationKind = 2
+	mutationUpdate mutationKind = 3
+	mutationFlags  mutationKind = 4
+	// mutationMetadata replaces a token's name, symbol and decimals. Only Apply makes it.
+	mutationMetadata mutationKind = 5
+)
+
+// mutation is a self-contained description of a single registry change. It is the unit
+// that is written to the WAL and replayed during recovery, so adds carry the ID they were
+// assigned rather than relying on nextID at replay time.
+type mutation struct {
+	kind             mutationKind
+	id               uint64
+	address          common.Address
+	name             string
+	symbol           string
+	decimals         uint8
+	feeOnTransferPPM uint32
+	gasForTransfer   uint64
+	flags            RiskFlags // The complete new value, so that replay does not depend on the old one
+}
+
+// checkMutation reports the error applyMutation would return, without modifying the registry.
+func checkMutation(m mutation, registry *TokenRegistry) error {
+	switch m.kind {
+	case mutationAdd:
+		if _, exists := registry.addressToID[m.address]; exists {
+			return ErrAlreadyExists
+		}
+		if _, live := registry.idToIndex[m.id]; live {
+			return fmt.Errorf("%w: %d", ErrDuplicateID, m.id)
+		}
+		if _, deleted := registry.tombstones[m.id]; deleted {
+			return fmt.Errorf("%w: %d", ErrIDReused, m.id)
+		}
+	case mutationDelete:
+		if _, ok := registry.idToIndex[m.id]; !ok {
+			return ErrTokenNotFound
+		}
+	case mutationUpdate:
+		if _, ok := registry.idToIndex[m.id]; !ok {
+			return ErrTokenNotFound
+		}
+		return validateFeePPM(m.feeOnTransferPPM)
+	case mutationFlags, mutationMetadata:
+		if _, ok := registry.idToIndex[m.id]; !ok {
+			return ErrTokenNotFound
+		}
+	default:
+		return fmt.Errorf("unknown mutation kind %d", m.kind)
+	}
+	return nil
+}
+
+// applyMutation validates and applies a mutation to the registry.
+func applyMutation(m mutation, registry *TokenRegistry) error {
+	if err := checkMutation(m, registry); err != nil {
+		return err
+	}
+	switch m.kind {
+	case mutationAdd:
+		insertToken(m.id, m.address, m.name, m.symbol, m.decimals, registry)
+		return nil
+	case mutationDelete:
+		return deleteToken(m.id, registry)
+	case mutationFlags:
+		return setTokenFlags(m.id, m.flags, registry)
+	case mutationMetadata:
+		return setTokenMetadata(m.id, m.name, m.symbol, m.decimals, registry)
+	default: // mutationUpdate
+		return updateToken(m.id, m.feeOnTransferPPM, m.gasForTransfer, registry)
+	}
+}
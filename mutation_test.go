@@ -0,0 +1,68 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMutation(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		m           mutation
+		expectedErr error
+	}{
+		{
+			name: "Add with explicit ID advances nextID",
+			m:    mutation{kind: mutationAdd, id: 10, address: addr(10), name: "Token J", symbol: "TKJ"},
+		},
+		{
+			name:        "Add with existing address",
+			m:           mutation{kind: mutationAdd, id: 10, address: addr(1)},
+			expectedErr: ErrAlreadyExists,
+		},
+		{
+			name:        "Add with live ID",
+			m:           mutation{kind: mutationAdd, id: 2, address: addr(10)},
+			expectedErr: ErrDuplicateID,
+		},
+		{
+			name:        "Add with tombstoned ID",
+			m:           mutation{kind: mutationAdd, id: 4, address: addr(10)},
+			expectedErr: ErrIDReused,
+		},
+		{
+			name:        "Delete unknown ID",
+			m:           mutation{kind: mutationDelete, id: 999},
+			expectedErr: ErrTokenNotFound,
+		},
+		{
+			name:        "Update unknown ID",
+			m:           mutation{kind: mutationUpdate, id: 999},
+			expectedErr: ErrTokenNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			registry, ids := newTestRegistry(t)
+			require.NoError(t, deleteToken(ids[3], registry))
+			before := viewRegistry(registry)
+
+			assert.Equal(t, tc.expectedErr == nil, checkMutation(tc.m, registry) == nil)
+			err := applyMutation(tc.m, registry)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Equal(t, before, viewRegistry(registry), "a rejected mutation must not change the registry")
+				return
+			}
+			require.NoError(t, err)
+			view, err := getTokenByID(tc.m.id, registry)
+			require.NoError(t, err)
+			assert.Equal(t, tc.m.address, view.Address)
+			assert.Equal(t, tc.m.id+1, registry.nextID)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package token
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultListPollInterval is how often WatchListFile checks the file when
+// WatchOptions.Interval is zero.
+const DefaultListPollInterval = 10 * time.Second
+
+var (
+	// ErrDenied is returned when adding a token whose address is on the denylist.
+	ErrDenied = errors.New("token address is denylisted")
+	// ErrInvalidAddressList is returned when a list file contains a line that is not an address.
+	ErrInvalidAddressList = errors.New("invalid address list")
+)
+
+// AddressList is an immutable set of addresses, used as a denylist or an allowlist.
+type AddressList struct {
+	set map[common.Address]struct{}
+}
+
+// NewAddressList returns a list of the given addresses.
+func NewAddressList(addrs ...common.Address) *AddressList {
+	l := &AddressList{set: make(map[common.Address]struct{}, len(addrs))}
+	for _, addr := range addrs {
+		l.set[addr] = struct{}{}
+	}
+	return l
+}
+
+// ParseAddressList reads one hex address per line. Blank lines are skipped, and "#" starts
+// a comment that runs to the end of the line.
+func ParseAddressList(r io.Reader) (*AddressList, error) {
+	l := NewAddressList()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if !common.IsHexAddress(text) {
+			return nil, fmt.Errorf("%w: line %d: %q is not an address", ErrInvalidAddressList, line, text)
+		}
+		l.set[common.HexToAddress(text)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadAddressList reads a list file in the format of ParseAddressList.
+func LoadAddressList(path string) (*AddressList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseAddressList(file)
+}
+
+// Contains reports whether addr is on the list. A nil list contains nothing.
+func (l *AddressList) Contains(addr common.Address) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.set[addr]
+	return ok
+}
+
+// Len returns the number of addresses on the list.
+func (l *AddressList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.set)
+}
+
+// SetDenylist replaces the denylist. Adding a token on the list fails with ErrDenied, and
+// tokens already registered at a listed address are deleted as one change, which is
+// logged and published like any other. It returns the deleted tokens, ordered by ID. A
+// nil list removes the denylist.
+// It acquires a full write lock.
+func (ts *TokenSystem) SetDenylist(list *AddressList) ([]TokenView, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var purged []TokenView
+	for i, addr := range ts.registry.address {
+		if list.Contains(addr) {
+			purged = append(purged, viewAt(i, ts.registry))
+		}
+	}
+	slices.SortFunc(purged, func(a, b TokenView) int { return cmp.Compare(a.ID, b.ID) })
+	mutations := make([]mutation, len(purged))
+	for i, view := range purged {
+		mutations[i] = mutation{kind: mutationDelete, id: view.ID}
+	}
+	if err := ts.commit(mutations...); err != nil {
+		return nil, err
+	}
+	ts.denylist = list
+	return purged, nil
+}
+
+// SetAllowlist switches the system into allowlist mode, in which only tokens at listed
+// addresses are tradable; see IsTradable. Unlisted tokens can still be added and looked
+// up. A nil list leaves allowlist mode, making every token tradable.
+// It acquires a full write lock.
+func (ts *TokenSystem) SetAllowlist(list *AddressList) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.allowlist = list
+}
+
+// IsTradable reports whether the token at addr is registered and, in allowlist mode, on
+// the allowlist.
+// It acquires a read lock, allowing multiple concurrent readers.
+func (ts *TokenSystem) IsTradable(addr common.Address) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	_, registered := ts.registry.addressToID[addr]
+	return registered && (ts.allowlist == nil || ts.allowlist.Contains(addr))
+}
+
+// ViewTradable is like View but returns only tradable tokens.
+// It acquires a read lock, allowing multiple concurrent readers.
+func (ts *TokenSystem) ViewTradable() []TokenView {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if ts.allowlist == nil {
+		return viewRegistry(ts.registry)
+	}
+	var views []TokenView
+	for i, addr := range ts.registry.address {
+		if ts.allowlist.Contains(addr) {
+			views = append(views, viewAt(i, ts.registry))
+		}
+	}
+	return views
+}
+
+// checkDenylist refuses an add whose address is on the denylist.
+func (ts *TokenSystem) checkDenylist(m mutation) error {
+	if ts.denylist.Contains(m.address) {
+		return fmt.Errorf("%w: %s", ErrDenied, m.address.Hex())
+	}
+	return nil
+}
+
+// WatchOptions configures WatchListFile.
+type WatchOptions struct {
+	// Interval is how often the file is checked for changes. Zero means DefaultListPollInterval.
+	Interval time.Duration
+	// OnError, if set, is called when a reload fails. The previous list stays in effect.
+	OnError func(error)
+}
+
+// WatchListFile loads the list file at path and passes it to apply, then keeps checking
+// the file and calls apply again each time its contents change, until ctx is done. The
+// first load happens before WatchListFile returns, and its error is returned; later
+// failures, including errors from apply, are passed to opts.OnError and retried at the
+// next check. Replace the file atomically (write a temporary file and rename it) so that
+// a check never sees it half-written.
+func WatchListFile(ctx context.Context, path string, opts WatchOptions, apply func(*AddressList) error) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultListPollInterval
+	}
+	var (
+		last   []byte
+		loaded bool
+	)
+	reload := func() error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if loaded && bytes.Equal(data, last) {
+			return nil
+		}
+		list, err := ParseAddressList(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := apply(list); err != nil {
+			return err
+		}
+		last, loaded = data, true
+		return nil
+	}
+	if err := reload(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := reload(); err != nil && opts.OnError != nil {
+					opts.OnError(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// WatchDenylistFile keeps the denylist in sync with the list file at path; see
+// WatchListFile and SetDenylist.
+func (ts *TokenSystem) WatchDenylistFile(ctx context.Context, path string, opts WatchOptions) error {
+	return WatchListFile(ctx, path, opts, func(list *AddressList) error {
+		_, err := ts.SetDenylist(list)
+		return err
+	})
+}
+
+// WatchAllowlistFile keeps the allowlist in sync with the list file at path; see
+// WatchListFile and SetAllowlist.
+func (ts *TokenSystem) WatchAllowlistFile(ctx context.Context, path string, opts WatchOptions) error {
+	return WatchListFile(ctx, path, opts, func(list *AddressList) error {
+		ts.SetAllowlist(list)
+		return nil
+	})
+}
@@ -0,0 +1,182 @@
+package token
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// writeListFile atomically replaces the list file at path with one address per line.
+func writeListFile(t *testing.T, path string, lines ...string) {
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(strings.Join(lines, "\n")), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+// --- Unit Tests ---
+
+func TestParseAddressList(t *testing.T) {
+	t.Parallel()
+
+	list, err := ParseAddressList(strings.NewReader(`
+# Sanctioned
+0x0100000000000000000000000000000000000000
+  0x0200000000000000000000000000000000000000   # trailing comment
+0x0100000000000000000000000000000000000000
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Len())
+	assert.True(t, list.Contains(addr(1)))
+	assert.True(t, list.Contains(addr(2)))
+	assert.False(t, list.Contains(addr(3)))
+
+	_, err = ParseAddressList(strings.NewReader("0x0100000000000000000000000000000000000000\nnot-an-address\n"))
+	assert.ErrorIs(t, err, ErrInvalidAddressList)
+	assert.ErrorContains(t, err, "line 2")
+
+	var nilList *AddressList
+	assert.False(t, nilList.Contains(addr(1)))
+	assert.Zero(t, nilList.Len())
+}
+
+func TestTokenSystem_Denylist(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	for i := byte(1); i <= 4; i++ {
+		_, err := ts.AddToken(addr(i), "Token", "TKN", 18)
+		require.NoError(t, err)
+	}
+	sub := ts.Subscribe(SubscribeOptions{})
+	defer sub.Close()
+
+	purged, err := ts.SetDenylist(NewAddressList(addr(3), addr(2), addr(9)))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3}, ids(purged))
+	assert.ElementsMatch(t, []uint64{1, 4}, ids(ts.View()))
+	for _, id := range []uint64{2, 3} {
+		ev := <-sub.C
+		assert.Equal(t, TokenDeleted, ev.Kind)
+		assert.Equal(t, id, ev.Token.ID)
+	}
+
+	_, err = ts.AddToken(addr(9), "Token", "TKN", 18)
+	assert.ErrorIs(t, err, ErrDenied)
+	err = ts.Update(func(tx *Tx) error {
+		_, err := tx.AddToken(addr(2), "Token", "TKN", 18)
+		return err
+	})
+	assert.ErrorIs(t, err, ErrDenied)
+	result := ts.AddTokens([]TokenMetadata{{Address: addr(3), Name: "Token", Symbol: "TKN"}})
+	assert.ErrorIs(t, result.Failed[addr(3)], ErrDenied)
+
+	purged, err = ts.SetDenylist(nil)
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+	_, err = ts.AddToken(addr(9), "Token", "TKN", 18)
+	assert.NoError(t, err)
+}
+
+func TestTokenSystem_DenylistPurgeIsLogged(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	populate(t, ts)
+	_, err = ts.SetDenylist(NewAddressList(addr(1)))
+	require.NoError(t, err)
+	expected := ts.View()
+	require.NoError(t, ts.Close())
+
+	recovered := openTestSystem(t, opts)
+	assert.Equal(t, expected, recovered.View())
+	_, err = recovered.GetTokenByAddress(addr(1))
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestTokenSystem_Allowlist(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	for i := byte(1); i <= 3; i++ {
+		_, err := ts.AddToken(addr(i), "Token", "TKN", 18)
+		require.NoError(t, err)
+	}
+
+	assert.True(t, ts.IsTradable(addr(2)), "every token is tradable without an allowlist")
+	assert.False(t, ts.IsTradable(addr(9)), "unregistered tokens are never tradable")
+	assert.Len(t, ts.ViewTradable(), 3)
+
+	ts.SetAllowlist(NewAddressList(addr(1), addr(3), addr(9)))
+	assert.True(t, ts.IsTradable(addr(1)))
+	assert.False(t, ts.IsTradable(addr(2)))
+	assert.False(t, ts.IsTradable(addr(9)))
+	assert.ElementsMatch(t, []uint64{1, 3}, ids(ts.ViewTradable()))
+	assert.Len(t, ts.View(), 3, "unlisted tokens stay registered")
+
+	ts.SetAllowlist(nil)
+	assert.True(t, ts.IsTradable(addr(2)))
+}
+
+func TestTokenSystem_WatchListFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	denyPath := filepath.Join(dir, "deny.txt")
+	allowPath := filepath.Join(dir, "allow.txt")
+	writeListFile(t, denyPath, "# nothing yet")
+	writeListFile(t, allowPath, addr(1).Hex())
+
+	ts := NewTokenSystem()
+	for i := byte(1); i <= 3; i++ {
+		_, err := ts.AddToken(addr(i), "Token", "TKN", 18)
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		reported []error
+	)
+	opts := WatchOptions{
+		Interval: time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+	}
+	require.NoError(t, ts.WatchDenylistFile(ctx, denyPath, opts))
+	require.NoError(t, ts.WatchAllowlistFile(ctx, allowPath, opts))
+	assert.Len(t, ts.View(), 3)
+	assert.ElementsMatch(t, []uint64{1}, ids(ts.ViewTradable()), "the first load is applied before returning")
+
+	writeListFile(t, denyPath, addr(2).Hex())
+	writeListFile(t, allowPath, addr(1).Hex(), addr(3).Hex())
+	require.Eventually(t, func() bool {
+		return len(ts.View()) == 2 && ts.IsTradable(addr(3))
+	}, 5*time.Second, time.Millisecond)
+
+	// A broken file is reported and the previous list stays in effect.
+	writeListFile(t, denyPath, "garbage")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reported) > 0
+	}, 5*time.Second, time.Millisecond)
+	mu.Lock()
+	assert.ErrorIs(t, reported[0], ErrInvalidAddressList)
+	mu.Unlock()
+	_, err := ts.AddToken(addr(2), "Token", "TKN", 18)
+	assert.ErrorIs(t, err, ErrDenied)
+
+	err = WatchListFile(ctx, filepath.Join(dir, "missing.txt"), opts, func(*AddressList) error { return nil })
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,229 @@
+package token
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by Query when the cursor is malformed or was issued for a
+// different ordering.
+var ErrInvalidCursor = errors.New("invalid query cursor")
+
+// SymbolMatch selects how Query compares Query.Symbol with token symbols.
+type SymbolMatch uint8
+
+const (
+	// SymbolExact matches symbols equal to the query, including case.
+	SymbolExact SymbolMatch = iota
+	// SymbolFold matches symbols equal to the query, ignoring case.
+	SymbolFold
+	// SymbolPrefix matches symbols that start with the query, ignoring case.
+	SymbolPrefix
+	// SymbolSubstring matches symbols that contain the query, ignoring case.
+	SymbolSubstring
+)
+
+// QueryOrder selects the order of Query results. Ties are broken by ID.
+type QueryOrder uint8
+
+const (
+	// OrderByID orders tokens by their stable ID.
+	OrderByID QueryOrder = iota
+	// OrderBySymbol orders tokens by symbol, ignoring case.
+	OrderBySymbol
+	// OrderByAddress orders tokens by address bytes.
+	OrderByAddress
+)
+
+// Range is an inclusive range of values. Filters take a *Range, where nil matches every value.
+type Range[T uint8 | uint32 | uint64] struct {
+	Min, Max T
+}
+
+// contains reports whether v lies in the range. A nil range contains everything.
+func (r *Range[T]) contains(v T) bool {
+	return r == nil || (v >= r.Min && v <= r.Max)
+}
+
+// Query selects, orders and paginates tokens. The zero value returns every token ordered
+// by ID in a single page.
+type Query struct {
+	// Decimals, FeePPM and Gas restrict the matching fields when set.
+	Decimals *Range[uint8]
+	FeePPM   *Range[uint32]
+	Gas      *Range[uint64]
+	// Symbol restricts symbols as chosen by SymbolMatch. Empty matches every symbol.
+	Symbol      string
+	SymbolMatch SymbolMatch
+	Flags       FlagFilter
+
+	OrderBy    QueryOrder
+	Descending bool
+
+	// Cursor continues from a previous page's NextCursor. The query must otherwise be
+	// unchanged. Empty starts from the first page.
+	Cursor string
+	// Limit caps the number of tokens per page. Zero or negative means no limit.
+	Limit int
+}
+
+// QueryPage is one page of Query results.
+type QueryPage struct {
+	Tokens []TokenView
+	// NextCursor fetches the following page, and is empty on the last page.
+	NextCursor string
+	// Total counts every token that passes the filters, across all pages.
+	Total int
+}
+
+// queryPosition places a token in a query's order: by key, then by ID. The key is
+// empty when ordering by ID.
+type queryPosition struct {
+	key string
+	id  uint64
+}
+
+// compare orders positions ascending.
+func (p queryPosition) compare(other queryPosition) int {
+	if c := strings.Compare(p.key, other.key); c != 0 {
+		return c
+	}
+	return cmp.Compare(p.id, other.id)
+}
+
+// matches reports whether the token at index passes every filter of q.
+func (q *Query) matches(index int, registry *TokenRegistry) bool {
+	if !q.Decimals.contains(registry.decimals[index]) ||
+		!q.FeePPM.contains(registry.feeOnTransferPPM[index]) ||
+		!q.Gas.contains(registry.gasForTransfer[index]) ||
+		!q.Flags.Matches(registry.flags[index]) {
+		return false
+	}
+	if q.Symbol == "" {
+		return true
+	}
+	symbol := registry.symbol[index]
+	switch q.SymbolMatch {
+	case SymbolFold:
+		return strings.EqualFold(symbol, q.Symbol)
+	case SymbolPrefix:
+		return hasPrefixFold(symbol, q.Symbol)
+	case SymbolSubstring:
+		return containsFold(symbol, q.Symbol)
+	default:
+		return symbol == q.Symbol
+	}
+}
+
+// position returns where the token at index falls in q's order.
+func (q *Query) position(index int, registry *TokenRegistry) queryPosition {
+	pos := queryPosition{id: registry.id[index]}
+	switch q.OrderBy {
+	case OrderBySymbol:
+		pos.key = symbolKey(registry.symbol[index])
+	case OrderByAddress:
+		pos.key = string(registry.address[index][:])
+	}
+	return pos
+}
+
+// cursorPrefix identifies the ordering a cursor was issued for.
+func (q *Query) cursorPrefix() string {
+	direction := "a"
+	if q.Descending {
+		direction = "d"
+	}
+	return strconv.Itoa(int(q.OrderBy)) + direction
+}
+
+// encodeCursor returns an opaque cursor that resumes after pos.
+func (q *Query) encodeCursor(pos queryPosition) string {
+	raw := q.cursorPrefix() + ":" + strconv.FormatUint(pos.id, 10) + ":" + pos.key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses q.Cursor.
+func (q *Query) decodeCursor() (queryPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return queryPosition{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
+		return queryPosition{}, ErrInvalidCursor
+	}
+	if parts[0] != q.cursorPrefix() {
+		return queryPosition{}, fmt.Errorf("%w: issued for a different ordering", ErrInvalidCursor)
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return queryPosition{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	return queryPosition{key: parts[2], id: id}, nil
+}
+
+// queryTokens runs q against the registry. Filters are checked against the columns, so
+// only the tokens on the returned page are copied into views.
+func queryTokens(q Query, registry *TokenRegistry) (QueryPage, error) {
+	var after *queryPosition
+	if q.Cursor != "" {
+		pos, err := q.decodeCursor()
+		if err != nil {
+			return QueryPage{}, err
+		}
+		after = &pos
+	}
+	direction := 1
+	if q.Descending {
+		direction = -1
+	}
+
+	type match struct {
+		pos   queryPosition
+		index int
+	}
+	var page QueryPage
+	var matches []match
+	for i := range registry.id {
+		if !q.matches(i, registry) {
+			continue
+		}
+		page.Total++
+		pos := q.position(i, registry)
+		// The cursor is a position rather than a token, so it still works if the token
+		// it was issued for has since been deleted.
+		if after != nil && pos.compare(*after)*direction <= 0 {
+			continue
+		}
+		matches = append(matches, match{pos: pos, index: i})
+	}
+	slices.SortFunc(matches, func(a, b match) int { return a.pos.compare(b.pos) * direction })
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+		page.NextCursor = q.encodeCursor(matches[len(matches)-1].pos)
+	}
+
+	page.Tokens = make([]TokenView, len(matches))
+	for i, m := range matches {
+		page.Tokens[i] = viewAt(m.index, registry)
+	}
+	return page, nil
+}
+
+// Query returns one page of the tokens selected by q. Unlike View, results come in a
+// stable order, and a page fetched with a cursor continues exactly after the previous
+// page even if tokens were added or deleted in between: no token that remains in place
+// is skipped or repeated.
+func (ts *TokenSystem) Query(q Query) (QueryPage, error) {
+	if registry := ts.published.Load(); registry != nil {
+		return queryTokens(q, registry)
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return queryTokens(q, ts.registry)
+}
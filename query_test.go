@@ -0,0 +1,193 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// newQueryTestSystem registers eight tokens whose addresses run opposite to their IDs.
+func newQueryTestSystem(t *testing.T) *TokenSystem {
+	ts := NewTokenSystem()
+	for i, tok := range []struct {
+		symbol   string
+		decimals uint8
+		fee      uint32
+		gas      uint64
+		flags    RiskFlags
+	}{
+		{"WETH", 18, 0, 30_000, 0},
+		{"usdc", 6, 0, 50_000, FlagUpgradeable | FlagBlacklistable},
+		{"USDT", 6, 0, 60_000, FlagBlacklistable | FlagPausable},
+		{"TAX", 18, 50_000, 90_000, 0},
+		{"USDC", 6, 0, 55_000, FlagUpgradeable},
+		{"DAI", 18, 0, 35_000, 0},
+		{"SCAM", 9, 990_000, 120_000, FlagHoneypot},
+		{"WBTC", 8, 0, 40_000, 0},
+	} {
+		id, err := ts.AddToken(addr(byte(100-i)), tok.symbol, tok.symbol, tok.decimals)
+		require.NoError(t, err)
+		require.NoError(t, ts.UpdateTokenPPM(id, tok.fee, tok.gas))
+		if tok.flags != 0 {
+			require.NoError(t, ts.SetFlags(id, tok.flags))
+		}
+	}
+	return ts
+}
+
+// queryAll follows cursors until the last page and returns every ID in order.
+func queryAll(t *testing.T, ts *TokenSystem, q Query) []uint64 {
+	var all []uint64
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 100, "pagination does not terminate")
+		page, err := ts.Query(q)
+		require.NoError(t, err)
+		if q.Limit > 0 {
+			require.LessOrEqual(t, len(page.Tokens), q.Limit)
+		}
+		all = append(all, ids(page.Tokens)...)
+		if page.NextCursor == "" {
+			return all
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// --- Unit Tests ---
+
+func TestTokenSystem_QueryFilters(t *testing.T) {
+	t.Parallel()
+	ts := newQueryTestSystem(t)
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected []uint64
+	}{
+		{name: "Everything", query: Query{}, expected: []uint64{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "Decimals", query: Query{Decimals: &Range[uint8]{Min: 6, Max: 9}}, expected: []uint64{2, 3, 5, 7, 8}},
+		{name: "No fee", query: Query{FeePPM: &Range[uint32]{Max: 0}}, expected: []uint64{1, 2, 3, 5, 6, 8}},
+		{name: "Fee range", query: Query{FeePPM: &Range[uint32]{Min: 1, Max: 100_000}}, expected: []uint64{4}},
+		{name: "Gas", query: Query{Gas: &Range[uint64]{Min: 40_000, Max: 60_000}}, expected: []uint64{2, 3, 5, 8}},
+		{name: "Symbol exact", query: Query{Symbol: "USDC"}, expected: []uint64{5}},
+		{name: "Symbol fold", query: Query{Symbol: "USDC", SymbolMatch: SymbolFold}, expected: []uint64{2, 5}},
+		{name: "Symbol prefix", query: Query{Symbol: "us", SymbolMatch: SymbolPrefix}, expected: []uint64{2, 3, 5}},
+		{name: "Symbol substring", query: Query{Symbol: "a", SymbolMatch: SymbolSubstring}, expected: []uint64{4, 6, 7}},
+		{name: "Flags", query: Query{Flags: FlagFilter{Exclude: FlagHoneypot | FlagPausable}}, expected: []uint64{1, 2, 4, 5, 6, 8}},
+		{
+			name: "Combined",
+			query: Query{
+				Decimals: &Range[uint8]{Min: 6, Max: 6},
+				Symbol:   "usd", SymbolMatch: SymbolPrefix,
+				Flags: FlagFilter{Require: FlagUpgradeable},
+			},
+			expected: []uint64{2, 5},
+		},
+		{name: "Nothing", query: Query{Symbol: "BTC"}, expected: []uint64{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := ts.Query(tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ids(page.Tokens))
+			assert.Equal(t, len(tc.expected), page.Total)
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+}
+
+func TestTokenSystem_QueryOrderAndPagination(t *testing.T) {
+	t.Parallel()
+	ts := newQueryTestSystem(t)
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected []uint64
+	}{
+		{name: "ID", query: Query{}, expected: []uint64{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "ID descending", query: Query{Descending: true}, expected: []uint64{8, 7, 6, 5, 4, 3, 2, 1}},
+		// Symbols compare case-insensitively, with "usdc" and "USDC" ordered by ID.
+		{name: "Symbol", query: Query{OrderBy: OrderBySymbol}, expected: []uint64{6, 7, 4, 2, 5, 3, 8, 1}},
+		{name: "Symbol descending", query: Query{OrderBy: OrderBySymbol, Descending: true}, expected: []uint64{1, 8, 3, 5, 2, 4, 7, 6}},
+		{name: "Address", query: Query{OrderBy: OrderByAddress}, expected: []uint64{8, 7, 6, 5, 4, 3, 2, 1}},
+		{name: "Filtered", query: Query{OrderBy: OrderBySymbol, Decimals: &Range[uint8]{Min: 18, Max: 18}}, expected: []uint64{6, 4, 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, queryAll(t, ts, tc.query), "single page")
+			for _, limit := range []int{1, 3, 7, 8} {
+				tc.query.Limit = limit
+				assert.Equal(t, tc.expected, queryAll(t, ts, tc.query), "limit %d", limit)
+			}
+		})
+	}
+
+	page, err := ts.Query(Query{OrderBy: OrderBySymbol, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 8, page.Total, "Total counts every page")
+}
+
+func TestTokenSystem_QueryCursorSurvivesDeletes(t *testing.T) {
+	t.Parallel()
+
+	for _, order := range []QueryOrder{OrderByID, OrderBySymbol, OrderByAddress} {
+		ts := newQueryTestSystem(t)
+		q := Query{OrderBy: order, Limit: 3}
+		full := queryAll(t, ts, Query{OrderBy: order})
+
+		first, err := ts.Query(q)
+		require.NoError(t, err)
+		require.Equal(t, full[:3], ids(first.Tokens))
+
+		// Delete the token the cursor points at and the first one of the next page. The
+		// deletes also move tokens to new slots.
+		require.NoError(t, ts.DeleteToken(full[2]))
+		require.NoError(t, ts.DeleteToken(full[3]))
+
+		q.Cursor = first.NextCursor
+		assert.Equal(t, full[4:], queryAll(t, ts, q), "order %d", order)
+	}
+}
+
+func TestTokenSystem_QueryInvalidCursor(t *testing.T) {
+	t.Parallel()
+	ts := newQueryTestSystem(t)
+	page, err := ts.Query(Query{OrderBy: OrderBySymbol, Limit: 2})
+	require.NoError(t, err)
+
+	for _, q := range []Query{
+		{Cursor: "!!!"},
+		{Cursor: "bm90LWEtY3Vyc29y"}, // "not-a-cursor"
+		{Cursor: page.NextCursor},
+		{Cursor: page.NextCursor, OrderBy: OrderBySymbol, Descending: true},
+	} {
+		_, err := ts.Query(q)
+		assert.ErrorIs(t, err, ErrInvalidCursor, "cursor %q", q.Cursor)
+	}
+}
+
+// --- Benchmarking ---
+
+func BenchmarkTokenSystem_QueryPage(b *testing.B) {
+	ts := NewTokenSystem()
+	for i := 1; i <= 10_000; i++ {
+		a := addr(0)
+		a[0] = byte(i / 256)
+		a[1] = byte(i % 256)
+		_, _ = ts.AddToken(a, "bench", "B", 18)
+	}
+	q := Query{OrderBy: OrderByAddress, Limit: 100}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ts.Query(q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// ErrNoResolver is returned by AddTokenFromChain when the TokenSystem was built without WithResolver.
+	ErrNoResolver = errors.New("token system has no metadata resolver")
+	// ErrNotContract is returned when there is no contract code at the token address.
+	ErrNotContract = errors.New("metadata: no contract code at address")
+	// ErrMissingDecimals is returned when decimals() reverts or returns no data.
+	ErrMissingDecimals = errors.New("metadata: decimals() unavailable")
+	// ErrInvalidMetadata is returned when a metadata call returns data that cannot be decoded.
+	ErrInvalidMetadata = errors.New("metadata: undecodable return data")
+)
+
+// ERC20 metadata function selectors.
+var (
+	selectorName     = []byte{0x06, 0xfd, 0xde, 0x03} // name()
+	selectorSymbol   = []byte{0x95, 0xd8, 0x9b, 0x41} // symbol()
+	selectorDecimals = []byte{0x31, 0x3c, 0xe5, 0x67} // decimals()
+)
+
+// rpcCodeExecutionReverted is the JSON-RPC error code nodes use for a reverted call. The
+// generic server error code -32000 is not treated as a revert: nodes also use it for
+// missing state, unknown blocks and timeouts, which must not read as absent metadata.
+const rpcCodeExecutionReverted = 3
+
+// TokenMetadata is the immutable token data read from an ERC20 contract.
+type TokenMetadata struct {
+	Address  common.Address `json:"address"`
+	Name     string         `json:"name"`
+	Symbol   string         `json:"symbol"`
+	Decimals uint8          `json:"decimals"`
+}
+
+// MetadataResolver looks up the metadata for a token address.
+type MetadataResolver interface {
+	ResolveMetadata(ctx context.Context, addr common.Address) (TokenMetadata, error)
+}
+
+// ChainResolver resolves metadata with eth_call through a go-ethereum ContractCaller,
+// such as an *ethclient.Client or a simulated backend client.
+//
+// name() and symbol() are optional in EIP-20, so a revert or empty result yields an empty
+// string. Both the standard string return type and the bytes32 encoding used by early
+// tokens such as MKR and SAI are accepted. decimals() is required, since amounts cannot
+// be interpreted without it, and its absence is reported as ErrMissingDecimals.
+type ChainResolver struct {
+	caller bind.ContractCaller
+	// BlockNumber pins every call to a block. Nil means the latest block.
+	BlockNumber *big.Int
+}
+
+// NewChainResolver creates a ChainResolver backed by the given caller.
+func NewChainResolver(caller bind.ContractCaller) *ChainResolver {
+	return &ChainResolver{caller: caller}
+}
+
+// ResolveMetadata reads name(), symbol() and decimals() from the token contract.
+// Transport failures, as opposed to contract-level reverts, are returned unchanged.
+func (r *ChainResolver) ResolveMetadata(ctx context.Context, addr common.Address) (TokenMetadata, error) {
+	code, err := r.caller.CodeAt(ctx, addr, r.BlockNumber)
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+	if len(code) == 0 {
+		return TokenMetadata{}, fmt.Errorf("%w: %s", ErrNotContract, addr.Hex())
+	}
+
+	meta := TokenMetadata{Address: addr}
+	if meta.Name, err = r.callString(ctx, addr, selectorName); err != nil {
+		return TokenMetadata{}, err
+	}
+	if meta.Symbol, err = r.callString(ctx, addr, selectorSymbol); err != nil {
+		return TokenMetadata{}, err
+	}
+
+	data, err := r.call(ctx, addr, selectorDecimals)
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+	if meta.Decimals, err = decodeDecimalsResult(data); err != nil {
+		return TokenMetadata{}, fmt.Errorf("%s: %w", addr.Hex(), err)
+	}
+	return meta, nil
+}
+
+// call performs an eth_call, mapping execution failures to an empty result.
+func (r *ChainResolver) call(ctx context.Context, addr common.Address, selector []byte) ([]byte, error) {
+	data, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: selector}, r.BlockNumber)
+	if err != nil {
+		if isExecutionError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *ChainResolver) callString(ctx context.Context, addr common.Address, selector []byte) (string, error) {
+	data, err := r.call(ctx, addr, selector)
+	if err != nil {
+		return "", err
+	}
+	return decodeStringResult(data), nil
+}
+
+// isExecutionError reports whether err is the call reverting, rather than the node
+// failing to run it.
+func isExecutionError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == rpcCodeExecutionReverted {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+// decodeStringResult decodes a name() or symbol() result. It accepts an ABI-encoded
+// string, falling back to a NUL-padded bytes32, and returns "" for anything else.
+// Invalid UTF-8 is replaced rather than rejected, since the value is informational.
+func decodeStringResult(data []byte) string {
+	if s, ok := decodeABIString(data); ok {
+		return strings.ToValidUTF8(s, string(utf8.RuneError))
+	}
+	if len(data) == 32 {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			data = data[:i]
+		}
+		return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	}
+	return ""
+}
+
+// decodeABIString decodes a single dynamic string return value.
+func decodeABIString(data []byte) (string, bool) {
+	if len(data) < 64 {
+		return "", false
+	}
+	offset := new(big.Int).SetBytes(data[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data)-32) {
+		return "", false
+	}
+	start := offset.Uint64() + 32
+	length := new(big.Int).SetBytes(data[start-32 : start])
+	if !length.IsUint64() || length.Uint64() > uint64(len(data))-start {
+		return "", false
+	}
+	return string(data[start : start+length.Uint64()]), true
+}
+
+// decodeDecimalsResult decodes a decimals() result, which is uint8 in EIP-20 but declared
+// as uint256 by some tokens.
+func decodeDecimalsResult(data []byte) (uint8, error) {
+	if len(data) == 0 {
+		return 0, ErrMissingDecimals
+	}
+	if len(data) < 32 {
+		return 0, fmt.Errorf("%w: decimals() returned %d bytes", ErrInvalidMetadata, len(data))
+	}
+	value := new(big.Int).SetBytes(data[:32])
+	if !value.IsUint64() || value.Uint64() > 255 {
+		return 0, fmt.Errorf("%w: decimals() returned %s", ErrInvalidMetadata, value)
+	}
+	return uint8(value.Uint64()), nil
+}
+
+// AddTokenFromChain resolves the token's name, symbol and decimals with the configured
+// MetadataResolver and adds it to the registry. The lock is not held while resolving, so
+// a concurrent add of the same address is still reported as ErrAlreadyExists.
+func (ts *TokenSystem) AddTokenFromChain(ctx context.Context, addr common.Address) (uint64, error) {
+	if ts.resolver == nil {
+		return 0, ErrNoResolver
+	}
+	// Avoid the network round trips for an address that is already registered.
+	if _, err := ts.GetTokenByAddress(addr); err == nil {
+		return 0, ErrAlreadyExists
+	}
+
+	meta, err := ts.resolver.ResolveMetadata(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	return ts.AddToken(addr, meta.Name, meta.Symbol, meta.Decimals)
+}
@@ -0,0 +1,417 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// revertError mimics the error a node returns for a reverted eth_call.
+type revertError struct{}
+
+func (revertError) Error() string  { return "execution reverted" }
+func (revertError) ErrorCode() int { return rpcCodeExecutionReverted }
+
+// serverError mimics a node failing a call with the generic server error code.
+type serverError struct{ msg string }
+
+func (e serverError) Error() string { return e.msg }
+func (serverError) ErrorCode() int  { return -32000 }
+
+// fakeContract scripts the responses of a single token contract, keyed by selector.
+type fakeContract struct {
+	results map[string][]byte
+	errs    map[string]error
+}
+
+// fakeCaller is an in-memory bind.ContractCaller.
+type fakeCaller struct {
+	contracts map[common.Address]*fakeContract
+	err       error // Returned by every call when set, to simulate transport failures
+}
+
+func newFakeCaller() *fakeCaller {
+	return &fakeCaller{contracts: make(map[common.Address]*fakeContract)}
+}
+
+// deploy registers a contract whose metadata calls return the given raw results.
+// A nil result makes the call revert.
+func (c *fakeCaller) deploy(a common.Address, name, symbol, decimals []byte) {
+	contract := &fakeContract{results: make(map[string][]byte), errs: make(map[string]error)}
+	for selector, result := range map[string][]byte{
+		string(selectorName):     name,
+		string(selectorSymbol):   symbol,
+		string(selectorDecimals): decimals,
+	} {
+		if result == nil {
+			contract.errs[selector] = revertError{}
+		} else {
+			contract.results[selector] = result
+		}
+	}
+	c.contracts[a] = contract
+}
+
+func (c *fakeCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if _, ok := c.contracts[contract]; !ok {
+		return nil, nil
+	}
+	return []byte{0x60, 0x00}, nil
+}
+
+func (c *fakeCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	contract, ok := c.contracts[*call.To]
+	if !ok {
+		return nil, nil
+	}
+	selector := string(call.Data[:4])
+	if err, ok := contract.errs[selector]; ok {
+		return nil, err
+	}
+	return contract.results[selector], nil
+}
+
+// abiString ABI-encodes a single string return value.
+func abiString(s string) []byte {
+	out := make([]byte, 64, 64+32)
+	out[31] = 0x20
+	big.NewInt(int64(len(s))).FillBytes(out[32:64])
+	padded := make([]byte, (len(s)+31)/32*32)
+	copy(padded, s)
+	return append(out, padded...)
+}
+
+// abiBytes32 encodes a string as a NUL-padded bytes32 return value.
+func abiBytes32(s string) []byte {
+	out := make([]byte, 32)
+	copy(out, s)
+	return out
+}
+
+// abiUint encodes a uint256 return value.
+func abiUint(v int64) []byte {
+	return big.NewInt(v).FillBytes(make([]byte, 32))
+}
+
+// metadataContract returns EVM runtime code that answers each selector in results with
+// its raw return data and reverts for any other call, as a token contract would for a
+// function it does not have. The resolver only makes the metadata calls, so the
+// contracts implement nothing else.
+func metadataContract(results map[string][]byte) []byte {
+	selectors := make([]string, 0, len(results))
+	for selector := range results {
+		selectors = append(selectors, selector)
+	}
+	slices.Sort(selectors)
+
+	// The dispatcher is a header loading the selector, one 11-byte comparison per
+	// function and a 4-byte revert, followed by one 16-byte body per function and the
+	// return data the bodies copy out of the code.
+	const header, compare, fallback, body = 6, 11, 4, 16
+	bodies := header + compare*len(selectors) + fallback
+	data := bodies + body*len(selectors)
+
+	code := []byte{byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD), byte(vm.PUSH1), 0xe0, byte(vm.SHR)}
+	for i, selector := range selectors {
+		code = append(code, byte(vm.DUP1), byte(vm.PUSH4))
+		code = append(code, selector...)
+		code = append(code, byte(vm.EQ), byte(vm.PUSH2), byte((bodies+body*i)>>8), byte(bodies+body*i), byte(vm.JUMPI))
+	}
+	code = append(code, byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.REVERT))
+	for _, selector := range selectors {
+		size := len(results[selector])
+		code = append(code,
+			byte(vm.JUMPDEST),
+			byte(vm.PUSH2), byte(size>>8), byte(size),
+			byte(vm.PUSH2), byte(data>>8), byte(data),
+			byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+			byte(vm.PUSH2), byte(size>>8), byte(size),
+			byte(vm.PUSH1), 0, byte(vm.RETURN),
+		)
+		data += size
+	}
+	for _, selector := range selectors {
+		code = append(code, results[selector]...)
+	}
+	return code
+}
+
+// simulatedChain is an in-process chain with one funded account for deploying contracts.
+type simulatedChain struct {
+	backend *simulated.Backend
+	key     *ecdsa.PrivateKey
+}
+
+func newSimulatedChain(t *testing.T) *simulatedChain {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	funds := new(big.Int).Exp(big.NewInt(10), big.NewInt(21), nil)
+	backend := simulated.NewBackend(types.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: funds}})
+	t.Cleanup(func() { backend.Close() })
+	return &simulatedChain{backend: backend, key: key}
+}
+
+// deploy creates a contract with the given runtime code, mines it and returns its address.
+func (c *simulatedChain) deploy(t *testing.T, runtime []byte) common.Address {
+	t.Helper()
+	ctx := context.Background()
+	client := c.backend.Client()
+	from := crypto.PubkeyToAddress(c.key.PublicKey)
+
+	// The 14-byte init code copies the runtime code that follows it and returns it.
+	size := len(runtime)
+	initCode := []byte{
+		byte(vm.PUSH2), byte(size >> 8), byte(size),
+		byte(vm.PUSH1), 14, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH2), byte(size >> 8), byte(size),
+		byte(vm.PUSH1), 0, byte(vm.RETURN),
+	}
+
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	nonce, err := client.PendingNonceAt(ctx, from)
+	require.NoError(t, err)
+	tip, err := client.SuggestGasTipCap(ctx)
+	require.NoError(t, err)
+	head, err := client.HeaderByNumber(ctx, nil)
+	require.NoError(t, err)
+	tx, err := types.SignNewTx(c.key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip),
+		Gas:       1_000_000,
+		Data:      append(initCode, runtime...),
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.SendTransaction(ctx, tx))
+	c.backend.Commit()
+
+	contract := crypto.CreateAddress(from, nonce)
+	code, err := client.CodeAt(ctx, contract, nil)
+	require.NoError(t, err)
+	require.Equal(t, runtime, code, "deployment failed")
+	return contract
+}
+
+// --- Unit Tests ---
+
+func TestChainResolver_ResolveMetadata(t *testing.T) {
+	t.Parallel()
+	caller := newFakeCaller()
+	caller.deploy(addr(1), abiString("USD Coin"), abiString("USDC"), abiUint(6))
+	caller.deploy(addr(2), abiBytes32("Maker"), abiBytes32("MKR"), abiUint(18))
+	caller.deploy(addr(3), nil, nil, abiUint(0))
+	caller.deploy(addr(4), abiString("No Decimals"), abiString("NOD"), nil)
+	caller.deploy(addr(5), abiString("Empty Decimals"), abiString("EMD"), []byte{})
+	caller.deploy(addr(6), abiString("Huge Decimals"), abiString("HUG"), abiUint(256))
+	caller.deploy(addr(7), []byte{0x01, 0x02}, abiString("ODD"), abiUint(8))
+	resolver := NewChainResolver(caller)
+
+	testCases := []struct {
+		name        string
+		address     common.Address
+		expected    TokenMetadata
+		expectedErr error
+	}{
+		{
+			name:     "Standard string encoding",
+			address:  addr(1),
+			expected: TokenMetadata{Address: addr(1), Name: "USD Coin", Symbol: "USDC", Decimals: 6},
+		},
+		{
+			name:     "Bytes32 encoding",
+			address:  addr(2),
+			expected: TokenMetadata{Address: addr(2), Name: "Maker", Symbol: "MKR", Decimals: 18},
+		},
+		{
+			name:     "Reverting name and symbol",
+			address:  addr(3),
+			expected: TokenMetadata{Address: addr(3)},
+		},
+		{
+			name:     "Undecodable name",
+			address:  addr(7),
+			expected: TokenMetadata{Address: addr(7), Symbol: "ODD", Decimals: 8},
+		},
+		{
+			name:        "Reverting decimals",
+			address:     addr(4),
+			expectedErr: ErrMissingDecimals,
+		},
+		{
+			name:        "Empty decimals",
+			address:     addr(5),
+			expectedErr: ErrMissingDecimals,
+		},
+		{
+			name:        "Out of range decimals",
+			address:     addr(6),
+			expectedErr: ErrInvalidMetadata,
+		},
+		{
+			name:        "No contract code",
+			address:     addr(99),
+			expectedErr: ErrNotContract,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meta, err := resolver.ResolveMetadata(context.Background(), tc.address)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, meta)
+		})
+	}
+}
+
+func TestChainResolver_SimulatedChain(t *testing.T) {
+	t.Parallel()
+	chain := newSimulatedChain(t)
+	standard := chain.deploy(t, metadataContract(map[string][]byte{
+		string(selectorName):     abiString("Wrapped Ether"),
+		string(selectorSymbol):   abiString("WETH"),
+		string(selectorDecimals): abiUint(18),
+	}))
+	bytes32 := chain.deploy(t, metadataContract(map[string][]byte{
+		string(selectorName):     abiBytes32("Maker"),
+		string(selectorSymbol):   abiBytes32("MKR"),
+		string(selectorDecimals): abiUint(18),
+	}))
+	anonymous := chain.deploy(t, metadataContract(map[string][]byte{
+		string(selectorDecimals): abiUint(6),
+	}))
+	noDecimals := chain.deploy(t, metadataContract(map[string][]byte{
+		string(selectorName):   abiString("No Decimals"),
+		string(selectorSymbol): abiString("NOD"),
+	}))
+	resolver := NewChainResolver(chain.backend.Client())
+
+	testCases := []struct {
+		name        string
+		address     common.Address
+		expected    TokenMetadata
+		expectedErr error
+	}{
+		{
+			name:     "Standard ERC-20",
+			address:  standard,
+			expected: TokenMetadata{Address: standard, Name: "Wrapped Ether", Symbol: "WETH", Decimals: 18},
+		},
+		{
+			name:     "Bytes32 symbol",
+			address:  bytes32,
+			expected: TokenMetadata{Address: bytes32, Name: "Maker", Symbol: "MKR", Decimals: 18},
+		},
+		{
+			name:     "Reverting name and symbol",
+			address:  anonymous,
+			expected: TokenMetadata{Address: anonymous, Decimals: 6},
+		},
+		{
+			name:        "Reverting decimals",
+			address:     noDecimals,
+			expectedErr: ErrMissingDecimals,
+		},
+		{
+			name:        "No contract code",
+			address:     crypto.PubkeyToAddress(chain.key.PublicKey),
+			expectedErr: ErrNotContract,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meta, err := resolver.ResolveMetadata(context.Background(), tc.address)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, meta)
+		})
+	}
+}
+
+func TestChainResolver_TransportError(t *testing.T) {
+	t.Parallel()
+	caller := newFakeCaller()
+	caller.deploy(addr(1), abiString("USD Coin"), abiString("USDC"), abiUint(6))
+	caller.err = errors.New("connection refused")
+
+	_, err := NewChainResolver(caller).ResolveMetadata(context.Background(), addr(1))
+	assert.ErrorIs(t, err, caller.err, "transport errors must not be mistaken for reverts")
+}
+
+func TestChainResolver_ServerError(t *testing.T) {
+	t.Parallel()
+	caller := newFakeCaller()
+	caller.deploy(addr(1), abiString("USD Coin"), abiString("USDC"), abiUint(6))
+	caller.contracts[addr(1)].errs[string(selectorName)] = serverError{"header not found"}
+
+	_, err := NewChainResolver(caller).ResolveMetadata(context.Background(), addr(1))
+	assert.ErrorIs(t, err, serverError{"header not found"}, "a lagging node must not read as a missing name")
+}
+
+func TestDecodeStringResult(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "", decodeStringResult(nil))
+	assert.Equal(t, "DAI", decodeStringResult(abiString("DAI")))
+	assert.Equal(t, "SAI", decodeStringResult(abiBytes32("SAI")))
+	assert.Equal(t, "a�b", decodeStringResult(abiString("a\xffb")), "invalid UTF-8 should be replaced")
+
+	// A length pointing past the end of the data is not a valid string.
+	malformed := abiString("DAI")
+	malformed[63] = 0xFF
+	assert.Equal(t, "", decodeStringResult(malformed))
+}
+
+func TestTokenSystem_AddTokenFromChain(t *testing.T) {
+	t.Parallel()
+	caller := newFakeCaller()
+	caller.deploy(addr(1), abiString("USD Coin"), abiString("USDC"), abiUint(6))
+	ts := NewTokenSystem(WithResolver(NewChainResolver(caller)))
+
+	id, err := ts.AddTokenFromChain(context.Background(), addr(1))
+	require.NoError(t, err)
+	view, err := ts.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, "USD Coin", view.Name)
+	assert.Equal(t, "USDC", view.Symbol)
+	assert.Equal(t, uint8(6), view.Decimals)
+
+	_, err = ts.AddTokenFromChain(context.Background(), addr(1))
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = ts.AddTokenFromChain(context.Background(), addr(2))
+	assert.ErrorIs(t, err, ErrNotContract)
+	assert.Len(t, ts.View(), 1)
+
+	_, err = NewTokenSystem().AddTokenFromChain(context.Background(), addr(1))
+	assert.ErrorIs(t, err, ErrNoResolver)
+}
@@ -0,0 +1,307 @@
+package token
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Snapshot layout (all integers little-endian):
+//
+//	magic       [4]byte  "IWTS"
+//	version     uint16
+//	payloadLen  uint64   number of payload bytes that follow
+//	payload:
+//	  count     uint64
+//	  nextID    uint64
+//	  address   [count][20]byte
+//	  name      [count](uint32 length, bytes)
+//	  symbol    [count](uint32 length, bytes)
+//	  decimals  [count]uint8
+//	  fee       [count]uint32 parts per million
+//	  gas       [count]uint64
+//	  id        [count]uint64
+//	  flags     [count]uint32
+//	  tombCount uint64
+//	  tombstone [tombCount]uint64
+//	checksum    uint32   CRC-32 (Castagnoli) of every preceding byte
+const (
+	snapshotMagic   = "IWTS"
+	snapshotVersion = uint16(1)
+
+	snapshotHeaderLen  = 4 + 2 + 8
+	snapshotTrailerLen = 4
+
+	// minTokenSnapshotLen is the smallest number of payload bytes a single token can occupy.
+	minTokenSnapshotLen = common.AddressLength + 4 + 4 + 1 + 4 + 8 + 8 + 4
+)
+
+var (
+	// ErrInvalidSnapshotMagic is returned when the input does not start with the snapshot magic header.
+	ErrInvalidSnapshotMagic = errors.New("invalid snapshot: bad magic header")
+	// ErrUnsupportedSnapshotVersion is returned when the snapshot was written by an unknown format version.
+	ErrUnsupportedSnapshotVersion = errors.New("invalid snapshot: unsupported format version")
+	// ErrSnapshotTruncated is returned when the input ends before the declared snapshot length.
+	ErrSnapshotTruncated = errors.New("invalid snapshot: truncated")
+	// ErrSnapshotChecksum is returned when the stored CRC does not match the snapshot contents.
+	ErrSnapshotChecksum = errors.New("invalid snapshot: checksum mismatch")
+	// ErrCorruptSnapshot is returned when a snapshot passes its checksum but its contents are inconsistent.
+	ErrCorruptSnapshot = errors.New("invalid snapshot: corrupt payload")
+)
+
+var snapshotCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WriteRegistrySnapshot encodes the registry's columns into the binary snapshot format.
+// The registry is not locked; callers sharing it between goroutines must synchronise access.
+func WriteRegistrySnapshot(w io.Writer, registry *TokenRegistry) error {
+	_, err := writeSnapshot(w, registry)
+	return err
+}
+
+// NewTokenRegistryFromSnapshot decodes a registry previously written by WriteRegistrySnapshot.
+// Malformed input is rejected with one of the ErrSnapshot* / ErrInvalidSnapshotMagic errors,
+// and the decoded tokens go through the same duplicate ID and address validation as
+// NewTokenRegistryFromViews.
+func NewTokenRegistryFromSnapshot(r io.Reader) (*TokenRegistry, error) {
+	registry, _, err := readSnapshot(r)
+	return registry, err
+}
+
+// writeSnapshot writes the snapshot and returns its checksum.
+func writeSnapshot(w io.Writer, registry *TokenRegistry) (uint32, error) {
+	count := len(registry.address)
+
+	payload := make([]byte, 0, 16+count*minTokenSnapshotLen)
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(count))
+	payload = binary.LittleEndian.AppendUint64(payload, registry.nextID)
+	for _, a := range registry.address {
+		payload = append(payload, a.Bytes()...)
+	}
+	for _, s := range registry.name {
+		payload = appendBinaryString(payload, s)
+	}
+	for _, s := range registry.symbol {
+		payload = appendBinaryString(payload, s)
+	}
+	payload = append(payload, registry.decimals...)
+	for _, f := range registry.feeOnTransferPPM {
+		payload = binary.LittleEndian.AppendUint32(payload, f)
+	}
+	for _, g := range registry.gasForTransfer {
+		payload = binary.LittleEndian.AppendUint64(payload, g)
+	}
+	for _, id := range registry.id {
+		payload = binary.LittleEndian.AppendUint64(payload, id)
+	}
+	for _, f := range registry.flags {
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(f))
+	}
+	state := exportRegistryState(registry)
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(len(state.Tombstones)))
+	for _, id := range state.Tombstones {
+		payload = binary.LittleEndian.AppendUint64(payload, id)
+	}
+
+	return writeSnapshotFrame(w, snapshotMagic, snapshotVersion, payload)
+}
+
+// writeSnapshotFrame writes payload between the snapshot header and checksum trailer and
+// returns the checksum. It is shared by every snapshot-style format; only the magic differs.
+func writeSnapshotFrame(w io.Writer, magic string, version uint16, payload []byte) (uint32, error) {
+	buf := make([]byte, 0, snapshotHeaderLen+len(payload)+snapshotTrailerLen)
+	buf = append(buf, magic...)
+	buf = binary.LittleEndian.AppendUint16(buf, version)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(payload)))
+	buf = append(buf, payload...)
+	checksum := crc32.Checksum(buf, snapshotCRCTable)
+	buf = binary.LittleEndian.AppendUint32(buf, checksum)
+
+	if _, err := w.Write(buf); err != nil {
+		return 0, err
+	}
+	return checksum, nil
+}
+
+// readSnapshot reads and validates a snapshot, returning the registry and its checksum.
+func readSnapshot(r io.Reader) (*TokenRegistry, uint32, error) {
+	payload, checksum, err := readSnapshotFrame(r, snapshotMagic, snapshotVersion)
+	if err != nil {
+		return nil, 0, err
+	}
+	registry, err := decodeSnapshotPayload(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	return registry, checksum, nil
+}
+
+// readSnapshotFrame reads a frame written by writeSnapshotFrame, verifying the magic,
+// version, length and checksum, and returns the payload.
+func readSnapshotFrame(r io.Reader, magic string, wantVersion uint16) ([]byte, uint32, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(data) < len(magic) {
+		return nil, 0, ErrSnapshotTruncated
+	}
+	if !bytes.Equal(data[:len(magic)], []byte(magic)) {
+		return nil, 0, ErrInvalidSnapshotMagic
+	}
+	if len(data) < snapshotHeaderLen {
+		return nil, 0, ErrSnapshotTruncated
+	}
+	version := binary.LittleEndian.Uint16(data[4:6])
+	if version != wantVersion {
+		return nil, 0, fmt.Errorf("%w: %d", ErrUnsupportedSnapshotVersion, version)
+	}
+
+	payloadLen := binary.LittleEndian.Uint64(data[6:snapshotHeaderLen])
+	available := uint64(len(data) - snapshotHeaderLen)
+	if available < snapshotTrailerLen || payloadLen > available-snapshotTrailerLen {
+		return nil, 0, ErrSnapshotTruncated
+	}
+	if payloadLen != available-snapshotTrailerLen {
+		return nil, 0, fmt.Errorf("%w: %d trailing bytes", ErrCorruptSnapshot, available-snapshotTrailerLen-payloadLen)
+	}
+
+	end := snapshotHeaderLen + int(payloadLen)
+	checksum := binary.LittleEndian.Uint32(data[end:])
+	if crc32.Checksum(data[:end], snapshotCRCTable) != checksum {
+		return nil, 0, ErrSnapshotChecksum
+	}
+	return data[snapshotHeaderLen:end], checksum, nil
+}
+
+// decodeSnapshotPayload rebuilds the registry from a checksum-verified payload.
+func decodeSnapshotPayload(payload []byte) (*TokenRegistry, error) {
+	d := &binaryDecoder{buf: payload, errCorrupt: ErrCorruptSnapshot}
+	count := d.uint64()
+	nextID := d.uint64()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if count > uint64(len(d.buf))/minTokenSnapshotLen {
+		return nil, fmt.Errorf("%w: token count %d exceeds payload size", ErrCorruptSnapshot, count)
+	}
+
+	views := make([]TokenView, count)
+	for i := range views {
+		copy(views[i].Address[:], d.bytes(common.AddressLength))
+	}
+	for i := range views {
+		views[i].Name = d.string()
+	}
+	for i := range views {
+		views[i].Symbol = d.string()
+	}
+	for i := range views {
+		views[i].Decimals = d.uint8()
+	}
+	for i := range views {
+		views[i].FeeOnTransferPPM = d.uint32()
+	}
+	for i := range views {
+		views[i].GasForTransfer = d.uint64()
+	}
+	for i := range views {
+		views[i].ID = d.uint64()
+	}
+	for i := range views {
+		views[i].Flags = RiskFlags(d.uint32())
+	}
+	tombCount := d.uint64()
+	if tombCount > uint64(len(d.buf))/8 {
+		return nil, fmt.Errorf("%w: tombstone count %d exceeds payload size", ErrCorruptSnapshot, tombCount)
+	}
+	tombstones := make([]uint64, tombCount)
+	for i := range tombstones {
+		tombstones[i] = d.uint64()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.buf) != 0 {
+		return nil, fmt.Errorf("%w: %d unread payload bytes", ErrCorruptSnapshot, len(d.buf))
+	}
+	if nextID == 0 {
+		return nil, fmt.Errorf("%w: nextID is zero", ErrCorruptSnapshot)
+	}
+
+	registry, err := NewTokenRegistryFromState(RegistryState{
+		Tokens:     views,
+		NextID:     nextID,
+		Tombstones: tombstones,
+	})
+	if errors.Is(err, ErrInvalidNextID) || errors.Is(err, ErrInvalidFeeRate) {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptSnapshot, err)
+	}
+	return registry, err
+}
+
+func appendBinaryString(buf []byte, s string) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+// binaryDecoder consumes a payload front to back, latching the first error so that
+// column loops do not need to check after every field. Running out of bytes is reported
+// by wrapping errCorrupt.
+type binaryDecoder struct {
+	buf        []byte
+	err        error
+	errCorrupt error
+}
+
+func (d *binaryDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = fmt.Errorf("%w: payload ends mid-field", d.errCorrupt)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *binaryDecoder) uint8() uint8 {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *binaryDecoder) uint32() uint32 {
+	b := d.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *binaryDecoder) uint64() uint64 {
+	b := d.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// string reads a length-prefixed string. The length is checked against the bytes left
+// before it is converted to int, which could wrap on 32-bit platforms.
+func (d *binaryDecoder) string() string {
+	n := d.uint32()
+	if d.err == nil && uint64(n) > uint64(len(d.buf)) {
+		d.err = fmt.Errorf("%w: string of %d bytes exceeds payload size", d.errCorrupt, n)
+	}
+	return string(d.bytes(int(n)))
+}
@@ -0,0 +1,187 @@
+package token
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeTestSnapshot writes the standard test registry, after a deletion and an update,
+// and returns the encoded bytes alongside the source registry.
+func encodeTestSnapshot(t *testing.T) ([]byte, *TokenRegistry) {
+	registry, ids := newTestRegistry(t)
+	require.NoError(t, updateToken(ids[2], 12_500, 65000, registry))
+	require.NoError(t, setTokenFlags(ids[1], FlagRebasing|FlagHoneypot, registry))
+	require.NoError(t, deleteToken(ids[3], registry)) // Delete the highest ID
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRegistrySnapshot(&buf, registry))
+	return buf.Bytes(), registry
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	t.Parallel()
+	data, original := encodeTestSnapshot(t)
+
+	restored, err := NewTokenRegistryFromSnapshot(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	assert.Equal(t, viewRegistry(original), viewRegistry(restored))
+	assert.Equal(t, original.nextID, restored.nextID, "nextID must survive even though the highest ID was deleted")
+
+	view, err := getTokenByAddress(addr(3), restored)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(12_500), view.FeeOnTransferPPM)
+	assert.Equal(t, uint64(65000), view.GasForTransfer)
+}
+
+func TestSnapshot_Tombstones(t *testing.T) {
+	t.Parallel()
+	data, original := encodeTestSnapshot(t)
+
+	restored, err := NewTokenRegistryFromSnapshot(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, original.tombstones, restored.tombstones)
+}
+
+func TestSnapshot_RejectsFeeAbove100Percent(t *testing.T) {
+	t.Parallel()
+	registry, _ := newTestRegistry(t)
+	registry.feeOnTransferPPM[0] = FeeDenominator + 1 // Bypasses updateToken's validation
+	var buf bytes.Buffer
+	require.NoError(t, WriteRegistrySnapshot(&buf, registry))
+
+	_, err := NewTokenRegistryFromSnapshot(&buf)
+	assert.ErrorIs(t, err, ErrCorruptSnapshot)
+	assert.ErrorIs(t, err, ErrInvalidFeeRate)
+}
+
+func TestSnapshot_EmptyRegistry(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	require.NoError(t, WriteRegistrySnapshot(&buf, NewTokenRegistry()))
+
+	restored, err := NewTokenRegistryFromSnapshot(&buf)
+	require.NoError(t, err)
+	assert.Empty(t, restored.address)
+	assert.Equal(t, uint64(1), restored.nextID)
+}
+
+func TestSnapshot_Rejects(t *testing.T) {
+	t.Parallel()
+	data, _ := encodeTestSnapshot(t)
+
+	testCases := []struct {
+		name        string
+		mutate      func(b []byte) []byte
+		expectedErr error
+	}{
+		{
+			name:        "Empty input",
+			mutate:      func(b []byte) []byte { return nil },
+			expectedErr: ErrSnapshotTruncated,
+		},
+		{
+			name: "Bad magic",
+			mutate: func(b []byte) []byte {
+				b[0] = 'X'
+				return b
+			},
+			expectedErr: ErrInvalidSnapshotMagic,
+		},
+		{
+			name: "Unknown version",
+			mutate: func(b []byte) []byte {
+				binary.LittleEndian.PutUint16(b[4:6], 99)
+				return b
+			},
+			expectedErr: ErrUnsupportedSnapshotVersion,
+		},
+		{
+			name:        "Truncated payload",
+			mutate:      func(b []byte) []byte { return b[:len(b)-10] },
+			expectedErr: ErrSnapshotTruncated,
+		},
+		{
+			name:        "Trailing bytes",
+			mutate:      func(b []byte) []byte { return append(b, 0, 0) },
+			expectedErr: ErrCorruptSnapshot,
+		},
+		{
+			name: "Flipped payload bit",
+			mutate: func(b []byte) []byte {
+				b[snapshotHeaderLen+20] ^= 0x01
+				return b
+			},
+			expectedErr: ErrSnapshotChecksum,
+		},
+		{
+			name: "String length beyond payload",
+			mutate: func(b []byte) []byte {
+				count := binary.LittleEndian.Uint64(b[snapshotHeaderLen:])
+				nameLen := snapshotHeaderLen + 16 + int(count)*common.AddressLength
+				binary.LittleEndian.PutUint32(b[nameLen:], math.MaxUint32)
+				end := len(b) - snapshotTrailerLen
+				binary.LittleEndian.PutUint32(b[end:], crc32.Checksum(b[:end], snapshotCRCTable))
+				return b
+			},
+			expectedErr: ErrCorruptSnapshot,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			corrupted := tc.mutate(bytes.Clone(data))
+			registry, err := NewTokenRegistryFromSnapshot(bytes.NewReader(corrupted))
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Nil(t, registry)
+		})
+	}
+}
+
+func TestTokenSystem_Snapshot(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	idA, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	idB, err := ts.AddToken(addr(2), "Token B", "TKB", 6)
+	require.NoError(t, err)
+	require.NoError(t, ts.DeleteToken(idB))
+
+	var buf bytes.Buffer
+	require.NoError(t, ts.WriteSnapshot(&buf))
+
+	restored, err := NewTokenSystemFromSnapshot(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, ts.View(), restored.View())
+
+	view, err := restored.GetTokenByID(idA)
+	require.NoError(t, err)
+	assert.Equal(t, "Token A", view.Name)
+
+	// The deleted ID must not be handed out again after a reload.
+	idC, err := restored.AddToken(addr(3), "Token C", "TKC", 18)
+	require.NoError(t, err)
+	assert.Greater(t, idC, idB)
+}
+
+func BenchmarkWriteSnapshot(b *testing.B) {
+	registry := NewTokenRegistry()
+	for j := 0; j < 10000; j++ {
+		a := addr(byte(j))
+		a[1] = byte(j >> 8)
+		addToken(a, "bench", "B", 18, registry)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		WriteRegistrySnapshot(&buf, registry)
+	}
+}
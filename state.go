@@ -0,0 +1,72 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrIDReused is returned by NewTokenRegistryFromState when a view uses the ID of a deleted token.
+	ErrIDReused = errors.New("invalid state: token ID was previously deleted")
+	// ErrInvalidNextID is returned by NewTokenRegistryFromState when NextID does not exceed every known ID.
+	ErrInvalidNextID = errors.New("invalid state: nextID must exceed every token and tombstone ID")
+)
+
+// RegistryState is a complete, serialisable export of a TokenRegistry. Unlike a plain
+// []TokenView it retains the ID high-water mark and the IDs of deleted tokens, so a
+// registry rebuilt from it never reissues an ID that was handed out before.
+type RegistryState struct {
+	Tokens     []TokenView `json:"tokens"`
+	NextID     uint64      `json:"nextId"`
+	Tombstones []uint64    `json:"tombstones,omitempty"`
+}
+
+// NewTokenRegistryFromState reconstructs a TokenRegistry from an exported RegistryState.
+// In addition to the checks performed by NewTokenRegistryFromViews, it rejects views that
+// reuse a tombstoned ID (ErrIDReused) and a NextID that does not exceed every live and
+// tombstoned ID (ErrInvalidNextID). A zero NextID is treated as unset and derived from
+// the highest known ID.
+func NewTokenRegistryFromState(state RegistryState) (*TokenRegistry, error) {
+	registry, err := NewTokenRegistryFromViews(state.Tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	highest := registry.nextID - 1
+	for _, id := range state.Tombstones {
+		if _, live := registry.idToIndex[id]; live {
+			return nil, fmt.Errorf("%w: %d", ErrIDReused, id)
+		}
+		registry.tombstones[id] = struct{}{}
+		if id > highest {
+			highest = id
+		}
+	}
+
+	switch {
+	case state.NextID == 0:
+		registry.nextID = highest + 1
+	case state.NextID <= highest:
+		return nil, fmt.Errorf("%w: nextID %d, highest ID %d", ErrInvalidNextID, state.NextID, highest)
+	default:
+		registry.nextID = state.NextID
+	}
+	return registry, nil
+}
+
+// exportRegistryState returns a RegistryState capturing the registry's tokens, ID
+// high-water mark and tombstones. Tombstones are sorted for deterministic output.
+func exportRegistryState(registry *TokenRegistry) RegistryState {
+	tombstones := make([]uint64, 0, len(registry.tombstones))
+	for id := range registry.tombstones {
+		tombstones = append(tombstones, id)
+	}
+	slices.Sort(tombstones)
+
+	return RegistryState{
+		Tokens:     viewRegistry(registry),
+		NextID:     registry.nextID,
+		Tombstones: tombstones,
+	}
+}
@@ -0,0 +1,96 @@
+package token
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteToken_RecordsTombstone(t *testing.T) {
+	t.Parallel()
+	registry, ids := newTestRegistry(t)
+
+	require.NoError(t, deleteToken(ids[3], registry))
+	assert.Contains(t, registry.tombstones, ids[3])
+	assert.Len(t, registry.tombstones, 1)
+}
+
+func TestNewTokenRegistryFromState(t *testing.T) {
+	t.Parallel()
+	t.Run("RoundTripKeepsHighWaterMark", func(t *testing.T) {
+		registry, ids := newTestRegistry(t)
+		require.NoError(t, deleteToken(ids[3], registry)) // Delete the highest ID
+
+		state := exportRegistryState(registry)
+		assert.Equal(t, uint64(5), state.NextID)
+		assert.Equal(t, []uint64{ids[3]}, state.Tombstones)
+
+		restored, err := NewTokenRegistryFromState(state)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), restored.nextID)
+
+		id, err := addToken(addr(9), "Token I", "TKI", 18, restored)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), id, "a deleted ID must never be reissued")
+	})
+
+	t.Run("ZeroNextIDIsDerived", func(t *testing.T) {
+		registry, err := NewTokenRegistryFromState(RegistryState{
+			Tokens:     []TokenView{{ID: 2, Address: addr(2)}},
+			Tombstones: []uint64{7},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(8), registry.nextID)
+	})
+
+	t.Run("FailureOnReusedID", func(t *testing.T) {
+		_, err := NewTokenRegistryFromState(RegistryState{
+			Tokens:     []TokenView{{ID: 1, Address: addr(1)}, {ID: 3, Address: addr(3)}},
+			NextID:     4,
+			Tombstones: []uint64{2, 3},
+		})
+		assert.ErrorIs(t, err, ErrIDReused)
+	})
+
+	t.Run("FailureOnStaleNextID", func(t *testing.T) {
+		_, err := NewTokenRegistryFromState(RegistryState{
+			Tokens:     []TokenView{{ID: 1, Address: addr(1)}},
+			NextID:     3,
+			Tombstones: []uint64{5},
+		})
+		assert.ErrorIs(t, err, ErrInvalidNextID)
+	})
+
+	t.Run("FailureOnInvalidViews", func(t *testing.T) {
+		_, err := NewTokenRegistryFromState(RegistryState{
+			Tokens: []TokenView{{ID: 1, Address: addr(1)}, {ID: 2, Address: addr(1)}},
+		})
+		assert.ErrorIs(t, err, ErrDuplicateAddress)
+	})
+}
+
+func TestTokenSystem_State(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	_, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	idB, err := ts.AddToken(addr(2), "Token B", "TKB", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.DeleteToken(idB))
+
+	// The state must survive a JSON round trip, which is how most callers persist it.
+	encoded, err := json.Marshal(ts.State())
+	require.NoError(t, err)
+	var decoded RegistryState
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+
+	restored, err := NewTokenSystemFromState(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, ts.View(), restored.View())
+
+	idC, err := restored.AddToken(addr(3), "Token C", "TKC", 18)
+	require.NoError(t, err)
+	assert.Greater(t, idC, idB)
+}
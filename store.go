@@ -0,0 +1,338 @@
+package token
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrReadOnly is returned by every mutation of a ReadOnlyStore.
+var ErrReadOnly = errors.New("token store is read-only")
+
+// TokenStore is the registry interface shared by TokenSystem, remote clients and the
+// decorators in this file, so that callers can be given a mock, a wrapped system or a
+// remote one in place of a TokenSystem.
+type TokenStore interface {
+	AddToken(addr common.Address, name, symbol string, decimals uint8) (uint64, error)
+	DeleteToken(id uint64) error
+	UpdateTokenPPM(id uint64, feePPM uint32, gas uint64) error
+	GetTokenByID(id uint64) (TokenView, error)
+	GetTokenByAddress(addr common.Address) (TokenView, error)
+	View() []TokenView
+}
+
+var _ TokenStore = (*TokenSystem)(nil)
+
+// ReadOnlyStore passes lookups through to a TokenStore and refuses every mutation with
+// ErrReadOnly.
+type ReadOnlyStore struct {
+	store TokenStore
+}
+
+var _ TokenStore = (*ReadOnlyStore)(nil)
+
+// NewReadOnlyStore returns a read-only view of store.
+func NewReadOnlyStore(store TokenStore) *ReadOnlyStore {
+	return &ReadOnlyStore{store: store}
+}
+
+// AddToken returns ErrReadOnly.
+func (s *ReadOnlyStore) AddToken(common.Address, string, string, uint8) (uint64, error) {
+	return 0, ErrReadOnly
+}
+
+// DeleteToken returns ErrReadOnly.
+func (s *ReadOnlyStore) DeleteToken(uint64) error {
+	return ErrReadOnly
+}
+
+// UpdateTokenPPM returns ErrReadOnly.
+func (s *ReadOnlyStore) UpdateTokenPPM(uint64, uint32, uint64) error {
+	return ErrReadOnly
+}
+
+// GetTokenByID looks up a token in the underlying store.
+func (s *ReadOnlyStore) GetTokenByID(id uint64) (TokenView, error) {
+	return s.store.GetTokenByID(id)
+}
+
+// GetTokenByAddress looks up a token in the underlying store.
+func (s *ReadOnlyStore) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	return s.store.GetTokenByAddress(addr)
+}
+
+// View returns every token in the underlying store.
+func (s *ReadOnlyStore) View() []TokenView {
+	return s.store.View()
+}
+
+// LoggingStore logs every call to a TokenStore. Mutations are logged at Info level and
+// lookups at Debug level, each with its arguments and duration; failures are logged at
+// Warn level with the error.
+type LoggingStore struct {
+	store  TokenStore
+	logger *slog.Logger
+}
+
+var _ TokenStore = (*LoggingStore)(nil)
+
+// NewLoggingStore returns store logging to logger. A nil logger uses slog.Default().
+func NewLoggingStore(store TokenStore, logger *slog.Logger) *LoggingStore {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LoggingStore{store: store, logger: logger}
+}
+
+// log records one call that started at start.
+func (s *LoggingStore) log(level slog.Level, op string, start time.Time, err error, attrs ...any) {
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		s.logger.Warn("token store: "+op+" failed", append(attrs, slog.Any("err", err))...)
+		return
+	}
+	s.logger.Log(context.Background(), level, "token store: "+op, attrs...)
+}
+
+// AddToken adds a token and logs the call.
+func (s *LoggingStore) AddToken(addr common.Address, name, symbol string, decimals uint8) (uint64, error) {
+	start := time.Now()
+	id, err := s.store.AddToken(addr, name, symbol, decimals)
+	s.log(slog.LevelInfo, "add", start, err,
+		slog.String("address", addr.Hex()), slog.String("symbol", symbol), slog.Uint64("id", id))
+	return id, err
+}
+
+// DeleteToken removes a token and logs the call.
+func (s *LoggingStore) DeleteToken(id uint64) error {
+	start := time.Now()
+	err := s.store.DeleteToken(id)
+	s.log(slog.LevelInfo, "delete", start, err, slog.Uint64("id", id))
+	return err
+}
+
+// UpdateTokenPPM updates a token and logs the call.
+func (s *LoggingStore) UpdateTokenPPM(id uint64, feePPM uint32, gas uint64) error {
+	start := time.Now()
+	err := s.store.UpdateTokenPPM(id, feePPM, gas)
+	s.log(slog.LevelInfo, "update", start, err,
+		slog.Uint64("id", id), slog.Uint64("feePPM", uint64(feePPM)), slog.Uint64("gas", gas))
+	return err
+}
+
+// GetTokenByID looks up a token and logs the call.
+func (s *LoggingStore) GetTokenByID(id uint64) (TokenView, error) {
+	start := time.Now()
+	view, err := s.store.GetTokenByID(id)
+	s.log(slog.LevelDebug, "get by ID", start, err, slog.Uint64("id", id))
+	return view, err
+}
+
+// GetTokenByAddress looks up a token and logs the call.
+func (s *LoggingStore) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	start := time.Now()
+	view, err := s.store.GetTokenByAddress(addr)
+	s.log(slog.LevelDebug, "get by address", start, err, slog.String("address", addr.Hex()))
+	return view, err
+}
+
+// View returns every token and logs the call.
+func (s *LoggingStore) View() []TokenView {
+	start := time.Now()
+	views := s.store.View()
+	s.log(slog.LevelDebug, "view", start, nil, slog.Int("tokens", len(views)))
+	return views
+}
+
+// DefaultCacheSize is the number of tokens a CachingStore holds when
+// CacheOptions.MaxEntries is zero.
+const DefaultCacheSize = 10_000
+
+// CacheOptions configures a CachingStore.
+type CacheOptions struct {
+	// MaxEntries caps the number of cached tokens; the least recently used is evicted
+	// first. Zero means DefaultCacheSize.
+	MaxEntries int
+	// TTL is how long a cached token is served before it is fetched again. Zero means
+	// entries do not expire, which is only safe when every change goes through the cache.
+	TTL time.Duration
+}
+
+// CachingStore is a read-through cache in front of a TokenStore, typically a remote one.
+// GetTokenByID and GetTokenByAddress serve cached tokens and fetch misses from the
+// underlying store; failed lookups are not cached. Changes made through the cache evict
+// the affected token. Changes made directly to the underlying store are seen once the
+// cached entry expires, so set CacheOptions.TTL to the staleness callers can tolerate.
+// View is never cached.
+type CachingStore struct {
+	store TokenStore
+	opts  CacheOptions
+	now   func() time.Time // Replaced in tests
+
+	mu        sync.Mutex
+	lru       *list.List // Of *cacheEntry, most recently used first
+	byID      map[uint64]*list.Element
+	byAddress map[common.Address]*list.Element
+	// epoch counts evictions. A miss records it before fetching and only caches the
+	// result if no eviction happened meanwhile, since the fetch may have returned the
+	// token as it was before the write that caused the eviction.
+	epoch uint64
+}
+
+var _ TokenStore = (*CachingStore)(nil)
+
+// cacheEntry is one cached token.
+type cacheEntry struct {
+	view    TokenView
+	expires time.Time // Zero if the entry does not expire
+}
+
+// NewCachingStore returns a cache in front of store.
+func NewCachingStore(store TokenStore, opts CacheOptions) *CachingStore {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultCacheSize
+	}
+	return &CachingStore{
+		store:     store,
+		opts:      opts,
+		now:       time.Now,
+		lru:       list.New(),
+		byID:      make(map[uint64]*list.Element),
+		byAddress: make(map[common.Address]*list.Element),
+	}
+}
+
+// lookup returns the live cached entry in elem, if any, and marks it recently used.
+// Callers must hold mu.
+func (s *CachingStore) lookup(elem *list.Element) (TokenView, bool) {
+	if elem == nil {
+		return TokenView{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && !s.now().Before(entry.expires) {
+		s.remove(elem)
+		return TokenView{}, false
+	}
+	s.lru.MoveToFront(elem)
+	return entry.view, true
+}
+
+// put caches view, replacing any entry for the same ID or address, unless the cache has
+// evicted anything since epoch.
+func (s *CachingStore) put(view TokenView, epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.epoch != epoch {
+		return
+	}
+	s.remove(s.byID[view.ID])
+	s.remove(s.byAddress[view.Address])
+
+	entry := &cacheEntry{view: view}
+	if s.opts.TTL > 0 {
+		entry.expires = s.now().Add(s.opts.TTL)
+	}
+	elem := s.lru.PushFront(entry)
+	s.byID[view.ID] = elem
+	s.byAddress[view.Address] = elem
+	for s.lru.Len() > s.opts.MaxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove drops the entry in elem, if any. Callers must hold mu.
+func (s *CachingStore) remove(elem *list.Element) {
+	if elem == nil {
+		return
+	}
+	entry := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.byID, entry.view.ID)
+	delete(s.byAddress, entry.view.Address)
+}
+
+// evict drops the cached token with the given ID.
+func (s *CachingStore) evict(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch++
+	s.remove(s.byID[id])
+}
+
+// Purge empties the cache.
+func (s *CachingStore) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch++
+	s.lru.Init()
+	clear(s.byID)
+	clear(s.byAddress)
+}
+
+// Len returns the number of cached tokens, including expired ones not yet evicted.
+func (s *CachingStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// AddToken adds a token to the underlying store.
+func (s *CachingStore) AddToken(addr common.Address, name, symbol string, decimals uint8) (uint64, error) {
+	return s.store.AddToken(addr, name, symbol, decimals)
+}
+
+// DeleteToken removes a token from the underlying store and the cache.
+func (s *CachingStore) DeleteToken(id uint64) error {
+	// Evict even on failure: the token may have been deleted by someone else.
+	defer s.evict(id)
+	return s.store.DeleteToken(id)
+}
+
+// UpdateTokenPPM updates a token in the underlying store and evicts it from the cache.
+func (s *CachingStore) UpdateTokenPPM(id uint64, feePPM uint32, gas uint64) error {
+	defer s.evict(id)
+	return s.store.UpdateTokenPPM(id, feePPM, gas)
+}
+
+// GetTokenByID returns the cached token, fetching it on a miss.
+func (s *CachingStore) GetTokenByID(id uint64) (TokenView, error) {
+	s.mu.Lock()
+	view, ok := s.lookup(s.byID[id])
+	epoch := s.epoch
+	s.mu.Unlock()
+	if ok {
+		return view, nil
+	}
+	view, err := s.store.GetTokenByID(id)
+	if err != nil {
+		return TokenView{}, err
+	}
+	s.put(view, epoch)
+	return view, nil
+}
+
+// GetTokenByAddress returns the cached token, fetching it on a miss.
+func (s *CachingStore) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	s.mu.Lock()
+	view, ok := s.lookup(s.byAddress[addr])
+	epoch := s.epoch
+	s.mu.Unlock()
+	if ok {
+		return view, nil
+	}
+	view, err := s.store.GetTokenByAddress(addr)
+	if err != nil {
+		return TokenView{}, err
+	}
+	s.put(view, epoch)
+	return view, nil
+}
+
+// View returns every token from the underlying store.
+func (s *CachingStore) View() []TokenView {
+	return s.store.View()
+}
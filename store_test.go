@@ -0,0 +1,287 @@
+package token
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// countingStore is a TokenStore that counts lookups reaching the wrapped store.
+type countingStore struct {
+	TokenStore
+	byID, byAddress int
+}
+
+func (s *countingStore) GetTokenByID(id uint64) (TokenView, error) {
+	s.byID++
+	return s.TokenStore.GetTokenByID(id)
+}
+
+func (s *countingStore) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	s.byAddress++
+	return s.TokenStore.GetTokenByAddress(addr)
+}
+
+// newCountingStore returns a counting store around a TokenSystem with three tokens.
+func newCountingStore(t *testing.T) (*countingStore, *TokenSystem) {
+	ts := NewTokenSystem()
+	for i := byte(1); i <= 3; i++ {
+		_, err := ts.AddToken(addr(i), "Token", "TKN", 18)
+		require.NoError(t, err)
+	}
+	return &countingStore{TokenStore: ts}, ts
+}
+
+// racingStore is a TokenStore that runs onFetch after each lookup has read the wrapped
+// store but before it returns, to interleave a write with a cache miss.
+type racingStore struct {
+	TokenStore
+	onFetch func()
+}
+
+func (s *racingStore) GetTokenByID(id uint64) (TokenView, error) {
+	view, err := s.TokenStore.GetTokenByID(id)
+	if s.onFetch != nil {
+		s.onFetch()
+	}
+	return view, err
+}
+
+func (s *racingStore) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	view, err := s.TokenStore.GetTokenByAddress(addr)
+	if s.onFetch != nil {
+		s.onFetch()
+	}
+	return view, err
+}
+
+// --- Unit Tests ---
+
+func TestReadOnlyStore(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	id, err := ts.AddToken(addr(1), "Token", "TKN", 18)
+	require.NoError(t, err)
+	var store TokenStore = NewReadOnlyStore(ts)
+
+	_, err = store.AddToken(addr(2), "Token", "TKN", 18)
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.ErrorIs(t, store.UpdateTokenPPM(id, 1, 1), ErrReadOnly)
+	assert.ErrorIs(t, store.DeleteToken(id), ErrReadOnly)
+	assert.Len(t, ts.View(), 1, "the wrapped store is unchanged")
+
+	view, err := store.GetTokenByAddress(addr(1))
+	require.NoError(t, err)
+	assert.Equal(t, id, view.ID)
+	_, err = store.GetTokenByID(id + 1)
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	assert.Equal(t, ts.View(), store.View())
+}
+
+func TestLoggingStore(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	var store TokenStore = NewLoggingStore(NewTokenSystem(), logger)
+
+	id, err := store.AddToken(addr(1), "Token", "TKN", 18)
+	require.NoError(t, err)
+	_, err = store.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.DeleteToken(id+1), ErrTokenNotFound, "errors pass through unchanged")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, "lookups are logged at Debug level")
+	assert.Contains(t, lines[0], "level=INFO")
+	assert.Contains(t, lines[0], `msg="token store: add"`)
+	assert.Contains(t, lines[0], "address="+addr(1).Hex())
+	assert.Contains(t, lines[0], "id=1")
+	assert.Contains(t, lines[1], "level=WARN")
+	assert.Contains(t, lines[1], `msg="token store: delete failed"`)
+	assert.Contains(t, lines[1], `err="token not found`)
+}
+
+func TestCachingStore_ReadThrough(t *testing.T) {
+	t.Parallel()
+	backing, _ := newCountingStore(t)
+	cache := NewCachingStore(backing, CacheOptions{})
+
+	for range 3 {
+		view, err := cache.GetTokenByID(2)
+		require.NoError(t, err)
+		assert.Equal(t, addr(2), view.Address)
+	}
+	assert.Equal(t, 1, backing.byID)
+
+	// A token cached by ID is also served by address, and the other way round.
+	_, err := cache.GetTokenByAddress(addr(2))
+	require.NoError(t, err)
+	_, err = cache.GetTokenByAddress(addr(3))
+	require.NoError(t, err)
+	_, err = cache.GetTokenByID(3)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backing.byID)
+	assert.Equal(t, 1, backing.byAddress)
+
+	// Failed lookups are not cached.
+	for range 2 {
+		_, err = cache.GetTokenByID(99)
+		assert.ErrorIs(t, err, ErrTokenNotFound)
+	}
+	assert.Equal(t, 3, backing.byID)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Purge()
+	assert.Zero(t, cache.Len())
+	_, err = cache.GetTokenByID(2)
+	require.NoError(t, err)
+	assert.Equal(t, 4, backing.byID)
+}
+
+func TestCachingStore_WritesEvict(t *testing.T) {
+	t.Parallel()
+	backing, ts := newCountingStore(t)
+	cache := NewCachingStore(backing, CacheOptions{})
+
+	_, err := cache.GetTokenByID(1)
+	require.NoError(t, err)
+	require.NoError(t, cache.UpdateTokenPPM(1, 500, 25_000))
+	view, err := cache.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(500), view.FeeOnTransferPPM, "an update through the cache is seen at once")
+
+	require.NoError(t, cache.DeleteToken(1))
+	_, err = cache.GetTokenByAddress(addr(1))
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	// A token deleted behind the cache's back and re-added at the same address gets a new
+	// ID; the stale entry for the address is replaced rather than left to shadow it.
+	_, err = cache.GetTokenByID(2)
+	require.NoError(t, err)
+	require.NoError(t, ts.DeleteToken(2))
+	id, err := ts.AddToken(addr(2), "Token", "TKN", 18)
+	require.NoError(t, err)
+	view, err = cache.GetTokenByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, addr(2), view.Address)
+	view, err = cache.GetTokenByAddress(addr(2))
+	require.NoError(t, err)
+	assert.Equal(t, id, view.ID)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestCachingStore_MissRacingEviction(t *testing.T) {
+	t.Parallel()
+	_, ts := newCountingStore(t)
+	backing := &racingStore{TokenStore: ts}
+	cache := NewCachingStore(backing, CacheOptions{})
+
+	// The miss fetches the token, then an update evicts it before the miss fills the cache.
+	backing.onFetch = func() {
+		backing.onFetch = nil
+		require.NoError(t, cache.UpdateTokenPPM(1, 500, 25_000))
+	}
+	view, err := cache.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Zero(t, view.FeeOnTransferPPM, "the miss returns what it fetched")
+	assert.Zero(t, cache.Len(), "but does not cache it")
+	view, err = cache.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(500), view.FeeOnTransferPPM)
+
+	// Likewise a delete racing a miss by address.
+	backing.onFetch = func() {
+		backing.onFetch = nil
+		require.NoError(t, cache.DeleteToken(2))
+	}
+	_, err = cache.GetTokenByAddress(addr(2))
+	require.NoError(t, err)
+	_, err = cache.GetTokenByAddress(addr(2))
+	assert.ErrorIs(t, err, ErrTokenNotFound, "a deleted token is not served from the cache")
+}
+
+func TestCachingStore_TTL(t *testing.T) {
+	t.Parallel()
+	backing, ts := newCountingStore(t)
+	cache := NewCachingStore(backing, CacheOptions{TTL: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+	cache.now = func() time.Time { return now }
+
+	_, err := cache.GetTokenByID(1)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(1, 700, 0))
+
+	now = now.Add(59 * time.Second)
+	view, err := cache.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Zero(t, view.FeeOnTransferPPM, "a change behind the cache is not seen before the TTL")
+
+	now = now.Add(time.Second)
+	view, err = cache.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(700), view.FeeOnTransferPPM)
+	assert.Equal(t, 2, backing.byID)
+}
+
+func TestCachingStore_LRU(t *testing.T) {
+	t.Parallel()
+	backing, _ := newCountingStore(t)
+	cache := NewCachingStore(backing, CacheOptions{MaxEntries: 2})
+
+	for _, id := range []uint64{1, 2, 1, 3} {
+		_, err := cache.GetTokenByID(id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, 3, backing.byID)
+
+	// Token 2 was least recently used when 3 was added.
+	for _, id := range []uint64{1, 3, 2} {
+		_, err := cache.GetTokenByID(id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, backing.byID)
+}
+
+func TestDecorators_Compose(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	ts := NewTokenSystem()
+	store := NewReadOnlyStore(NewCachingStore(NewLoggingStore(ts, logger), CacheOptions{}))
+
+	_, err := store.AddToken(addr(1), "Token", "TKN", 18)
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.Empty(t, buf.String(), "a refused mutation never reaches the inner stores")
+	assert.Empty(t, ts.View())
+}
+
+// --- Benchmarking ---
+
+func BenchmarkCachingStore_GetTokenByAddress(b *testing.B) {
+	ts := NewTokenSystem()
+	for i := 1; i <= 1_000; i++ {
+		a := addr(0)
+		a[0] = byte(i / 256)
+		a[1] = byte(i % 256)
+		_, _ = ts.AddToken(a, "bench", "B", 18)
+	}
+	cache := NewCachingStore(ts, CacheOptions{TTL: time.Minute})
+	target := addr(0)
+	target[1] = 100
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.GetTokenByAddress(target); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
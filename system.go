@@ -1,7 +1,9 @@
 package token
 
 import (
+	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -9,26 +11,106 @@ import (
 // TokenSystem provides a concurrency-safe layer for managing the TokenRegistry.
 // It uses a sync.RWMutex to protect a single instance of the registry, allowing
 // for multiple concurrent reads when no writes are active.
+//
+// With WithLockFreeReads, the hot read paths instead load an immutable registry
+// through an atomic pointer and never block. Writers still serialise on the mutex,
+// but apply each change to a copy and publish it once complete.
 type TokenSystem struct {
 	mu       sync.RWMutex
 	registry *TokenRegistry
+
+	// published holds the same registry as the registry field in lock-free mode, and
+	// nil otherwise. A published registry is never modified again.
+	lockFree  bool
+	published atomic.Pointer[TokenRegistry]
+
+	// wal is nil unless the system was created by OpenTokenSystem.
+	wal        *writeAheadLog
+	walOptions WALOptions
+
+	resolver  MetadataResolver
+	validator Validator
+
+	// canonical holds the addresses marked by SetCanonical; see WithCanonicalGuard.
+	canonical      map[common.Address]struct{}
+	canonicalGuard bool
+
+	// denylist and allowlist are nil unless set; see SetDenylist and SetAllowlist.
+	denylist  *AddressList
+	allowlist *AddressList
+
+	// seq is the sequence number of the last committed change; see Event.
+	seq         uint64
+	subscribers []*Subscription
+}
+
+// Option configures optional TokenSystem behaviour at construction time.
+type Option func(*TokenSystem)
+
+// WithResolver sets the MetadataResolver used by AddTokenFromChain.
+func WithResolver(resolver MetadataResolver) Option {
+	return func(ts *TokenSystem) {
+		ts.resolver = resolver
+	}
+}
+
+// WithLockFreeReads makes GetTokenByID, GetTokenByAddress and View read from an
+// atomically published immutable registry, so they never wait for a writer. Every
+// mutation copies the registry, making writes O(n) in the number of tokens; use this
+// mode when reads vastly outnumber writes.
+func WithLockFreeReads() Option {
+	return func(ts *TokenSystem) {
+		ts.lockFree = true
+	}
 }
 
-// NewTokenSystem creates and initializes a new, concurrency-safe TokenSystem.
-func NewTokenSystem() *TokenSystem {
-	return &TokenSystem{
-		registry: NewTokenRegistry(),
+// newTokenSystem wraps a registry and applies the options.
+func newTokenSystem(registry *TokenRegistry, opts []Option) *TokenSystem {
+	ts := &TokenSystem{
+		registry:  registry,
+		validator: DefaultValidationRules(),
+	}
+	for _, opt := range opts {
+		opt(ts)
 	}
+	if ts.lockFree {
+		ts.published.Store(registry)
+	}
+	return ts
 }
 
-func NewTokenSystemFromViews(view []TokenView) (*TokenSystem, error) {
+// NewTokenSystem creates and initializes a new, concurrency-safe TokenSystem. Adds and
+// updates are checked with DefaultValidationRules unless WithValidator is given.
+func NewTokenSystem(opts ...Option) *TokenSystem {
+	return newTokenSystem(NewTokenRegistry(), opts)
+}
+
+func NewTokenSystemFromViews(view []TokenView, opts ...Option) (*TokenSystem, error) {
 	registry, err := NewTokenRegistryFromViews(view)
 	if err != nil {
 		return nil, err
 	}
-	return &TokenSystem{
-		registry: registry,
-	}, nil
+	return newTokenSystem(registry, opts), nil
+}
+
+// NewTokenSystemFromState creates a TokenSystem from an exported RegistryState,
+// preserving the ID high-water mark and tombstones. See NewTokenRegistryFromState.
+func NewTokenSystemFromState(state RegistryState, opts ...Option) (*TokenSystem, error) {
+	registry, err := NewTokenRegistryFromState(state)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenSystem(registry, opts), nil
+}
+
+// NewTokenSystemFromSnapshot creates a TokenSystem from a binary snapshot produced by
+// WriteSnapshot or WriteRegistrySnapshot.
+func NewTokenSystemFromSnapshot(r io.Reader, opts ...Option) (*TokenSystem, error) {
+	registry, err := NewTokenRegistryFromSnapshot(r)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenSystem(registry, opts), nil
 }
 
 // AddToken adds a token to the registry in a thread-safe manner.
@@ -36,7 +118,19 @@ func NewTokenSystemFromViews(view []TokenView) (*TokenSystem, error) {
 func (ts *TokenSystem) AddToken(addr common.Address, name, symbol string, decimals uint8) (uint64, error) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
-	return addToken(addr, name, symbol, decimals, ts.registry)
+	id := ts.registry.nextID
+	err := ts.commit(mutation{
+		kind:     mutationAdd,
+		id:       id,
+		address:  addr,
+		name:     name,
+		symbol:   symbol,
+		decimals: decimals,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
 // DeleteToken removes a token from the registry in a thread-safe manner.
@@ -44,28 +138,144 @@ func (ts *TokenSystem) AddToken(addr common.Address, name, symbol string, decima
 func (ts *TokenSystem) DeleteToken(idToDelete uint64) error {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
-	return deleteToken(idToDelete, ts.registry)
+	return ts.commit(mutation{kind: mutationDelete, id: idToDelete})
+}
+
+// UpdateToken updates token data in a thread-safe manner, taking the fee as a
+// percentage. It acquires a full write lock.
+//
+// Deprecated: Use UpdateTokenPPM, which takes the fee in parts per million. The
+// percentage is converted with FeePPMFromPercent.
+func (ts *TokenSystem) UpdateToken(id uint64, feePercent float64, gas uint64) error {
+	feePPM, err := FeePPMFromPercent(feePercent)
+	if err != nil {
+		return err
+	}
+	return ts.UpdateTokenPPM(id, feePPM, gas)
 }
 
-// UpdateToken updates token data in a thread-safe manner.
+// UpdateTokenPPM updates token data in a thread-safe manner. The fee is in parts per
+// million (see FeeDenominator) and is rejected with ErrInvalidFeeRate above 100%.
 // It acquires a full write lock.
-func (ts *TokenSystem) UpdateToken(id uint64, fee float64, gas uint64) error {
+func (ts *TokenSystem) UpdateTokenPPM(id uint64, feePPM uint32, gas uint64) error {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
-	return updateToken(id, fee, gas, ts.registry)
+	return ts.commit(mutation{
+		kind:             mutationUpdate,
+		id:               id,
+		feeOnTransferPPM: feePPM,
+		gasForTransfer:   gas,
+	})
+}
+
+// commit validates and applies mutations in order, each against the registry as the ones
+// before it leave it, so a batch may depend on its own earlier entries. Either every
+// mutation is applied or, on error, none is. When a write-ahead log is attached, the
+// batch is logged as a single record before it takes effect, so nothing is acknowledged
+// that recovery would not reproduce. Callers must hold the write lock.
+func (ts *TokenSystem) commit(mutations ...mutation) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	if len(mutations) == 1 && !ts.lockFree {
+		// A mutation that passes its checks cannot fail part way, so a single one can be
+		// applied in place rather than to a copy.
+		m := mutations[0]
+		if err := ts.validate(m, ts.registry); err != nil {
+			return err
+		}
+		if err := checkMutation(m, ts.registry); err != nil {
+			return err
+		}
+		if ts.wal != nil {
+			if err := ts.wal.append(m); err != nil {
+				return err
+			}
+		}
+		ev, err := mutationEvent(m, ts.registry)
+		if err != nil {
+			return err
+		}
+		ts.publish([]Event{ev})
+		ts.maybeCompact()
+		return nil
+	}
+
+	staged := cloneRegistry(ts.registry)
+	events := make([]Event, len(mutations))
+	for i, m := range mutations {
+		var err error
+		if events[i], err = ts.stage(m, staged); err != nil {
+			return err
+		}
+	}
+	return ts.install(staged, mutations, events)
+}
+
+// stage validates m against staged, a copy of the registry, and applies it there.
+func (ts *TokenSystem) stage(m mutation, staged *TokenRegistry) (Event, error) {
+	if err := ts.validate(m, staged); err != nil {
+		return Event{}, err
+	}
+	return mutationEvent(m, staged)
+}
+
+// install logs mutations already applied to staged, a copy of the registry, and makes it
+// the current registry. Lock-free readers may still hold the old one, which is left
+// untouched. Callers must hold the write lock.
+func (ts *TokenSystem) install(staged *TokenRegistry, mutations []mutation, events []Event) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	if ts.wal != nil {
+		if err := ts.wal.append(mutations...); err != nil {
+			return err
+		}
+	}
+	ts.registry = staged
+	if ts.lockFree {
+		ts.published.Store(staged)
+	}
+	ts.publish(events)
+	ts.maybeCompact()
+	return nil
+}
+
+// maybeCompact compacts the write-ahead log once it has grown past the configured
+// threshold. It is called after mutations are durable, so a failed compaction is not
+// reported to the caller; the log stays above the threshold and compaction is retried
+// after the next write. Callers must hold the write lock.
+func (ts *TokenSystem) maybeCompact() {
+	if ts.wal != nil && ts.walOptions.CompactThreshold > 0 && ts.wal.size >= ts.walOptions.CompactThreshold {
+		_ = ts.compact()
+	}
 }
 
 // View returns a view of all tokens.
 // It acquires a read lock, allowing multiple concurrent readers.
 func (ts *TokenSystem) View() []TokenView {
+	if registry := ts.published.Load(); registry != nil {
+		return viewRegistry(registry)
+	}
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 	return viewRegistry(ts.registry)
 }
 
+// State exports the registry's tokens together with its ID high-water mark and tombstones.
+// It acquires a read lock, allowing multiple concurrent readers.
+func (ts *TokenSystem) State() RegistryState {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return exportRegistryState(ts.registry)
+}
+
 // GetTokenByID performs a lookup for a single token.
 // It acquires a read lock, allowing multiple concurrent readers.
 func (ts *TokenSystem) GetTokenByID(id uint64) (TokenView, error) {
+	if registry := ts.published.Load(); registry != nil {
+		return getTokenByID(id, registry)
+	}
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 	return getTokenByID(id, ts.registry)
@@ -74,7 +284,18 @@ func (ts *TokenSystem) GetTokenByID(id uint64) (TokenView, error) {
 // GetTokenByAddress performs a lookup for a single token.
 // It acquires a read lock, allowing multiple concurrent readers.
 func (ts *TokenSystem) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	if registry := ts.published.Load(); registry != nil {
+		return getTokenByAddress(addr, registry)
+	}
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 	return getTokenByAddress(addr, ts.registry)
 }
+
+// WriteSnapshot encodes the registry into the binary snapshot format.
+// It acquires a read lock, so the snapshot is a consistent point-in-time copy.
+func (ts *TokenSystem) WriteSnapshot(w io.Writer) error {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return WriteRegistrySnapshot(w, ts.registry)
+}
@@ -48,14 +48,26 @@ func TestTokenSystem_Methods(t *testing.T) {
 	})
 
 	t.Run("Update Token", func(t *testing.T) {
-		err = ts.UpdateToken(tokenID, 5.0, 25000)
+		err = ts.UpdateTokenPPM(tokenID, 50_000, 25000)
 		require.NoError(t, err)
 		updatedView, err := ts.GetTokenByID(tokenID)
 		require.NoError(t, err)
-		assert.Equal(t, 5.0, updatedView.FeeOnTransferPercent)
+		assert.Equal(t, uint32(50_000), updatedView.FeeOnTransferPPM)
 		assert.Equal(t, uint64(25000), updatedView.GasForTransfer)
 	})
 
+	t.Run("Update Token With Percent", func(t *testing.T) {
+		err = ts.UpdateToken(tokenID, 2.5, 30000)
+		require.NoError(t, err)
+		updatedView, err := ts.GetTokenByID(tokenID)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(25_000), updatedView.FeeOnTransferPPM)
+		assert.Equal(t, uint64(30000), updatedView.GasForTransfer)
+
+		err = ts.UpdateToken(tokenID, 0.00001, 30000)
+		assert.ErrorIs(t, err, ErrInvalidFeeRate, "a fee below 1 ppm is not recorded as no fee")
+	})
+
 	t.Run("View System", func(t *testing.T) {
 		allViews := ts.View()
 		require.Len(t, allViews, 1)
@@ -118,7 +130,7 @@ func TestTokenSystem_StressConcurrent(t *testing.T) {
 	// Setup an initial pool of tokens to create contention on updates/deletes
 	initialIDs := make([]uint64, initialTokens)
 	for i := 0; i < initialTokens; i++ {
-		id, err := ts.AddToken(addr(byte(i)), "init", "INIT", 18)
+		id, err := ts.AddToken(addr(byte(i+1)), "init", "INIT", 18)
 		require.NoError(t, err)
 		initialIDs[i] = id
 	}
@@ -138,7 +150,7 @@ func TestTokenSystem_StressConcurrent(t *testing.T) {
 					_, _ = ts.GetTokenByID(randomInitialID)
 					_ = ts.View()
 				case op < 85: // 15% chance of an Update operation
-					_ = ts.UpdateToken(randomInitialID, r.Float64()*10, 21000)
+					_ = ts.UpdateTokenPPM(randomInitialID, uint32(r.Intn(100_000)), 21000)
 				case op < 95: // 10% chance of an Add operation
 					newAddr := addr(byte(r.Intn(255)))
 					// Ignore error, as duplicate adds are expected and fine
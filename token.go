@@ -1,8 +1,11 @@
 package token
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -21,67 +24,150 @@ var (
 
 // TokenView is a safe, structured representation of a token's data for external use.
 type TokenView struct {
+	ID               uint64         `json:"id"`
+	Address          common.Address `json:"address"`
+	Name             string         `json:"name"`
+	Symbol           string         `json:"symbol"`
+	Decimals         uint8          `json:"decimals"`
+	FeeOnTransferPPM uint32         `json:"feeOnTransferPPM"` // Parts per million of the amount sent; see FeeDenominator
+	GasForTransfer   uint64         `json:"gasForTransfer"`
+	Flags            RiskFlags      `json:"flags"`
+}
+
+// tokenViewJSON is the wire form of TokenView. FeeOnTransferPercent is the encoding used
+// before fees were stored in parts per million; it is still written for older readers and
+// accepted from older writers.
+type tokenViewJSON struct {
 	ID                   uint64         `json:"id"`
 	Address              common.Address `json:"address"`
 	Name                 string         `json:"name"`
 	Symbol               string         `json:"symbol"`
 	Decimals             uint8          `json:"decimals"`
-	FeeOnTransferPercent float64        `json:"feeOnTransferPercent"`
+	FeeOnTransferPPM     *uint32        `json:"feeOnTransferPPM,omitempty"`
+	FeeOnTransferPercent *float64       `json:"feeOnTransferPercent,omitempty"`
 	GasForTransfer       uint64         `json:"gasForTransfer"`
+	Flags                RiskFlags      `json:"flags"`
+}
+
+// MarshalJSON encodes the fee both in parts per million and, for older readers, as a percentage.
+func (v TokenView) MarshalJSON() ([]byte, error) {
+	percent := FeePercent(v.FeeOnTransferPPM)
+	return json.Marshal(tokenViewJSON{
+		ID:                   v.ID,
+		Address:              v.Address,
+		Name:                 v.Name,
+		Symbol:               v.Symbol,
+		Decimals:             v.Decimals,
+		FeeOnTransferPPM:     &v.FeeOnTransferPPM,
+		FeeOnTransferPercent: &percent,
+		GasForTransfer:       v.GasForTransfer,
+		Flags:                v.Flags,
+	})
+}
+
+// UnmarshalJSON decodes a view, taking the fee from feeOnTransferPPM if present and
+// otherwise converting the older feeOnTransferPercent. Fees outside 0-100% are rejected
+// with ErrInvalidFeeRate.
+func (v *TokenView) UnmarshalJSON(data []byte) error {
+	var w tokenViewJSON
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	var fee uint32
+	switch {
+	case w.FeeOnTransferPPM != nil:
+		if err := validateFeePPM(*w.FeeOnTransferPPM); err != nil {
+			return err
+		}
+		fee = *w.FeeOnTransferPPM
+	case w.FeeOnTransferPercent != nil:
+		var err error
+		if fee, err = FeePPMFromPercent(*w.FeeOnTransferPercent); err != nil {
+			return err
+		}
+	}
+	*v = TokenView{
+		ID:               w.ID,
+		Address:          w.Address,
+		Name:             w.Name,
+		Symbol:           w.Symbol,
+		Decimals:         w.Decimals,
+		FeeOnTransferPPM: fee,
+		GasForTransfer:   w.GasForTransfer,
+		Flags:            w.Flags,
+	}
+	return nil
 }
 
 // TokenRegistry manages a collection of token data using a Struct-of-Arrays layout.
 type TokenRegistry struct {
 	// --- Physical data storage (Struct of Arrays) ---
-	address              []common.Address
-	name                 []string
-	symbol               []string
-	decimals             []uint8
-	feeOnTransferPercent []float64
-	gasForTransfer       []uint64
-	id                   []uint64 // Stores the stable ID for each index
+	address          []common.Address
+	name             []string
+	symbol           []string
+	decimals         []uint8
+	feeOnTransferPPM []uint32
+	gasForTransfer   []uint64
+	flags            []RiskFlags
+	id               []uint64 // Stores the stable ID for each index
 
 	// --- Mapping layers to separate logical ID from physical index ---
 	nextID      uint64                    // A counter to generate new, permanent IDs
 	idToIndex   map[uint64]int            // Maps a permanent ID to its current slice index
 	addressToID map[common.Address]uint64 // Maps an address to its permanent ID
+	tombstones  map[uint64]struct{}       // IDs of deleted tokens, which must never be reissued
+
+	// --- Secondary indexes, keyed by ID so that swap-and-pop leaves them valid ---
+	symbolToIDs   map[string][]uint64 // Maps a lower-cased symbol to the IDs of every token with it
+	skeletonToIDs map[string][]uint64 // Maps a symbol or name skeleton to the IDs of every token with it
 }
 
 // NewTokenRegistry creates and initializes a new, empty TokenRegistry.
 func NewTokenRegistry() *TokenRegistry {
 	return &TokenRegistry{
 		// Initialize with a capacity to reduce initial reallocations
-		address:              make([]common.Address, 0, 128),
-		name:                 make([]string, 0, 128),
-		symbol:               make([]string, 0, 128),
-		decimals:             make([]uint8, 0, 128),
-		feeOnTransferPercent: make([]float64, 0, 128),
-		gasForTransfer:       make([]uint64, 0, 128),
-		id:                   make([]uint64, 0, 128),
+		address:          make([]common.Address, 0, 128),
+		name:             make([]string, 0, 128),
+		symbol:           make([]string, 0, 128),
+		decimals:         make([]uint8, 0, 128),
+		feeOnTransferPPM: make([]uint32, 0, 128),
+		gasForTransfer:   make([]uint64, 0, 128),
+		flags:            make([]RiskFlags, 0, 128),
+		id:               make([]uint64, 0, 128),
 
-		nextID:      1, // Start IDs at 1 to avoid confusion with zero-values
-		idToIndex:   make(map[uint64]int),
-		addressToID: make(map[common.Address]uint64),
+		nextID:        1, // Start IDs at 1 to avoid confusion with zero-values
+		idToIndex:     make(map[uint64]int),
+		addressToID:   make(map[common.Address]uint64),
+		tombstones:    make(map[uint64]struct{}),
+		symbolToIDs:   make(map[string][]uint64),
+		skeletonToIDs: make(map[string][]uint64),
 	}
 }
 
 // NewTokenRegistryFromViews reconstructs a TokenRegistry from a slice of TokenView structs.
 // It performs critical validation to ensure the input data is consistent, returning an
-// error if any duplicate IDs or addresses are found.
+// error if any duplicate IDs or addresses or any fee above 100% are found.
+//
+// Views carry no record of deleted tokens, so the next ID is derived as the highest
+// ID plus one. Use NewTokenRegistryFromState to restore the exact ID high-water mark.
 func NewTokenRegistryFromViews(views []TokenView) (*TokenRegistry, error) {
 	numTokens := len(views)
 
 	registry := &TokenRegistry{
-		address:              make([]common.Address, numTokens),
-		name:                 make([]string, numTokens),
-		symbol:               make([]string, numTokens),
-		decimals:             make([]uint8, numTokens),
-		feeOnTransferPercent: make([]float64, numTokens),
-		gasForTransfer:       make([]uint64, numTokens),
-		id:                   make([]uint64, numTokens),
-		idToIndex:            make(map[uint64]int, numTokens),
-		addressToID:          make(map[common.Address]uint64, numTokens),
-		nextID:               1,
+		address:          make([]common.Address, numTokens),
+		name:             make([]string, numTokens),
+		symbol:           make([]string, numTokens),
+		decimals:         make([]uint8, numTokens),
+		feeOnTransferPPM: make([]uint32, numTokens),
+		gasForTransfer:   make([]uint64, numTokens),
+		flags:            make([]RiskFlags, numTokens),
+		id:               make([]uint64, numTokens),
+		idToIndex:        make(map[uint64]int, numTokens),
+		addressToID:      make(map[common.Address]uint64, numTokens),
+		tombstones:       make(map[uint64]struct{}),
+		symbolToIDs:      make(map[string][]uint64),
+		skeletonToIDs:    make(map[string][]uint64),
+		nextID:           1,
 	}
 
 	var maxID uint64 = 0
@@ -93,17 +179,23 @@ func NewTokenRegistryFromViews(views []TokenView) (*TokenRegistry, error) {
 		if _, exists := registry.addressToID[view.Address]; exists {
 			return nil, fmt.Errorf("%w: %s", ErrDuplicateAddress, view.Address.Hex())
 		}
+		if err := validateFeePPM(view.FeeOnTransferPPM); err != nil {
+			return nil, fmt.Errorf("token %d: %w", view.ID, err)
+		}
 
 		// --- Populate Slices and Maps ---
 		registry.address[i] = view.Address
 		registry.name[i] = view.Name
 		registry.symbol[i] = view.Symbol
 		registry.decimals[i] = view.Decimals
-		registry.feeOnTransferPercent[i] = view.FeeOnTransferPercent
+		registry.feeOnTransferPPM[i] = view.FeeOnTransferPPM
 		registry.gasForTransfer[i] = view.GasForTransfer
+		registry.flags[i] = view.Flags
 		registry.id[i] = view.ID
 		registry.idToIndex[view.ID] = i
 		registry.addressToID[view.Address] = view.ID
+		indexSymbol(view.ID, view.Symbol, registry)
+		indexSkeletons(view.ID, view.Name, view.Symbol, registry)
 
 		if view.ID > maxID {
 			maxID = view.ID
@@ -114,6 +206,29 @@ func NewTokenRegistryFromViews(views []TokenView) (*TokenRegistry, error) {
 	return registry, nil
 }
 
+// cloneRegistry returns a deep copy of the registry that shares no memory with the original.
+func cloneRegistry(registry *TokenRegistry) *TokenRegistry {
+	return &TokenRegistry{
+		address:          slices.Clone(registry.address),
+		name:             slices.Clone(registry.name),
+		symbol:           slices.Clone(registry.symbol),
+		decimals:         slices.Clone(registry.decimals),
+		feeOnTransferPPM: slices.Clone(registry.feeOnTransferPPM),
+		gasForTransfer:   slices.Clone(registry.gasForTransfer),
+		flags:            slices.Clone(registry.flags),
+		id:               slices.Clone(registry.id),
+
+		nextID:      registry.nextID,
+		idToIndex:   maps.Clone(registry.idToIndex),
+		addressToID: maps.Clone(registry.addressToID),
+		tombstones:  maps.Clone(registry.tombstones),
+
+		// The ID slices are shared; the index functions copy a slice before changing it.
+		symbolToIDs:   maps.Clone(registry.symbolToIDs),
+		skeletonToIDs: maps.Clone(registry.skeletonToIDs),
+	}
+}
+
 // AddToken adds a new token to the registry and assigns it a new, permanent ID.
 func addToken(addr common.Address, name, symbol string, decimals uint8, registry *TokenRegistry) (uint64, error) {
 	if _, exists := registry.addressToID[addr]; exists {
@@ -121,21 +236,30 @@ func addToken(addr common.Address, name, symbol string, decimals uint8, registry
 	}
 
 	newID := registry.nextID
-	registry.nextID++
+	insertToken(newID, addr, name, symbol, decimals, registry)
+	return newID, nil
+}
 
+// insertToken appends a token under a caller-chosen ID and advances nextID past it.
+// Callers are responsible for ensuring that neither the ID nor the address is in use.
+func insertToken(id uint64, addr common.Address, name, symbol string, decimals uint8, registry *TokenRegistry) {
 	newIndex := len(registry.address)
 	registry.address = append(registry.address, addr)
 	registry.name = append(registry.name, name)
 	registry.symbol = append(registry.symbol, symbol)
 	registry.decimals = append(registry.decimals, decimals)
-	registry.feeOnTransferPercent = append(registry.feeOnTransferPercent, 0)
+	registry.feeOnTransferPPM = append(registry.feeOnTransferPPM, 0)
 	registry.gasForTransfer = append(registry.gasForTransfer, 0)
-	registry.id = append(registry.id, newID)
-
-	registry.idToIndex[newID] = newIndex
-	registry.addressToID[addr] = newID
+	registry.flags = append(registry.flags, 0)
+	registry.id = append(registry.id, id)
 
-	return newID, nil
+	registry.idToIndex[id] = newIndex
+	registry.addressToID[addr] = id
+	indexSymbol(id, symbol, registry)
+	indexSkeletons(id, name, symbol, registry)
+	if id >= registry.nextID {
+		registry.nextID = id + 1
+	}
 }
 
 // deleteToken removes a token using the "swap-and-pop" algorithm.
@@ -146,6 +270,8 @@ func deleteToken(idToDelete uint64, registry *TokenRegistry) error {
 	}
 
 	addressToDelete := registry.address[indexToDelete]
+	nameToDelete := registry.name[indexToDelete]
+	symbolToDelete := registry.symbol[indexToDelete]
 	lastIndex := len(registry.address) - 1
 
 	if indexToDelete != lastIndex {
@@ -154,8 +280,9 @@ func deleteToken(idToDelete uint64, registry *TokenRegistry) error {
 		registry.name[indexToDelete] = registry.name[lastIndex]
 		registry.symbol[indexToDelete] = registry.symbol[lastIndex]
 		registry.decimals[indexToDelete] = registry.decimals[lastIndex]
-		registry.feeOnTransferPercent[indexToDelete] = registry.feeOnTransferPercent[lastIndex]
+		registry.feeOnTransferPPM[indexToDelete] = registry.feeOnTransferPPM[lastIndex]
 		registry.gasForTransfer[indexToDelete] = registry.gasForTransfer[lastIndex]
+		registry.flags[indexToDelete] = registry.flags[lastIndex]
 		registry.id[indexToDelete] = lastID
 		registry.idToIndex[lastID] = indexToDelete
 	}
@@ -164,43 +291,57 @@ func deleteToken(idToDelete uint64, registry *TokenRegistry) error {
 	registry.name = registry.name[:lastIndex]
 	registry.symbol = registry.symbol[:lastIndex]
 	registry.decimals = registry.decimals[:lastIndex]
-	registry.feeOnTransferPercent = registry.feeOnTransferPercent[:lastIndex]
+	registry.feeOnTransferPPM = registry.feeOnTransferPPM[:lastIndex]
 	registry.gasForTransfer = registry.gasForTransfer[:lastIndex]
+	registry.flags = registry.flags[:lastIndex]
 	registry.id = registry.id[:lastIndex]
 
 	delete(registry.idToIndex, idToDelete)
 	delete(registry.addressToID, addressToDelete)
+	unindexSymbol(idToDelete, symbolToDelete, registry)
+	unindexSkeletons(idToDelete, nameToDelete, symbolToDelete, registry)
+	registry.tombstones[idToDelete] = struct{}{}
 
 	return nil
 }
 
 // updateToken updates the mutable data for a token.
-func updateToken(id uint64, feeOnTransferPercent float64, gasForTransfer uint64, registry *TokenRegistry) error {
+func updateToken(id uint64, feeOnTransferPPM uint32, gasForTransfer uint64, registry *TokenRegistry) error {
 	index, ok := registry.idToIndex[id]
 	if !ok {
 		return ErrTokenNotFound
 	}
-	registry.feeOnTransferPercent[index] = feeOnTransferPercent
+	if err := validateFeePPM(feeOnTransferPPM); err != nil {
+		return err
+	}
+	registry.feeOnTransferPPM[index] = feeOnTransferPPM
 	registry.gasForTransfer[index] = gasForTransfer
 	return nil
 }
 
+// setTokenMetadata replaces a token's name, symbol and decimals and reindexes it.
+func setTokenMetadata(id uint64, name, symbol string, decimals uint8, registry *TokenRegistry) error {
+	index, ok := registry.idToIndex[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	unindexSymbol(id, registry.symbol[index], registry)
+	unindexSkeletons(id, registry.name[index], registry.symbol[index], registry)
+	registry.name[index] = name
+	registry.symbol[index] = symbol
+	registry.decimals[index] = decimals
+	indexSymbol(id, symbol, registry)
+	indexSkeletons(id, name, symbol, registry)
+	return nil
+}
+
 // getTokenByID returns a safe, structured view of a single token by its permanent ID.
 func getTokenByID(id uint64, registry *TokenRegistry) (TokenView, error) {
 	index, ok := registry.idToIndex[id]
 	if !ok {
 		return TokenView{}, ErrTokenNotFound
 	}
-
-	return TokenView{
-		ID:                   id,
-		Address:              registry.address[index],
-		Name:                 registry.name[index],
-		Symbol:               registry.symbol[index],
-		Decimals:             registry.decimals[index],
-		FeeOnTransferPercent: registry.feeOnTransferPercent[index],
-		GasForTransfer:       registry.gasForTransfer[index],
-	}, nil
+	return viewAt(index, registry), nil
 }
 
 // getTokenByAddress finds a token by its address and returns its view.
@@ -209,16 +350,7 @@ func getTokenByAddress(addr common.Address, registry *TokenRegistry) (TokenView,
 	if !ok {
 		return TokenView{}, ErrTokenNotFound
 	}
-	index := registry.idToIndex[id]
-	return TokenView{
-		ID:                   id,
-		Address:              registry.address[index],
-		Name:                 registry.name[index],
-		Symbol:               registry.symbol[index],
-		Decimals:             registry.decimals[index],
-		FeeOnTransferPercent: registry.feeOnTransferPercent[index],
-		GasForTransfer:       registry.gasForTransfer[index],
-	}, nil
+	return viewAt(registry.idToIndex[id], registry), nil
 }
 
 // viewRegistry returns a slice of views for all active tokens in the registry.
@@ -226,15 +358,21 @@ func viewRegistry(registry *TokenRegistry) []TokenView {
 	length := len(registry.address)
 	views := make([]TokenView, length)
 	for i := 0; i < length; i++ {
-		views[i] = TokenView{
-			ID:                   registry.id[i],
-			Address:              registry.address[i],
-			Name:                 registry.name[i],
-			Symbol:               registry.symbol[i],
-			Decimals:             registry.decimals[i],
-			FeeOnTransferPercent: registry.feeOnTransferPercent[i],
-			GasForTransfer:       registry.gasForTransfer[i],
-		}
+		views[i] = viewAt(i, registry)
 	}
 	return views
 }
+
+// viewAt gathers the token at a slice index into a view.
+func viewAt(index int, registry *TokenRegistry) TokenView {
+	return TokenView{
+		ID:               registry.id[index],
+		Address:          registry.address[index],
+		Name:             registry.name[index],
+		Symbol:           registry.symbol[index],
+		Decimals:         registry.decimals[index],
+		FeeOnTransferPPM: registry.feeOnTransferPPM[index],
+		GasForTransfer:   registry.gasForTransfer[index],
+		Flags:            registry.flags[index],
+	}
+}
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"encoding/json"
 	"math/rand"
 	"testing"
 
@@ -126,16 +127,23 @@ func TestUpdateToken(t *testing.T) {
 	registry, ids := newTestRegistry(t)
 	idToUpdate := ids[0] // Token A
 
-	err := updateToken(idToUpdate, 5.5, 21000, registry)
+	err := updateToken(idToUpdate, 55_000, 21000, registry)
 	require.NoError(t, err)
 
 	view, err := getTokenByID(idToUpdate, registry)
 	require.NoError(t, err)
-	assert.Equal(t, 5.5, view.FeeOnTransferPercent)
+	assert.Equal(t, uint32(55_000), view.FeeOnTransferPPM)
 	assert.Equal(t, uint64(21000), view.GasForTransfer)
 
-	err = updateToken(999, 1.0, 100, registry)
+	err = updateToken(999, 10_000, 100, registry)
 	assert.ErrorIs(t, err, ErrTokenNotFound, "should return an error for a non-existent token")
+
+	err = updateToken(idToUpdate, FeeDenominator+1, 100, registry)
+	assert.ErrorIs(t, err, ErrInvalidFeeRate, "should reject a fee above 100%")
+	view, err = getTokenByID(idToUpdate, registry)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(55_000), view.FeeOnTransferPPM, "a rejected update must not change the token")
+	require.NoError(t, updateToken(idToUpdate, FeeDenominator, 100, registry))
 }
 
 func TestNewTokenRegistryFromViews(t *testing.T) {
@@ -198,6 +206,57 @@ func TestNewTokenRegistryFromViews(t *testing.T) {
 		require.Error(t, err)
 		assert.ErrorIs(t, err, ErrDuplicateAddress)
 	})
+
+	t.Run("FailureOnFeeAbove100Percent", func(t *testing.T) {
+		views := []TokenView{
+			{ID: 1, Address: addr(1), FeeOnTransferPPM: FeeDenominator},
+			{ID: 2, Address: addr(2), FeeOnTransferPPM: FeeDenominator + 1},
+		}
+
+		_, err := NewTokenRegistryFromViews(views)
+		assert.ErrorIs(t, err, ErrInvalidFeeRate)
+	})
+}
+
+func TestTokenView_JSON(t *testing.T) {
+	t.Parallel()
+	view := TokenView{ID: 7, Address: addr(1), Name: "Token A", Symbol: "TKA", Decimals: 6, FeeOnTransferPPM: 3_000, GasForTransfer: 21000, Flags: FlagPausable | FlagUpgradeable}
+
+	encoded, err := json.Marshal(view)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":7,"address":"0x0100000000000000000000000000000000000000","name":"Token A","symbol":"TKA","decimals":6,"feeOnTransferPPM":3000,"feeOnTransferPercent":0.3,"gasForTransfer":21000,"flags":12}`, string(encoded))
+	var decoded TokenView
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, view, decoded)
+
+	testCases := []struct {
+		name        string
+		json        string
+		expected    uint32
+		expectedErr error
+	}{
+		{name: "Legacy percent", json: `{"id":7,"feeOnTransferPercent":0.3}`, expected: 3_000},
+		{name: "Legacy fraction of a ppm", json: `{"id":7,"feeOnTransferPercent":0.00004}`, expectedErr: ErrInvalidFeeRate},
+		{name: "Legacy half a ppm", json: `{"id":7,"feeOnTransferPercent":0.00005}`, expected: 1},
+		{name: "PPM wins over percent", json: `{"id":7,"feeOnTransferPPM":2500,"feeOnTransferPercent":99}`, expected: 2_500},
+		{name: "No fee", json: `{"id":7}`, expected: 0},
+		{name: "Legacy negative", json: `{"id":7,"feeOnTransferPercent":-1}`, expectedErr: ErrInvalidFeeRate},
+		{name: "Legacy above 100%", json: `{"id":7,"feeOnTransferPercent":100.01}`, expectedErr: ErrInvalidFeeRate},
+		{name: "PPM above 100%", json: `{"id":7,"feeOnTransferPPM":1000001}`, expectedErr: ErrInvalidFeeRate},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var v TokenView
+			err := json.Unmarshal([]byte(tc.json), &v)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint64(7), v.ID)
+			assert.Equal(t, tc.expected, v.FeeOnTransferPPM)
+		})
+	}
 }
 
 func TestGetters(t *testing.T) {
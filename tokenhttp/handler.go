@@ -0,0 +1,453 @@
+// Package tokenhttp serves a TokenSystem over HTTP as a JSON API for inspecting and
+// editing the registry.
+package tokenhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// DefaultLimit is the page size of GET /tokens when the request sets no limit.
+	DefaultLimit = 100
+	// MaxLimit is the largest page size GET /tokens accepts.
+	MaxLimit = 1000
+	// maxBodyBytes caps the size of request bodies.
+	maxBodyBytes = 1 << 20
+)
+
+// errPreconditionFailed is returned from inside an Update when If-Match does not match.
+var errPreconditionFailed = errors.New("token has changed since it was read")
+
+// Handler serves the registry of a TokenSystem:
+//
+//	GET    /tokens                    list tokens, filtered and paginated; see listTokens
+//	POST   /tokens                    add a token
+//	GET    /tokens/{id}               look up a token by ID
+//	PATCH  /tokens/{id}               update a token's fee, transfer gas or risk flags
+//	DELETE /tokens/{id}               delete a token
+//	GET    /tokens/address/{address}  look up a token by address
+//	GET    /tokens/symbol/{symbol}    list the tokens with a symbol
+//
+// Single-token responses carry an ETag. PATCH and DELETE honour If-Match, failing with
+// 412 if the token has changed, and GET honours If-None-Match. Errors are returned as
+// RFC 9457 problem documents.
+type Handler struct {
+	ts  *token.TokenSystem
+	mux *http.ServeMux
+}
+
+// NewHandler returns a Handler serving ts. Mount it at the root, or strip any prefix
+// with http.StripPrefix. It has no access control of its own.
+func NewHandler(ts *token.TokenSystem) *Handler {
+	h := &Handler{ts: ts, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /tokens", h.listTokens)
+	h.mux.HandleFunc("POST /tokens", h.addToken)
+	h.mux.HandleFunc("GET /tokens/{id}", h.getToken)
+	h.mux.HandleFunc("PATCH /tokens/{id}", h.updateToken)
+	h.mux.HandleFunc("DELETE /tokens/{id}", h.deleteToken)
+	h.mux.HandleFunc("GET /tokens/address/{address}", h.getTokenByAddress)
+	h.mux.HandleFunc("GET /tokens/symbol/{symbol}", h.getTokensBySymbol)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// ListResponse is the body of GET /tokens.
+type ListResponse struct {
+	Tokens []token.TokenView `json:"tokens"`
+	// NextCursor is passed as the cursor parameter to fetch the next page. It is omitted
+	// on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+	// Total counts every token that passes the filters, across all pages.
+	Total int `json:"total"`
+}
+
+// AddRequest is the body of POST /tokens.
+type AddRequest struct {
+	Address  common.Address `json:"address"`
+	Name     string         `json:"name"`
+	Symbol   string         `json:"symbol"`
+	Decimals uint8          `json:"decimals"`
+}
+
+// UpdateRequest is the body of PATCH /tokens/{id}. Omitted fields are left unchanged.
+type UpdateRequest struct {
+	FeeOnTransferPPM *uint32 `json:"feeOnTransferPPM,omitempty"`
+	GasForTransfer   *uint64 `json:"gasForTransfer,omitempty"`
+	// Flags replaces the token's risk flags.
+	Flags *token.RiskFlags `json:"flags,omitempty"`
+}
+
+// listTokens serves GET /tokens. The query parameters map onto token.Query:
+//
+//	minDecimals, maxDecimals, minFeePPM, maxFeePPM, minGas, maxGas
+//	symbol, symbolMatch     exact (default), fold, prefix or substring
+//	requireFlags, excludeFlags  flag names as parsed by token.ParseRiskFlags
+//	orderBy                 id (default), symbol or address
+//	order                   asc (default) or desc
+//	cursor, limit           pagination; limit defaults to DefaultLimit
+func (h *Handler) listTokens(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := h.ts.Query(q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ListResponse{Tokens: page.Tokens, NextCursor: page.NextCursor, Total: page.Total})
+}
+
+func (h *Handler) addToken(w http.ResponseWriter, r *http.Request) {
+	var req AddRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	id, err := h.ts.AddToken(req.Address, req.Name, req.Symbol, req.Decimals)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	view, err := h.ts.GetTokenByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/tokens/"+strconv.FormatUint(id, 10))
+	writeToken(w, r, http.StatusCreated, view)
+}
+
+func (h *Handler) getToken(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	view, err := h.ts.GetTokenByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeToken(w, r, http.StatusOK, view)
+}
+
+func (h *Handler) getTokenByAddress(w http.ResponseWriter, r *http.Request) {
+	raw := r.PathValue("address")
+	if !common.IsHexAddress(raw) {
+		writeProblem(w, http.StatusBadRequest, fmt.Errorf("%q is not an address", raw))
+		return
+	}
+	view, err := h.ts.GetTokenByAddress(common.HexToAddress(raw))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeToken(w, r, http.StatusOK, view)
+}
+
+// getTokensBySymbol serves GET /tokens/symbol/{symbol}. The match is exact unless the
+// fold parameter is true. It returns an empty list rather than 404 when nothing matches,
+// since symbols are not unique.
+func (h *Handler) getTokensBySymbol(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+	fold, err := parseBool(r.URL.Query(), "fold")
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	var views []token.TokenView
+	if fold {
+		views = h.ts.GetTokensBySymbolFold(symbol)
+	} else {
+		views = h.ts.GetTokensBySymbol(symbol)
+	}
+	if views == nil {
+		views = []token.TokenView{}
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// updateToken serves PATCH /tokens/{id}. The If-Match check and every change happen in
+// one transaction, so a concurrent writer cannot slip in between them.
+func (h *Handler) updateToken(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	var req UpdateRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	var updated token.TokenView
+	err = h.ts.Update(func(tx *token.Tx) error {
+		view, err := tx.GetTokenByID(id)
+		if err != nil {
+			return err
+		}
+		if !matchesETag(ifMatch, view) {
+			return errPreconditionFailed
+		}
+		fee, gas := view.FeeOnTransferPPM, view.GasForTransfer
+		if req.FeeOnTransferPPM != nil {
+			fee = *req.FeeOnTransferPPM
+		}
+		if req.GasForTransfer != nil {
+			gas = *req.GasForTransfer
+		}
+		if fee != view.FeeOnTransferPPM || gas != view.GasForTransfer {
+			if err := tx.UpdateTokenPPM(id, fee, gas); err != nil {
+				return err
+			}
+		}
+		if req.Flags != nil {
+			if clear := view.Flags &^ *req.Flags; clear != 0 {
+				if err := tx.ClearFlags(id, clear); err != nil {
+					return err
+				}
+			}
+			if set := *req.Flags &^ view.Flags; set != 0 {
+				if err := tx.SetFlags(id, set); err != nil {
+					return err
+				}
+			}
+		}
+		updated, err = tx.GetTokenByID(id)
+		return err
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeToken(w, r, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteToken(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	err = h.ts.Update(func(tx *token.Tx) error {
+		view, err := tx.GetTokenByID(id)
+		if err != nil {
+			return err
+		}
+		if !matchesETag(ifMatch, view) {
+			return errPreconditionFailed
+		}
+		return tx.DeleteToken(id)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ETag returns the entity tag of a token: a hash of every field, so it changes whenever
+// the token does.
+func ETag(view token.TokenView) string {
+	data, _ := json.Marshal(view)
+	hash := fnv.New64a()
+	hash.Write(data)
+	return fmt.Sprintf(`"%016x"`, hash.Sum64())
+}
+
+// matchesETag reports whether an If-Match header allows changing view. An empty header
+// always matches.
+func matchesETag(header string, view token.TokenView) bool {
+	if header == "" {
+		return true
+	}
+	return etagListContains(header, ETag(view), false)
+}
+
+// etagListContains reports whether a comma-separated If-Match or If-None-Match header
+// contains etag or "*". RFC 9110 requires If-Match to compare strongly, so a weak tag
+// never matches, and If-None-Match to compare weakly, by the tags' opaque part.
+func etagListContains(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[len("W/"):]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeToken writes a single token with its ETag, or 304 Not Modified when a GET's
+// If-None-Match already names it.
+func writeToken(w http.ResponseWriter, r *http.Request, status int, view token.TokenView) {
+	etag := ETag(view)
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodGet {
+		if header := r.Header.Get("If-None-Match"); header != "" && etagListContains(header, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeJSON(w, status, view)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// decodeBody decodes a JSON request body into v, refusing unknown fields and bodies
+// larger than maxBodyBytes.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid request body: trailing data")
+	}
+	return nil
+}
+
+func pathID(r *http.Request) (uint64, error) {
+	raw := r.PathValue("id")
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a token ID", raw)
+	}
+	return id, nil
+}
+
+// parseQuery builds a token.Query from the parameters of GET /tokens.
+func parseQuery(values url.Values) (token.Query, error) {
+	q := token.Query{Symbol: values.Get("symbol"), Cursor: values.Get("cursor"), Limit: DefaultLimit}
+	var err error
+	if q.Decimals, err = parseRange[uint8](values, "minDecimals", "maxDecimals", 8); err != nil {
+		return q, err
+	}
+	if q.FeePPM, err = parseRange[uint32](values, "minFeePPM", "maxFeePPM", 32); err != nil {
+		return q, err
+	}
+	if q.Gas, err = parseRange[uint64](values, "minGas", "maxGas", 64); err != nil {
+		return q, err
+	}
+	if q.Flags.Require, err = parseFlags(values, "requireFlags"); err != nil {
+		return q, err
+	}
+	if q.Flags.Exclude, err = parseFlags(values, "excludeFlags"); err != nil {
+		return q, err
+	}
+
+	switch match := values.Get("symbolMatch"); match {
+	case "", "exact":
+		q.SymbolMatch = token.SymbolExact
+	case "fold":
+		q.SymbolMatch = token.SymbolFold
+	case "prefix":
+		q.SymbolMatch = token.SymbolPrefix
+	case "substring":
+		q.SymbolMatch = token.SymbolSubstring
+	default:
+		return q, fmt.Errorf("symbolMatch: unknown match %q", match)
+	}
+	switch order := values.Get("orderBy"); order {
+	case "", "id":
+		q.OrderBy = token.OrderByID
+	case "symbol":
+		q.OrderBy = token.OrderBySymbol
+	case "address":
+		q.OrderBy = token.OrderByAddress
+	default:
+		return q, fmt.Errorf("orderBy: unknown order %q", order)
+	}
+	switch direction := values.Get("order"); direction {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, fmt.Errorf("order: must be asc or desc, not %q", direction)
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return q, fmt.Errorf("limit: must be between 1 and %d", MaxLimit)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// parseRange reads an inclusive range from a pair of parameters. It returns nil when both
+// are absent; a missing bound is open.
+func parseRange[T uint8 | uint32 | uint64](values url.Values, minKey, maxKey string, bits int) (*token.Range[T], error) {
+	rawMin, rawMax := values.Get(minKey), values.Get(maxKey)
+	if rawMin == "" && rawMax == "" {
+		return nil, nil
+	}
+	r := &token.Range[T]{Max: ^T(0)}
+	if rawMin != "" {
+		v, err := strconv.ParseUint(rawMin, 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", minKey, err)
+		}
+		r.Min = T(v)
+	}
+	if rawMax != "" {
+		v, err := strconv.ParseUint(rawMax, 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", maxKey, err)
+		}
+		r.Max = T(v)
+	}
+	return r, nil
+}
+
+func parseFlags(values url.Values, key string) (token.RiskFlags, error) {
+	flags, err := token.ParseRiskFlags(values.Get(key))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return flags, nil
+}
+
+func parseBool(values url.Values, key string) (bool, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,317 @@
+package tokenhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+func addr(b byte) common.Address {
+	var a common.Address
+	a[0] = b
+	return a
+}
+
+// newTestServer serves a TokenSystem holding WETH (ID 1), USDC (ID 2) and USDT (ID 3).
+func newTestServer(t *testing.T) (*httptest.Server, *token.TokenSystem) {
+	ts := token.NewTokenSystem()
+	for i, symbol := range []string{"WETH", "USDC", "USDT"} {
+		_, err := ts.AddToken(addr(byte(i+1)), symbol+" Token", symbol, 18)
+		require.NoError(t, err)
+	}
+	srv := httptest.NewServer(NewHandler(ts))
+	t.Cleanup(srv.Close)
+	return srv, ts
+}
+
+// do sends a request with an optional JSON body and headers given as name, value pairs.
+func do(t *testing.T, method, url, body string, headers ...string) *http.Response {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	require.NoError(t, err)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	var v T
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	return v
+}
+
+// requireProblem checks that resp is a problem document with the given status.
+func requireProblem(t *testing.T, resp *http.Response, status int) Problem {
+	require.Equal(t, status, resp.StatusCode)
+	require.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	p := decode[Problem](t, resp)
+	require.Equal(t, status, p.Status)
+	return p
+}
+
+// --- Unit Tests ---
+
+func TestHandler_Lookup(t *testing.T) {
+	t.Parallel()
+	srv, _ := newTestServer(t)
+
+	resp := do(t, http.MethodGet, srv.URL+"/tokens/2", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+	view := decode[token.TokenView](t, resp)
+	assert.Equal(t, "USDC", view.Symbol)
+	assert.Equal(t, addr(2), view.Address)
+
+	resp = do(t, http.MethodGet, srv.URL+"/tokens/address/"+addr(3).Hex(), "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, uint64(3), decode[token.TokenView](t, resp).ID)
+
+	resp = do(t, http.MethodGet, srv.URL+"/tokens/symbol/usdt?fold=true", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	views := decode[[]token.TokenView](t, resp)
+	require.Len(t, views, 1)
+	assert.Equal(t, uint64(3), views[0].ID)
+
+	resp = do(t, http.MethodGet, srv.URL+"/tokens/symbol/usdt", "")
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(data), "no exact match is an empty list")
+
+	requireProblem(t, do(t, http.MethodGet, srv.URL+"/tokens/99", ""), http.StatusNotFound)
+	requireProblem(t, do(t, http.MethodGet, srv.URL+"/tokens/address/"+addr(9).Hex(), ""), http.StatusNotFound)
+	requireProblem(t, do(t, http.MethodGet, srv.URL+"/tokens/abc", ""), http.StatusBadRequest)
+	requireProblem(t, do(t, http.MethodGet, srv.URL+"/tokens/address/0x12", ""), http.StatusBadRequest)
+}
+
+func TestHandler_List(t *testing.T) {
+	t.Parallel()
+	srv, ts := newTestServer(t)
+	require.NoError(t, ts.UpdateTokenPPM(3, 10_000, 65_000))
+	require.NoError(t, ts.SetFlags(2, token.FlagBlacklistable|token.FlagUpgradeable))
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []uint64
+	}{
+		{name: "Everything", query: "", expected: []uint64{1, 2, 3}},
+		{name: "Descending", query: "?order=desc", expected: []uint64{3, 2, 1}},
+		{name: "By symbol", query: "?orderBy=symbol", expected: []uint64{2, 3, 1}},
+		{name: "Symbol prefix", query: "?symbol=us&symbolMatch=prefix", expected: []uint64{2, 3}},
+		{name: "Fee", query: "?minFeePPM=1", expected: []uint64{3}},
+		{name: "Gas", query: "?maxGas=60000", expected: []uint64{1, 2}},
+		{name: "Required flags", query: "?requireFlags=blacklistable", expected: []uint64{2}},
+		{name: "Excluded flags", query: "?excludeFlags=upgradeable,honeypot", expected: []uint64{1, 3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := do(t, http.MethodGet, srv.URL+"/tokens"+tc.query, "")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			list := decode[ListResponse](t, resp)
+			var ids []uint64
+			for _, view := range list.Tokens {
+				ids = append(ids, view.ID)
+			}
+			assert.Equal(t, tc.expected, ids)
+			assert.Equal(t, len(tc.expected), list.Total)
+			assert.Empty(t, list.NextCursor)
+		})
+	}
+
+	for _, query := range []string{
+		"?limit=0", "?limit=1001", "?minDecimals=256", "?orderBy=name",
+		"?order=up", "?symbolMatch=regex", "?requireFlags=mintable", "?cursor=!!!",
+	} {
+		requireProblem(t, do(t, http.MethodGet, srv.URL+"/tokens"+query, ""), http.StatusBadRequest)
+	}
+}
+
+func TestHandler_ListPagination(t *testing.T) {
+	t.Parallel()
+	srv, _ := newTestServer(t)
+
+	var ids []uint64
+	url := srv.URL + "/tokens?orderBy=symbol&limit=2"
+	for pages := 1; ; pages++ {
+		require.LessOrEqual(t, pages, 2)
+		list := decode[ListResponse](t, do(t, http.MethodGet, url, ""))
+		assert.Equal(t, 3, list.Total)
+		for _, view := range list.Tokens {
+			ids = append(ids, view.ID)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		url = srv.URL + "/tokens?orderBy=symbol&limit=2&cursor=" + list.NextCursor
+	}
+	assert.Equal(t, []uint64{2, 3, 1}, ids)
+}
+
+func TestHandler_Add(t *testing.T) {
+	t.Parallel()
+	srv, ts := newTestServer(t)
+
+	body := fmt.Sprintf(`{"address":%q,"name":"Dai Stablecoin","symbol":"DAI","decimals":18}`, addr(4).Hex())
+	resp := do(t, http.MethodPost, srv.URL+"/tokens", body)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "/tokens/4", resp.Header.Get("Location"))
+	view := decode[token.TokenView](t, resp)
+	assert.Equal(t, "DAI", view.Symbol)
+	assert.Equal(t, ETag(view), resp.Header.Get("ETag"))
+	stored, err := ts.GetTokenByID(4)
+	require.NoError(t, err)
+	assert.Equal(t, view, stored)
+
+	requireProblem(t, do(t, http.MethodPost, srv.URL+"/tokens", body), http.StatusConflict)
+
+	p := requireProblem(t, do(t, http.MethodPost, srv.URL+"/tokens",
+		`{"address":"0x0000000000000000000000000000000000000000","name":"Empty","symbol":"","decimals":18}`),
+		http.StatusUnprocessableEntity)
+	require.Len(t, p.Errors, 2)
+	assert.ElementsMatch(t, []string{"address", "symbol"}, []string{p.Errors[0].Field, p.Errors[1].Field})
+
+	_, err = ts.SetDenylist(token.NewAddressList(addr(6)))
+	require.NoError(t, err)
+	requireProblem(t, do(t, http.MethodPost, srv.URL+"/tokens",
+		fmt.Sprintf(`{"address":%q,"name":"Bad","symbol":"BAD","decimals":18}`, addr(6).Hex())),
+		http.StatusForbidden)
+
+	requireProblem(t, do(t, http.MethodPost, srv.URL+"/tokens", `{"address":`), http.StatusBadRequest)
+	requireProblem(t, do(t, http.MethodPost, srv.URL+"/tokens", `{"symbol":"X","admin":true}`), http.StatusBadRequest)
+}
+
+func TestHandler_Update(t *testing.T) {
+	t.Parallel()
+	srv, ts := newTestServer(t)
+
+	resp := do(t, http.MethodPatch, srv.URL+"/tokens/3", `{"feeOnTransferPPM":20000,"flags":12}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	view := decode[token.TokenView](t, resp)
+	assert.Equal(t, uint32(20_000), view.FeeOnTransferPPM)
+	assert.Equal(t, token.FlagPausable|token.FlagUpgradeable, view.Flags)
+
+	resp = do(t, http.MethodPatch, srv.URL+"/tokens/3", `{"gasForTransfer":70000,"flags":4}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	view = decode[token.TokenView](t, resp)
+	assert.Equal(t, uint32(20_000), view.FeeOnTransferPPM, "omitted fields are unchanged")
+	assert.Equal(t, uint64(70_000), view.GasForTransfer)
+	assert.Equal(t, token.FlagPausable, view.Flags, "flags are replaced")
+	stored, err := ts.GetTokenByID(3)
+	require.NoError(t, err)
+	assert.Equal(t, view, stored)
+
+	requireProblem(t, do(t, http.MethodPatch, srv.URL+"/tokens/3", `{"feeOnTransferPPM":2000000}`), http.StatusUnprocessableEntity)
+	requireProblem(t, do(t, http.MethodPatch, srv.URL+"/tokens/99", `{"gasForTransfer":1}`), http.StatusNotFound)
+	requireProblem(t, do(t, http.MethodPatch, srv.URL+"/tokens/3", `{"fee":1}`), http.StatusBadRequest)
+}
+
+func TestHandler_ETags(t *testing.T) {
+	t.Parallel()
+	srv, ts := newTestServer(t)
+
+	etag := do(t, http.MethodGet, srv.URL+"/tokens/1", "").Header.Get("ETag")
+	resp := do(t, http.MethodGet, srv.URL+"/tokens/1", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// A change by someone else makes the tag stale.
+	require.NoError(t, ts.UpdateTokenPPM(1, 0, 30_000))
+	requireProblem(t, do(t, http.MethodPatch, srv.URL+"/tokens/1", `{"gasForTransfer":1}`, "If-Match", etag), http.StatusPreconditionFailed)
+	requireProblem(t, do(t, http.MethodDelete, srv.URL+"/tokens/1", "", "If-Match", etag), http.StatusPreconditionFailed)
+	stored, err := ts.GetTokenByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(30_000), stored.GasForTransfer, "a failed precondition changes nothing")
+
+	resp = do(t, http.MethodGet, srv.URL+"/tokens/1", "", "If-None-Match", etag)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag = resp.Header.Get("ETag")
+
+	// If-None-Match compares weakly; If-Match must not accept a weak tag.
+	resp = do(t, http.MethodGet, srv.URL+"/tokens/1", "", "If-None-Match", "W/"+etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	requireProblem(t, do(t, http.MethodPatch, srv.URL+"/tokens/1", `{"gasForTransfer":1}`, "If-Match", "W/"+etag), http.StatusPreconditionFailed)
+
+	resp = do(t, http.MethodPatch, srv.URL+"/tokens/1", `{"gasForTransfer":35000}`, "If-Match", etag)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	etag = resp.Header.Get("ETag")
+
+	resp = do(t, http.MethodDelete, srv.URL+"/tokens/1", "", "If-Match", etag)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	requireProblem(t, do(t, http.MethodDelete, srv.URL+"/tokens/1", ""), http.StatusNotFound)
+}
+
+func TestHandler_ConcurrentConditionalUpdates(t *testing.T) {
+	t.Parallel()
+	srv, _ := newTestServer(t)
+	etag := do(t, http.MethodGet, srv.URL+"/tokens/1", "").Header.Get("ETag")
+
+	// Every writer holds the same tag, so exactly one of them can win.
+	const writers = 8
+	statuses := make([]int, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"gasForTransfer":%d}`, 40_000+i)
+			statuses[i] = do(t, http.MethodPatch, srv.URL+"/tokens/1", body, "If-Match", etag).StatusCode
+		}()
+	}
+	wg.Wait()
+
+	var won int
+	for _, status := range statuses {
+		if status == http.StatusOK {
+			won++
+		} else {
+			assert.Equal(t, http.StatusPreconditionFailed, status)
+		}
+	}
+	assert.Equal(t, 1, won)
+}
+
+func TestStatusOf(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		err      error
+		expected int
+	}{
+		{err: fmt.Errorf("wrapped: %w", token.ErrTokenNotFound), expected: http.StatusNotFound},
+		{err: token.ErrAlreadyExists, expected: http.StatusConflict},
+		{err: token.ErrImpersonation, expected: http.StatusConflict},
+		{err: token.ErrDenied, expected: http.StatusForbidden},
+		{err: &token.ValidationError{}, expected: http.StatusUnprocessableEntity},
+		{err: token.ErrInvalidFeeRate, expected: http.StatusUnprocessableEntity},
+		{err: token.ErrInvalidCursor, expected: http.StatusBadRequest},
+		{err: token.ErrWALClosed, expected: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, statusOf(tc.err), "%v", tc.err)
+	}
+
+	rec := httptest.NewRecorder()
+	writeError(rec, token.ErrWALClosed)
+	assert.NotContains(t, rec.Body.String(), "write-ahead log", "internal errors are not exposed")
+}
@@ -0,0 +1,61 @@
+package tokenhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+)
+
+// Problem is an RFC 9457 problem document, the body of every error response.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists the failed rules when a token is rejected by validation.
+	Errors []token.FieldError `json:"errors,omitempty"`
+}
+
+// statusOf maps an error from the TokenSystem to an HTTP status.
+func statusOf(err error) int {
+	var validation *token.ValidationError
+	switch {
+	case errors.Is(err, token.ErrTokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, token.ErrAlreadyExists), errors.Is(err, token.ErrImpersonation):
+		return http.StatusConflict
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, token.ErrDenied):
+		return http.StatusForbidden
+	case errors.Is(err, token.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.As(err, &validation), errors.Is(err, token.ErrInvalidToken), errors.Is(err, token.ErrInvalidFeeRate):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError writes err as a problem document with the status chosen by statusOf.
+func writeError(w http.ResponseWriter, err error) {
+	writeProblem(w, statusOf(err), err)
+}
+
+// writeProblem writes err as a problem document. The details of internal errors are
+// not exposed.
+func writeProblem(w http.ResponseWriter, status int, err error) {
+	p := Problem{Type: "about:blank", Title: http.StatusText(status), Status: status}
+	if status != http.StatusInternalServerError {
+		p.Detail = err.Error()
+	}
+	var validation *token.ValidationError
+	if errors.As(err, &validation) {
+		p.Errors = validation.Fields
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,506 @@
+package token
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Limits from the tokenlists.org JSON schema. Lengths count characters, not bytes.
+const (
+	maxTokenListNameLen    = 30
+	maxTokenListTokens     = 10000
+	maxTokenListKeywords   = 20
+	maxTokenListKeywordLen = 20
+	maxTokenListTags       = 20
+	maxTokenListTagIDLen   = 10
+	maxTokenListTagNameLen = 20
+	maxTokenListTagDescLen = 200
+	maxTokenInfoNameLen    = 60
+	maxTokenInfoSymbolLen  = 20
+	maxTokenInfoTags       = 10
+)
+
+var (
+	tokenListWordsPattern  = regexp.MustCompile(`^[\w ]+$`)
+	tokenListTagIDPattern  = regexp.MustCompile(`^[\w]+$`)
+	tokenInfoNamePattern   = regexp.MustCompile(`^[ \S+]+$`)
+	tokenInfoSymbolPattern = regexp.MustCompile(`^\S*$`)
+	tokenAddressPattern    = regexp.MustCompile(`^0x[a-fA-F0-9]{40}$`)
+)
+
+// ErrInvalidTokenList is wrapped by every problem ValidateTokenList reports.
+var ErrInvalidTokenList = errors.New("invalid token list")
+
+// TokenList is a token list in the Uniswap standard (https://tokenlists.org) format.
+type TokenList struct {
+	Name      string                  `json:"name"`
+	Timestamp time.Time               `json:"timestamp"`
+	Version   TokenListVersion        `json:"version"`
+	Tokens    []TokenInfo             `json:"tokens"`
+	LogoURI   string                  `json:"logoURI,omitempty"`
+	Keywords  []string                `json:"keywords,omitempty"`
+	Tags      map[string]TokenListTag `json:"tags,omitempty"`
+}
+
+// TokenListVersion is the semantic version of a token list.
+type TokenListVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// String formats the version as major.minor.patch.
+func (v TokenListVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// TokenListTag describes a tag that tokens in the list may carry.
+type TokenListTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TokenInfo is a single token entry of a token list.
+type TokenInfo struct {
+	ChainID    uint64          `json:"chainId"`
+	Address    string          `json:"address"`
+	Name       string          `json:"name"`
+	Symbol     string          `json:"symbol"`
+	Decimals   uint8           `json:"decimals"`
+	LogoURI    string          `json:"logoURI,omitempty"`
+	Tags       []string        `json:"tags,omitempty"`
+	Extensions json.RawMessage `json:"extensions,omitempty"`
+}
+
+// key identifies a token across lists. Addresses are compared case-insensitively.
+func (t TokenInfo) key() tokenListKey {
+	return tokenListKey{chainID: t.ChainID, address: common.HexToAddress(t.Address)}
+}
+
+type tokenListKey struct {
+	chainID uint64
+	address common.Address
+}
+
+// ReadTokenList decodes a token list from JSON and validates it.
+func ReadTokenList(r io.Reader) (*TokenList, error) {
+	var list TokenList
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTokenList, err)
+	}
+	if err := ValidateTokenList(&list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// WriteTokenList encodes a token list as indented JSON.
+func WriteTokenList(w io.Writer, list *TokenList) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
+
+// ValidateTokenList checks a list against the constraints of the tokenlists.org schema,
+// and additionally requires tokens to be unique by chain ID and address and token tags to
+// be defined by the list. Every problem found is reported; each wraps ErrInvalidTokenList.
+func ValidateTokenList(list *TokenList) error {
+	var problems []error
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf("%w: %s", ErrInvalidTokenList, fmt.Sprintf(format, args...)))
+	}
+
+	if list.Name == "" || utf8.RuneCountInString(list.Name) > maxTokenListNameLen || !tokenListWordsPattern.MatchString(list.Name) {
+		problem("name %q must be 1-%d letters, digits, underscores or spaces", list.Name, maxTokenListNameLen)
+	}
+	if list.Timestamp.IsZero() {
+		problem("timestamp is required")
+	}
+	if list.Version.Major < 0 || list.Version.Minor < 0 || list.Version.Patch < 0 {
+		problem("version %s must not be negative", list.Version)
+	}
+	if list.LogoURI != "" && !validURI(list.LogoURI) {
+		problem("logoURI %q is not a URI", list.LogoURI)
+	}
+	if len(list.Keywords) > maxTokenListKeywords {
+		problem("%d keywords exceed the limit of %d", len(list.Keywords), maxTokenListKeywords)
+	}
+	for i, kw := range list.Keywords {
+		if utf8.RuneCountInString(kw) > maxTokenListKeywordLen || !tokenListWordsPattern.MatchString(kw) {
+			problem("keywords[%d] %q must be 1-%d letters, digits, underscores or spaces", i, kw, maxTokenListKeywordLen)
+		}
+		if slices.Index(list.Keywords, kw) != i {
+			problem("keywords[%d] %q is repeated", i, kw)
+		}
+	}
+	if len(list.Tags) > maxTokenListTags {
+		problem("%d tags exceed the limit of %d", len(list.Tags), maxTokenListTags)
+	}
+	tagIDs := make([]string, 0, len(list.Tags))
+	for id := range list.Tags {
+		tagIDs = append(tagIDs, id)
+	}
+	slices.Sort(tagIDs)
+	for _, id := range tagIDs {
+		tag := list.Tags[id]
+		if utf8.RuneCountInString(id) > maxTokenListTagIDLen || !tokenListTagIDPattern.MatchString(id) {
+			problem("tag ID %q must be 1-%d letters, digits or underscores", id, maxTokenListTagIDLen)
+		}
+		if tag.Name == "" || utf8.RuneCountInString(tag.Name) > maxTokenListTagNameLen || !tokenListWordsPattern.MatchString(tag.Name) {
+			problem("tags.%s.name %q must be 1-%d letters, digits, underscores or spaces", id, tag.Name, maxTokenListTagNameLen)
+		}
+		if tag.Description == "" || utf8.RuneCountInString(tag.Description) > maxTokenListTagDescLen {
+			problem("tags.%s.description must be 1-%d characters", id, maxTokenListTagDescLen)
+		}
+	}
+
+	if len(list.Tokens) == 0 || len(list.Tokens) > maxTokenListTokens {
+		problem("a list must have 1-%d tokens, not %d", maxTokenListTokens, len(list.Tokens))
+	}
+	seen := make(map[tokenListKey]int, len(list.Tokens))
+	for i, tok := range list.Tokens {
+		if tok.ChainID == 0 {
+			problem("tokens[%d].chainId must be positive", i)
+		}
+		if !tokenAddressPattern.MatchString(tok.Address) {
+			problem("tokens[%d].address %q is not a hex address", i, tok.Address)
+		} else if first, dup := seen[tok.key()]; dup {
+			problem("tokens[%d] repeats tokens[%d] (chain %d, %s)", i, first, tok.ChainID, tok.Address)
+		} else {
+			seen[tok.key()] = i
+		}
+		for _, p := range tokenInfoMetadataProblems(tok) {
+			problem("tokens[%d].%s", i, p)
+		}
+		if tok.LogoURI != "" && !validURI(tok.LogoURI) {
+			problem("tokens[%d].logoURI %q is not a URI", i, tok.LogoURI)
+		}
+		if len(tok.Tags) > maxTokenInfoTags {
+			problem("tokens[%d] has %d tags, more than the limit of %d", i, len(tok.Tags), maxTokenInfoTags)
+		}
+		for _, tag := range tok.Tags {
+			if _, ok := list.Tags[tag]; !ok {
+				problem("tokens[%d] uses undefined tag %q", i, tag)
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// tokenInfoMetadataProblems checks a token's name and symbol against the schema patterns.
+// Each problem starts with the field name.
+func tokenInfoMetadataProblems(tok TokenInfo) []string {
+	var problems []string
+	if utf8.RuneCountInString(tok.Name) > maxTokenInfoNameLen || (tok.Name != "" && !tokenInfoNamePattern.MatchString(tok.Name)) {
+		problems = append(problems, fmt.Sprintf("name %q must be at most %d characters without tabs or newlines", tok.Name, maxTokenInfoNameLen))
+	}
+	if utf8.RuneCountInString(tok.Symbol) > maxTokenInfoSymbolLen || !tokenInfoSymbolPattern.MatchString(tok.Symbol) {
+		problems = append(problems, fmt.Sprintf("symbol %q must be at most %d characters without whitespace", tok.Symbol, maxTokenInfoSymbolLen))
+	}
+	return problems
+}
+
+// validURI reports whether s is an absolute URI, such as https:// or ipfs://.
+func validURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
+
+// VersionBump is the kind of semantic version increment a change requires.
+type VersionBump uint8
+
+const (
+	BumpNone VersionBump = iota
+	BumpPatch
+	BumpMinor
+	BumpMajor
+)
+
+// TokenListDiff describes how the tokens of one list differ from another's. Tokens are
+// matched by chain ID and address.
+type TokenListDiff struct {
+	Added   []TokenInfo
+	Removed []TokenInfo
+	// Changed holds the new version of every token whose details differ.
+	Changed []TokenInfo
+}
+
+// DiffTokenLists compares the tokens of a base list with those of an update.
+func DiffTokenLists(base, update []TokenInfo) TokenListDiff {
+	var diff TokenListDiff
+	baseByKey := make(map[tokenListKey]TokenInfo, len(base))
+	for _, tok := range base {
+		baseByKey[tok.key()] = tok
+	}
+	updateKeys := make(map[tokenListKey]struct{}, len(update))
+	for _, tok := range update {
+		updateKeys[tok.key()] = struct{}{}
+		old, existed := baseByKey[tok.key()]
+		switch {
+		case !existed:
+			diff.Added = append(diff.Added, tok)
+		case !sameTokenInfo(old, tok):
+			diff.Changed = append(diff.Changed, tok)
+		}
+	}
+	for _, tok := range base {
+		if _, kept := updateKeys[tok.key()]; !kept {
+			diff.Removed = append(diff.Removed, tok)
+		}
+	}
+	return diff
+}
+
+// sameTokenInfo compares every field of two entries for the same token.
+func sameTokenInfo(a, b TokenInfo) bool {
+	return a.Name == b.Name && a.Symbol == b.Symbol && a.Decimals == b.Decimals &&
+		a.LogoURI == b.LogoURI && slices.Equal(a.Tags, b.Tags) && string(a.Extensions) == string(b.Extensions)
+}
+
+// Bump returns the version increment the diff requires: major if any token was removed,
+// minor if any was added, patch if any changed, and none otherwise.
+func (d TokenListDiff) Bump() VersionBump {
+	switch {
+	case len(d.Removed) > 0:
+		return BumpMajor
+	case len(d.Added) > 0:
+		return BumpMinor
+	case len(d.Changed) > 0:
+		return BumpPatch
+	default:
+		return BumpNone
+	}
+}
+
+// Apply returns the version incremented by the bump.
+func (b VersionBump) Apply(v TokenListVersion) TokenListVersion {
+	switch b {
+	case BumpMajor:
+		return TokenListVersion{Major: v.Major + 1}
+	case BumpMinor:
+		return TokenListVersion{Major: v.Major, Minor: v.Minor + 1}
+	case BumpPatch:
+		return TokenListVersion{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	default:
+		return v
+	}
+}
+
+// TokenListExportOptions configures ExportTokenList.
+type TokenListExportOptions struct {
+	// Name is the list name. Empty means the name of Previous.
+	Name string
+	// Previous is the last published version of the list. Its version is bumped according
+	// to what changed, its list metadata and per-token logoURI, tags and extensions are
+	// carried over, and its tokens for other chains are kept unchanged. Nil starts a new
+	// list at version 1.0.0.
+	Previous *TokenList
+	// Timestamp is the list timestamp. Zero means the current time.
+	Timestamp time.Time
+}
+
+// TokenListExport reports the outcome of ExportTokenList.
+type TokenListExport struct {
+	List *TokenList
+	// Skipped holds the registry tokens left out of List because their name or symbol
+	// breaks the schema, for example a symbol containing a space. Each error wraps
+	// ErrInvalidTokenList.
+	Skipped map[common.Address]error
+}
+
+// ExportTokenList builds a token list whose chainID tokens are those of the registry,
+// ordered by token ID, followed by any tokens Previous lists for other chains. Tokens
+// whose name or symbol the schema does not allow are skipped and reported rather than
+// failing the export; if Previous listed them, the new version counts them as removed.
+// The result is validated before it is returned.
+func (ts *TokenSystem) ExportTokenList(chainID uint64, opts TokenListExportOptions) (TokenListExport, error) {
+	views := ts.View()
+	slices.SortFunc(views, func(a, b TokenView) int { return cmp.Compare(a.ID, b.ID) })
+
+	list := &TokenList{
+		Name:      opts.Name,
+		Timestamp: opts.Timestamp,
+		Version:   TokenListVersion{Major: 1},
+		Tokens:    make([]TokenInfo, 0, len(views)),
+	}
+	if list.Timestamp.IsZero() {
+		list.Timestamp = time.Now().UTC().Truncate(time.Second)
+	}
+
+	previous := make(map[tokenListKey]TokenInfo)
+	if prev := opts.Previous; prev != nil {
+		if list.Name == "" {
+			list.Name = prev.Name
+		}
+		list.LogoURI = prev.LogoURI
+		list.Keywords = slices.Clone(prev.Keywords)
+		list.Tags = maps.Clone(prev.Tags)
+		for _, tok := range prev.Tokens {
+			previous[tok.key()] = tok
+		}
+	}
+
+	result := TokenListExport{List: list, Skipped: make(map[common.Address]error)}
+	for _, v := range views {
+		tok := TokenInfo{
+			ChainID:  chainID,
+			Address:  v.Address.Hex(),
+			Name:     v.Name,
+			Symbol:   v.Symbol,
+			Decimals: v.Decimals,
+		}
+		if problems := tokenInfoMetadataProblems(tok); len(problems) > 0 {
+			result.Skipped[v.Address] = fmt.Errorf("%w: %s", ErrInvalidTokenList, strings.Join(problems, "; "))
+			continue
+		}
+		if prev, ok := previous[tok.key()]; ok {
+			tok.LogoURI, tok.Tags, tok.Extensions = prev.LogoURI, slices.Clone(prev.Tags), bytes.Clone(prev.Extensions)
+		}
+		list.Tokens = append(list.Tokens, tok)
+	}
+
+	if prev := opts.Previous; prev != nil {
+		for _, tok := range prev.Tokens {
+			if tok.ChainID != chainID {
+				tok.Tags, tok.Extensions = slices.Clone(tok.Tags), bytes.Clone(tok.Extensions)
+				list.Tokens = append(list.Tokens, tok)
+			}
+		}
+		list.Version = DiffTokenLists(prev.Tokens, list.Tokens).Bump().Apply(prev.Version)
+	}
+	if err := ValidateTokenList(list); err != nil {
+		return TokenListExport{}, err
+	}
+	return result, nil
+}
+
+// TokenListConflict reports a token that several lists describe differently. The entry
+// from the earliest list is the one that was kept.
+type TokenListConflict struct {
+	ChainID uint64
+	Address common.Address
+	// Fields names the fields that differ, such as "symbol" or "decimals".
+	Fields []string
+	// Lists holds the name of every list that contained the token, in input order, and
+	// Entries the corresponding entries.
+	Lists   []string
+	Entries []TokenInfo
+}
+
+// MergeTokenLists combines the tokens of several lists. When lists disagree about a
+// token's name, symbol or decimals, the earliest list wins and a conflict is reported.
+func MergeTokenLists(lists ...*TokenList) ([]TokenInfo, []TokenListConflict) {
+	var merged []TokenInfo
+	type occurrence struct {
+		mergedIndex int
+		listName    string // Name of the list the kept entry came from
+		conflict    *TokenListConflict
+	}
+	byKey := make(map[tokenListKey]*occurrence)
+	var conflicts []*TokenListConflict
+
+	for _, list := range lists {
+		for _, tok := range list.Tokens {
+			occ, seen := byKey[tok.key()]
+			if !seen {
+				byKey[tok.key()] = &occurrence{mergedIndex: len(merged), listName: list.Name}
+				merged = append(merged, tok)
+				continue
+			}
+			kept := merged[occ.mergedIndex]
+			fields := conflictingFields(kept, tok)
+			if len(fields) == 0 {
+				continue
+			}
+			if occ.conflict == nil {
+				occ.conflict = &TokenListConflict{
+					ChainID: tok.ChainID,
+					Address: common.HexToAddress(tok.Address),
+					Lists:   []string{occ.listName},
+					Entries: []TokenInfo{kept},
+				}
+				conflicts = append(conflicts, occ.conflict)
+			}
+			for _, f := range fields {
+				if !slices.Contains(occ.conflict.Fields, f) {
+					occ.conflict.Fields = append(occ.conflict.Fields, f)
+				}
+			}
+			occ.conflict.Lists = append(occ.conflict.Lists, list.Name)
+			occ.conflict.Entries = append(occ.conflict.Entries, tok)
+		}
+	}
+
+	result := make([]TokenListConflict, len(conflicts))
+	for i, c := range conflicts {
+		result[i] = *c
+	}
+	return merged, result
+}
+
+// conflictingFields names the registry fields in which two entries for a token differ.
+func conflictingFields(a, b TokenInfo) []string {
+	var fields []string
+	if a.Name != b.Name {
+		fields = append(fields, "name")
+	}
+	if a.Symbol != b.Symbol {
+		fields = append(fields, "symbol")
+	}
+	if a.Decimals != b.Decimals {
+		fields = append(fields, "decimals")
+	}
+	return fields
+}
+
+// TokenListImport reports the outcome of ImportTokenLists.
+type TokenListImport struct {
+	BatchResult
+	Conflicts []TokenListConflict
+}
+
+// ImportTokenLists validates each list, merges them with MergeTokenLists and adds the
+// tokens for chainID with AddTokens. Tokens for other chains are ignored. Addresses that
+// are already registered are reported in Failed with ErrAlreadyExists and left unchanged.
+func (ts *TokenSystem) ImportTokenLists(chainID uint64, lists ...*TokenList) (TokenListImport, error) {
+	for _, list := range lists {
+		if err := ValidateTokenList(list); err != nil {
+			return TokenListImport{}, fmt.Errorf("list %q: %w", list.Name, err)
+		}
+	}
+	merged, conflicts := MergeTokenLists(lists...)
+
+	tokens := make([]TokenMetadata, 0, len(merged))
+	for _, tok := range merged {
+		if tok.ChainID != chainID {
+			continue
+		}
+		tokens = append(tokens, TokenMetadata{
+			Address:  common.HexToAddress(tok.Address),
+			Name:     tok.Name,
+			Symbol:   tok.Symbol,
+			Decimals: tok.Decimals,
+		})
+	}
+
+	chainConflicts := conflicts[:0]
+	for _, c := range conflicts {
+		if c.ChainID == chainID {
+			chainConflicts = append(chainConflicts, c)
+		}
+	}
+	return TokenListImport{BatchResult: ts.AddTokens(tokens), Conflicts: chainConflicts}, nil
+}
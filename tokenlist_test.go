@@ -0,0 +1,273 @@
+package token
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+const testTokenListJSON = `{
+  "name": "Test List",
+  "timestamp": "2024-05-01T00:00:00Z",
+  "version": {"major": 2, "minor": 3, "patch": 4},
+  "logoURI": "ipfs://QmTestLogo",
+  "keywords": ["test", "stable"],
+  "tags": {"stable": {"name": "Stablecoin", "description": "Pegged to a fiat currency"}},
+  "tokens": [
+    {"chainId": 1, "address": "0x0100000000000000000000000000000000000000", "name": "USD Coin", "symbol": "USDC", "decimals": 6, "logoURI": "https://example.com/usdc.png", "tags": ["stable"]},
+    {"chainId": 1, "address": "0x0200000000000000000000000000000000000000", "name": "Wrapped Ether", "symbol": "WETH", "decimals": 18, "extensions": {"bridgeInfo": {"10": {"tokenAddress": "0x4200000000000000000000000000000000000006"}}}},
+    {"chainId": 10, "address": "0x0300000000000000000000000000000000000000", "name": "Optimism", "symbol": "OP", "decimals": 18}
+  ]
+}`
+
+// newTestTokenList builds a minimal valid list with the given tokens on chain 1.
+func newTestTokenList(name string, tokens ...TokenInfo) *TokenList {
+	for i := range tokens {
+		if tokens[i].ChainID == 0 {
+			tokens[i].ChainID = 1
+		}
+	}
+	return &TokenList{
+		Name:      name,
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Version:   TokenListVersion{Major: 1},
+		Tokens:    tokens,
+	}
+}
+
+// tokenInfo builds a chain 1 entry for addr(b).
+func tokenInfo(b byte, symbol string, decimals uint8) TokenInfo {
+	return TokenInfo{ChainID: 1, Address: addr(b).Hex(), Name: symbol + " Token", Symbol: symbol, Decimals: decimals}
+}
+
+// --- Unit Tests ---
+
+func TestReadTokenList(t *testing.T) {
+	t.Parallel()
+	list, err := ReadTokenList(strings.NewReader(testTokenListJSON))
+	require.NoError(t, err)
+	assert.Equal(t, "Test List", list.Name)
+	assert.Equal(t, "2.3.4", list.Version.String())
+	require.Len(t, list.Tokens, 3)
+	assert.Equal(t, []string{"stable"}, list.Tokens[0].Tags)
+	assert.JSONEq(t, `{"bridgeInfo": {"10": {"tokenAddress": "0x4200000000000000000000000000000000000006"}}}`, string(list.Tokens[1].Extensions))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteTokenList(&buf, list))
+	assert.JSONEq(t, testTokenListJSON, buf.String())
+
+	_, err = ReadTokenList(strings.NewReader(`{"name": `))
+	assert.ErrorIs(t, err, ErrInvalidTokenList)
+}
+
+func TestValidateTokenList(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		modify   func(l *TokenList)
+		problems []string
+	}{
+		{name: "Valid", modify: func(l *TokenList) {}},
+		{name: "Bad name", modify: func(l *TokenList) { l.Name = "Name: with punctuation!" }, problems: []string{"name"}},
+		{name: "Missing timestamp", modify: func(l *TokenList) { l.Timestamp = time.Time{} }, problems: []string{"timestamp"}},
+		{name: "No tokens", modify: func(l *TokenList) { l.Tokens = nil }, problems: []string{"1-10000 tokens"}},
+		{name: "Bad address", modify: func(l *TokenList) { l.Tokens[0].Address = "0x123" }, problems: []string{"tokens[0].address"}},
+		{name: "Zero chain", modify: func(l *TokenList) { l.Tokens[0].ChainID = 0 }, problems: []string{"tokens[0].chainId"}},
+		{name: "Symbol with space", modify: func(l *TokenList) { l.Tokens[1].Symbol = "US DC" }, problems: []string{"tokens[1].symbol"}},
+		{name: "Name limit counts characters", modify: func(l *TokenList) { l.Tokens[0].Name = strings.Repeat("é", 60) }},
+		{name: "Symbol limit counts characters", modify: func(l *TokenList) { l.Tokens[0].Symbol = strings.Repeat("€", 20) }},
+		{name: "Too many characters", modify: func(l *TokenList) { l.Tokens[0].Symbol = strings.Repeat("€", 21) }, problems: []string{"tokens[0].symbol"}},
+		{name: "Undefined tag", modify: func(l *TokenList) { l.Tokens[0].Tags = []string{"meme"} }, problems: []string{`undefined tag "meme"`}},
+		{name: "Bad logo", modify: func(l *TokenList) { l.Tokens[0].LogoURI = "not a uri" }, problems: []string{"tokens[0].logoURI"}},
+		{
+			name: "Duplicate token, case-insensitive",
+			modify: func(l *TokenList) {
+				dup := l.Tokens[0]
+				dup.Address = strings.ToLower(dup.Address)
+				l.Tokens = append(l.Tokens, dup)
+			},
+			problems: []string{"tokens[2] repeats tokens[0]"},
+		},
+		{
+			name: "Every problem is reported",
+			modify: func(l *TokenList) {
+				l.Name = ""
+				l.Keywords = []string{"dup", "dup"}
+				l.Tokens[1].Decimals = 18
+				l.Tokens[1].Symbol = strings.Repeat("X", 21)
+			},
+			problems: []string{"name", "keywords[1]", "tokens[1].symbol"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			list := newTestTokenList("Valid List", tokenInfo(1, "USDC", 6), tokenInfo(2, "WETH", 18))
+			tc.modify(list)
+			err := ValidateTokenList(list)
+			if len(tc.problems) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrInvalidTokenList)
+			assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), len(tc.problems))
+			for _, p := range tc.problems {
+				assert.Contains(t, err.Error(), p)
+			}
+		})
+	}
+}
+
+func TestDiffTokenLists(t *testing.T) {
+	t.Parallel()
+	base := []TokenInfo{tokenInfo(1, "USDC", 6), tokenInfo(2, "WETH", 18), tokenInfo(3, "DAI", 18)}
+
+	renamed := tokenInfo(2, "WETH", 18)
+	renamed.LogoURI = "https://example.com/weth.png"
+	diff := DiffTokenLists(base, []TokenInfo{tokenInfo(1, "USDC", 6), renamed, tokenInfo(4, "UNI", 18)})
+	assert.Equal(t, []TokenInfo{tokenInfo(4, "UNI", 18)}, diff.Added)
+	assert.Equal(t, []TokenInfo{tokenInfo(3, "DAI", 18)}, diff.Removed)
+	assert.Equal(t, []TokenInfo{renamed}, diff.Changed)
+
+	testCases := []struct {
+		name     string
+		update   []TokenInfo
+		expected TokenListVersion
+	}{
+		{name: "Unchanged", update: base, expected: TokenListVersion{2, 3, 4}},
+		{name: "Changed", update: []TokenInfo{tokenInfo(1, "USDC", 6), renamed, tokenInfo(3, "DAI", 18)}, expected: TokenListVersion{2, 3, 5}},
+		{name: "Added", update: append(slices.Clone(base), tokenInfo(4, "UNI", 18)), expected: TokenListVersion{2, 4, 0}},
+		{name: "Removed", update: base[:2], expected: TokenListVersion{3, 0, 0}},
+		{name: "Added and removed", update: []TokenInfo{tokenInfo(4, "UNI", 18)}, expected: TokenListVersion{3, 0, 0}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DiffTokenLists(base, tc.update).Bump().Apply(TokenListVersion{2, 3, 4}))
+		})
+	}
+}
+
+func TestTokenSystem_ExportTokenList(t *testing.T) {
+	t.Parallel()
+	previous, err := ReadTokenList(strings.NewReader(testTokenListJSON))
+	require.NoError(t, err)
+	ts := NewTokenSystem()
+	_, err = ts.ImportTokenLists(1, previous)
+	require.NoError(t, err)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Nothing changed: same version, metadata and extras carried over.
+	export, err := ts.ExportTokenList(1, TokenListExportOptions{Previous: previous, Timestamp: now})
+	require.NoError(t, err)
+	list := export.List
+	assert.Empty(t, export.Skipped)
+	assert.Equal(t, previous.Version, list.Version)
+	assert.Equal(t, previous.Name, list.Name)
+	assert.Equal(t, previous.Tags, list.Tags)
+	assert.ElementsMatch(t, previous.Tokens, list.Tokens, "other chains are kept and extras carried over")
+	list.Tags["added"] = TokenListTag{Name: "Added", Description: "Not in the previous list"}
+	assert.NotContains(t, previous.Tags, "added", "the previous list's tags are copied")
+	for i := range list.Tokens {
+		for j := range list.Tokens[i].Tags {
+			list.Tokens[i].Tags[j] = "edited"
+		}
+		for j := range list.Tokens[i].Extensions {
+			list.Tokens[i].Extensions[j] = ' '
+		}
+	}
+	assert.Equal(t, []string{"stable"}, previous.Tokens[0].Tags, "token tags are copied")
+	assert.JSONEq(t, `{"bridgeInfo": {"10": {"tokenAddress": "0x4200000000000000000000000000000000000006"}}}`, string(previous.Tokens[1].Extensions), "extensions are copied")
+
+	// Adding a token bumps the minor version.
+	_, err = ts.AddToken(addr(4), "Uniswap", "UNI", 18)
+	require.NoError(t, err)
+	export, err = ts.ExportTokenList(1, TokenListExportOptions{Previous: previous, Timestamp: now})
+	require.NoError(t, err)
+	added := export.List
+	assert.Equal(t, TokenListVersion{2, 4, 0}, added.Version)
+
+	// Removing one bumps the major version, even alongside an add.
+	weth, err := ts.GetTokenByAddress(addr(2))
+	require.NoError(t, err)
+	require.NoError(t, ts.DeleteToken(weth.ID))
+	export, err = ts.ExportTokenList(1, TokenListExportOptions{Previous: added, Timestamp: now})
+	require.NoError(t, err)
+	assert.Equal(t, TokenListVersion{3, 0, 0}, export.List.Version)
+	assert.Len(t, export.List.Tokens, 3)
+
+	// A new list starts at 1.0.0 and needs a name.
+	export, err = ts.ExportTokenList(1, TokenListExportOptions{Name: "Fresh List", Timestamp: now})
+	require.NoError(t, err)
+	assert.Equal(t, TokenListVersion{Major: 1}, export.List.Version)
+	_, err = ts.ExportTokenList(1, TokenListExportOptions{})
+	assert.ErrorIs(t, err, ErrInvalidTokenList)
+}
+
+func TestTokenSystem_ExportTokenListSkipsInvalidTokens(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	_, err := ts.AddToken(addr(1), "USD Coin", "USDC", 6)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(2), "Spaced Out", "SP ACE", 18)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(3), strings.Repeat("Long", 16), "LONG", 18)
+	require.NoError(t, err)
+
+	export, err := ts.ExportTokenList(1, TokenListExportOptions{Name: "Partial", Timestamp: time.Now()})
+	require.NoError(t, err)
+	require.Len(t, export.List.Tokens, 1)
+	assert.Equal(t, "USDC", export.List.Tokens[0].Symbol)
+	require.Len(t, export.Skipped, 2)
+	assert.ErrorIs(t, export.Skipped[addr(2)], ErrInvalidTokenList)
+	assert.ErrorContains(t, export.Skipped[addr(2)], "symbol")
+	assert.ErrorContains(t, export.Skipped[addr(3)], "name")
+}
+
+func TestMergeTokenLists(t *testing.T) {
+	t.Parallel()
+	primary := newTestTokenList("Primary", tokenInfo(1, "USDC", 6), tokenInfo(2, "WETH", 18))
+	secondary := newTestTokenList("Secondary", tokenInfo(1, "USDC", 18), tokenInfo(3, "DAI", 18))
+	lowered := tokenInfo(1, "usdc", 6)
+	lowered.Address = strings.ToLower(lowered.Address)
+	tertiary := newTestTokenList("Tertiary", lowered, tokenInfo(2, "WETH", 18))
+
+	merged, conflicts := MergeTokenLists(primary, secondary, tertiary)
+	assert.Equal(t, []TokenInfo{tokenInfo(1, "USDC", 6), tokenInfo(2, "WETH", 18), tokenInfo(3, "DAI", 18)}, merged)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, addr(1), conflicts[0].Address)
+	assert.Equal(t, []string{"decimals", "name", "symbol"}, conflicts[0].Fields)
+	assert.Equal(t, []string{"Primary", "Secondary", "Tertiary"}, conflicts[0].Lists)
+	assert.Len(t, conflicts[0].Entries, 3)
+}
+
+func TestTokenSystem_ImportTokenLists(t *testing.T) {
+	t.Parallel()
+	list, err := ReadTokenList(strings.NewReader(testTokenListJSON))
+	require.NoError(t, err)
+	override := newTestTokenList("Override", tokenInfo(1, "USDC", 18), tokenInfo(5, "LINK", 18))
+
+	ts := NewTokenSystem()
+	_, err = ts.AddToken(addr(2), "Wrapped Ether", "WETH", 18)
+	require.NoError(t, err)
+
+	result, err := ts.ImportTokenLists(1, list, override)
+	require.NoError(t, err)
+	assert.Len(t, result.Added, 2, "USDC and LINK; OP is on another chain")
+	assert.ErrorIs(t, result.Failed[addr(2)], ErrAlreadyExists)
+	require.Len(t, result.Conflicts, 1)
+	view, err := ts.GetTokenByAddress(addr(1))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(6), view.Decimals, "the first list wins a conflict")
+
+	bad := newTestTokenList("Bad List")
+	_, err = ts.ImportTokenLists(1, bad)
+	assert.ErrorIs(t, err, ErrInvalidTokenList)
+}
@@ -0,0 +1,203 @@
+package tokenrpc
+
+import (
+	"context"
+	"time"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/Iwinswap/iwinswap-erc20-token-system/tokenrpc/tokensv1"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"google.golang.org/grpc"
+)
+
+var _ token.TokenStore = (*Client)(nil)
+
+// DefaultCallTimeout bounds each call made by a Client whose Timeout is zero.
+const DefaultCallTimeout = 10 * time.Second
+
+// Client is a remote TokenSystem. It implements token.TokenStore, and its methods have
+// the same signatures and errors as those of a local TokenSystem: sentinel errors such
+// as token.ErrTokenNotFound match with errors.Is, and validation failures are
+// *token.ValidationError. View and ViewWithSeq return no error locally, so to keep the
+// signatures of token.TokenStore they hide failures and return nil; use ViewContext and
+// ViewWithSeqContext where a failure must be told apart from an empty registry.
+type Client struct {
+	// Timeout bounds each call. Zero means DefaultCallTimeout.
+	Timeout time.Duration
+
+	conn   *grpc.ClientConn
+	tokens tokensv1.TokensClient
+}
+
+// Dial creates a client for the server at target, such as "tokens.internal:9090". opts
+// must include transport credentials, such as
+// grpc.WithTransportCredentials(insecure.NewCredentials()) for a plaintext connection.
+// The connection is made lazily, so an unreachable server is reported by the first call.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client using an existing connection. Close closes the connection.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn, tokens: tokensv1.NewTokensClient(conn)}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// context returns a context bounded by the client's timeout.
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCallTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// AddToken adds a token and returns its ID.
+func (c *Client) AddToken(addr common.Address, name, symbol string, decimals uint8) (uint64, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.tokens.AddToken(ctx, &tokensv1.AddTokenRequest{
+		Address:  addr.Bytes(),
+		Name:     name,
+		Symbol:   symbol,
+		Decimals: uint32(decimals),
+	})
+	if err != nil {
+		return 0, fromWire(err)
+	}
+	return resp.GetId(), nil
+}
+
+// DeleteToken removes a token.
+func (c *Client) DeleteToken(id uint64) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.tokens.DeleteToken(ctx, &tokensv1.DeleteTokenRequest{Id: id})
+	return fromWire(err)
+}
+
+// UpdateTokenPPM updates a token's fee and transfer gas.
+func (c *Client) UpdateTokenPPM(id uint64, feePPM uint32, gas uint64) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.tokens.UpdateTokenPPM(ctx, &tokensv1.UpdateTokenPPMRequest{Id: id, FeePpm: feePPM, Gas: gas})
+	return fromWire(err)
+}
+
+// GetTokenByID looks up a token by ID.
+func (c *Client) GetTokenByID(id uint64) (token.TokenView, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	msg, err := c.tokens.GetTokenByID(ctx, &tokensv1.GetTokenByIDRequest{Id: id})
+	if err != nil {
+		return token.TokenView{}, fromWire(err)
+	}
+	return fromProto(msg), nil
+}
+
+// GetTokenByAddress looks up a token by address.
+func (c *Client) GetTokenByAddress(addr common.Address) (token.TokenView, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	msg, err := c.tokens.GetTokenByAddress(ctx, &tokensv1.GetTokenByAddressRequest{Address: addr.Bytes()})
+	if err != nil {
+		return token.TokenView{}, fromWire(err)
+	}
+	return fromProto(msg), nil
+}
+
+// View returns every token. It returns nil if the call fails, hiding the error; use
+// ViewContext to see it.
+func (c *Client) View() []token.TokenView {
+	ctx, cancel := c.context()
+	defer cancel()
+	views, _, err := c.ViewWithSeqContext(ctx)
+	if err != nil {
+		return nil
+	}
+	return views
+}
+
+// ViewContext is like View but reports failures.
+func (c *Client) ViewContext(ctx context.Context) ([]token.TokenView, error) {
+	views, _, err := c.ViewWithSeqContext(ctx)
+	return views, err
+}
+
+// ViewWithSeq returns every token with the Seq of the last change it includes, for
+// combining with Watch as described at TokenSystem.Subscribe. It returns nil and zero if
+// the call fails, hiding the error; use ViewWithSeqContext to see it.
+func (c *Client) ViewWithSeq() ([]token.TokenView, uint64) {
+	ctx, cancel := c.context()
+	defer cancel()
+	views, seq, err := c.ViewWithSeqContext(ctx)
+	if err != nil {
+		return nil, 0
+	}
+	return views, seq
+}
+
+// ViewWithSeqContext is like ViewWithSeq but reports failures.
+func (c *Client) ViewWithSeqContext(ctx context.Context) ([]token.TokenView, uint64, error) {
+	resp, err := c.tokens.View(ctx, &tokensv1.ViewRequest{})
+	if err != nil {
+		return nil, 0, fromWire(err)
+	}
+	return viewsFromProto(resp.GetTokens()), resp.GetSeq(), nil
+}
+
+// Watch sends every event committed after it returns to ch, until the subscription is
+// unsubscribed or fails, including by ctx ending; the failure is reported on its Err
+// channel. ch must be drained promptly: if the client falls behind, the server drops
+// events and sends ResyncRequired, as under token.DropOnOverflow.
+func (c *Client) Watch(ctx context.Context, ch chan<- token.Event) (ethereum.Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.tokens.Watch(ctx, &tokensv1.WatchRequest{})
+	if err == nil {
+		// The server sends its headers once subscribed, so no later event is missed.
+		_, err = stream.Header()
+	}
+	if err != nil {
+		cancel()
+		return nil, fromWire(err)
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer cancel()
+		// Recv only returns early when the stream's context is cancelled.
+		go func() {
+			select {
+			case <-quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				select {
+				case <-quit:
+					return nil
+				default:
+					return fromWire(err)
+				}
+			}
+			select {
+			case ch <- eventFromProto(msg):
+			case <-quit:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}), nil
+}
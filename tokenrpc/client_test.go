@@ -0,0 +1,243 @@
+package tokenrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/Iwinswap/iwinswap-erc20-token-system/tokenrpc/tokensv1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// --- Test Helpers ---
+
+// registry is the method set a Client shares with a local TokenSystem.
+type registry interface {
+	token.TokenStore
+	ViewWithSeq() ([]token.TokenView, uint64)
+}
+
+var (
+	_ registry = (*token.TokenSystem)(nil)
+	_ registry = (*Client)(nil)
+)
+
+func addr(b byte) common.Address {
+	var a common.Address
+	a[0] = b
+	return a
+}
+
+// newBufconnClient serves ts over an in-memory connection.
+func newBufconnClient(t *testing.T, ts *token.TokenSystem) *Client {
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(ts)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	c, err := Dial("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// newTCPClient serves ts on a loopback TCP port and returns the server with its client.
+func newTCPClient(t *testing.T, ts *token.TokenSystem) (*grpc.Server, *Client) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer(ts)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	c, err := Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+// exercise runs the same script against a local or remote registry and returns the
+// final view.
+func exercise(t *testing.T, r registry) []token.TokenView {
+	weth, err := r.AddToken(addr(1), "Wrapped Ether", "WETH", 18)
+	require.NoError(t, err)
+	usdc, err := r.AddToken(addr(2), "USD Coin", "USDC", 6)
+	require.NoError(t, err)
+	require.NoError(t, r.UpdateTokenPPM(usdc, 1_000, 55_000))
+
+	view, err := r.GetTokenByAddress(addr(2))
+	require.NoError(t, err)
+	assert.Equal(t, usdc, view.ID)
+	assert.Equal(t, uint32(1_000), view.FeeOnTransferPPM)
+
+	_, err = r.AddToken(addr(1), "Again", "WETH", 18)
+	assert.ErrorIs(t, err, token.ErrAlreadyExists)
+	_, err = r.AddToken(common.Address{}, "Zero", "", 18)
+	var validation *token.ValidationError
+	require.ErrorAs(t, err, &validation)
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+	assert.Len(t, validation.Fields, 2)
+	assert.ErrorIs(t, r.UpdateTokenPPM(weth, 2_000_000, 0), token.ErrInvalidToken)
+
+	require.NoError(t, r.DeleteToken(weth))
+	_, err = r.GetTokenByID(weth)
+	assert.ErrorIs(t, err, token.ErrTokenNotFound)
+	assert.ErrorIs(t, r.DeleteToken(weth), token.ErrTokenNotFound)
+
+	views, seq := r.ViewWithSeq()
+	assert.Equal(t, uint64(4), seq)
+	assert.Equal(t, r.View(), views)
+	return views
+}
+
+// --- Unit Tests ---
+
+func TestClient_MatchesLocal(t *testing.T) {
+	t.Parallel()
+
+	local := exercise(t, token.NewTokenSystem())
+
+	ts := token.NewTokenSystem()
+	remote := exercise(t, newBufconnClient(t, ts))
+	assert.Equal(t, local, remote)
+	assert.Equal(t, local, ts.View(), "remote calls change the served registry")
+
+	ts = token.NewTokenSystem()
+	_, c := newTCPClient(t, ts)
+	assert.Equal(t, local, exercise(t, c))
+}
+
+func TestClient_Watch(t *testing.T) {
+	t.Parallel()
+	ts := token.NewTokenSystem()
+	c := newBufconnClient(t, ts)
+
+	ch := make(chan token.Event, 16)
+	sub, err := c.Watch(context.Background(), ch)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	id, err := c.AddToken(addr(1), "Token", "TKN", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(id, 0, 21_000))
+	require.NoError(t, ts.DeleteToken(id))
+
+	for i, kind := range []token.EventKind{token.TokenAdded, token.TokenUpdated, token.TokenDeleted} {
+		select {
+		case ev := <-ch:
+			assert.Equal(t, uint64(i+1), ev.Seq)
+			assert.Equal(t, kind, ev.Kind)
+			assert.Equal(t, id, ev.Token.ID)
+			if kind == token.TokenUpdated {
+				assert.Equal(t, uint64(21_000), ev.Token.GasForTransfer)
+				assert.Zero(t, ev.Previous.GasForTransfer)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", kind)
+		}
+	}
+
+	sub.Unsubscribe()
+	assert.Nil(t, <-sub.Err(), "unsubscribing is not a failure")
+}
+
+func TestClient_WatchContext(t *testing.T) {
+	t.Parallel()
+	c := newBufconnClient(t, token.NewTokenSystem())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := c.Watch(ctx, make(chan token.Event))
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	cancel()
+	select {
+	case err := <-sub.Err():
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription outlived its context")
+	}
+}
+
+func TestClient_ServerGone(t *testing.T) {
+	t.Parallel()
+	ts := token.NewTokenSystem()
+	srv, c := newTCPClient(t, ts)
+
+	id, err := c.AddToken(addr(1), "Token", "TKN", 18)
+	require.NoError(t, err)
+	_, err = c.GetTokenByID(id + 1)
+	assert.ErrorIs(t, err, token.ErrTokenNotFound)
+
+	views, err := c.ViewContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ts.View(), views)
+	views, seq, err := c.ViewWithSeqContext(context.Background())
+	require.NoError(t, err)
+	localViews, localSeq := ts.ViewWithSeq()
+	assert.Equal(t, localViews, views)
+	assert.Equal(t, localSeq, seq)
+
+	srv.Stop()
+	assert.Nil(t, c.View(), "View returns nil when the server is gone")
+	_, err = c.ViewContext(context.Background())
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	views, seq = c.ViewWithSeq()
+	assert.Nil(t, views, "ViewWithSeq returns nil when the server is gone")
+	assert.Zero(t, seq)
+	_, _, err = c.ViewWithSeqContext(context.Background())
+	assert.Error(t, err)
+	_, err = c.Watch(context.Background(), make(chan token.Event))
+	assert.Error(t, err)
+}
+
+func TestServer_RejectsMalformedRequests(t *testing.T) {
+	t.Parallel()
+	c := newBufconnClient(t, token.NewTokenSystem())
+	ctx := context.Background()
+
+	_, err := c.tokens.AddToken(ctx, &tokensv1.AddTokenRequest{Address: []byte{1, 2, 3}, Symbol: "TKN"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.tokens.AddToken(ctx, &tokensv1.AddTokenRequest{Address: addr(1).Bytes(), Symbol: "TKN", Decimals: 256})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.tokens.GetTokenByAddress(ctx, &tokensv1.GetTokenByAddressRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestErrorMapping(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range sentinels {
+		wire := toWire(s.err)
+		assert.Equal(t, s.code, status.Code(wire))
+		err := fromWire(wire)
+		assert.ErrorIs(t, err, s.err)
+		assert.Equal(t, s.err.Error(), err.Error())
+	}
+
+	validation := &token.ValidationError{Fields: []token.FieldError{
+		{Field: "address", Reason: "must not be zero"},
+		{Field: "symbol", Reason: "must not be empty"},
+	}}
+	wire := toWire(validation)
+	assert.Equal(t, codes.InvalidArgument, status.Code(wire))
+	assert.Equal(t, validation, fromWire(wire))
+
+	other := errors.New("disk full")
+	assert.Same(t, other, toWire(other), "other errors are left to the default status")
+	unknown := status.Error(codes.Internal, "boom")
+	assert.Same(t, unknown, fromWire(unknown), "statuses without registry details pass through")
+	assert.Nil(t, toWire(nil))
+	assert.Nil(t, fromWire(nil))
+}
@@ -0,0 +1,86 @@
+package tokenrpc
+
+import (
+	"math"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/Iwinswap/iwinswap-erc20-token-system/tokenrpc/tokensv1"
+	"github.com/ethereum/go-ethereum/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toProto converts a TokenView into its message.
+func toProto(view token.TokenView) *tokensv1.Token {
+	return &tokensv1.Token{
+		Id:               view.ID,
+		Address:          view.Address.Bytes(),
+		Name:             view.Name,
+		Symbol:           view.Symbol,
+		Decimals:         uint32(view.Decimals),
+		FeeOnTransferPpm: view.FeeOnTransferPPM,
+		GasForTransfer:   view.GasForTransfer,
+		Flags:            uint32(view.Flags),
+	}
+}
+
+// fromProto converts a message from the server into a TokenView. A missing message is the
+// zero TokenView.
+func fromProto(msg *tokensv1.Token) token.TokenView {
+	return token.TokenView{
+		ID:               msg.GetId(),
+		Address:          common.BytesToAddress(msg.GetAddress()),
+		Name:             msg.GetName(),
+		Symbol:           msg.GetSymbol(),
+		Decimals:         uint8(msg.GetDecimals()),
+		FeeOnTransferPPM: msg.GetFeeOnTransferPpm(),
+		GasForTransfer:   msg.GetGasForTransfer(),
+		Flags:            token.RiskFlags(msg.GetFlags()),
+	}
+}
+
+// viewsFromProto converts a list of messages, returning an empty rather than nil slice
+// for an empty registry as a local TokenSystem does.
+func viewsFromProto(msgs []*tokensv1.Token) []token.TokenView {
+	views := make([]token.TokenView, len(msgs))
+	for i, msg := range msgs {
+		views[i] = fromProto(msg)
+	}
+	return views
+}
+
+// eventToProto converts an Event into its message. The kinds share their numbering.
+func eventToProto(ev token.Event) *tokensv1.Event {
+	return &tokensv1.Event{
+		Seq:      ev.Seq,
+		Kind:     tokensv1.Event_Kind(ev.Kind),
+		Token:    toProto(ev.Token),
+		Previous: toProto(ev.Previous),
+	}
+}
+
+// eventFromProto converts a message from the server into an Event.
+func eventFromProto(msg *tokensv1.Event) token.Event {
+	return token.Event{
+		Seq:      msg.GetSeq(),
+		Kind:     token.EventKind(msg.GetKind()),
+		Token:    fromProto(msg.GetToken()),
+		Previous: fromProto(msg.GetPrevious()),
+	}
+}
+
+// addressArg checks an address sent by a client, which must be exactly 20 bytes.
+func addressArg(b []byte) (common.Address, error) {
+	if len(b) != common.AddressLength {
+		return common.Address{}, status.Errorf(codes.InvalidArgument, "address is %d bytes, want %d", len(b), common.AddressLength)
+	}
+	return common.BytesToAddress(b), nil
+}
+
+// decimalsArg checks decimals sent by a client, which the message widens to 32 bits.
+func decimalsArg(d uint32) (uint8, error) {
+	if d > math.MaxUint8 {
+		return 0, status.Errorf(codes.InvalidArgument, "decimals %d exceeds %d", d, math.MaxUint8)
+	}
+	return uint8(d), nil
+}
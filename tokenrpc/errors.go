@@ -0,0 +1,130 @@
+package tokenrpc
+
+import (
+	"errors"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the ErrorInfo domain of the registry's errors.
+const errorDomain = "tokens.iwinswap.v1"
+
+// ErrorInfo reasons sent for the registry's sentinel errors. For reasonInvalidToken the
+// status also carries a BadRequest listing the failed fields. Any other error is sent
+// as codes.Unknown with only its message.
+const (
+	reasonTokenNotFound  = "TOKEN_NOT_FOUND"
+	reasonAlreadyExists  = "ALREADY_EXISTS"
+	reasonInvalidToken   = "INVALID_TOKEN"
+	reasonInvalidFeeRate = "INVALID_FEE_RATE"
+	reasonImpersonation  = "IMPERSONATION"
+	reasonDenied         = "DENIED"
+)
+
+// sentinel is a registry error with the status code and reason it is sent with.
+type sentinel struct {
+	err    error
+	code   codes.Code
+	reason string
+}
+
+// sentinels lists the errors the client rebuilds. ErrInvalidToken is absent because it
+// is rebuilt as a *token.ValidationError.
+var sentinels = []sentinel{
+	{token.ErrTokenNotFound, codes.NotFound, reasonTokenNotFound},
+	{token.ErrAlreadyExists, codes.AlreadyExists, reasonAlreadyExists},
+	{token.ErrInvalidFeeRate, codes.InvalidArgument, reasonInvalidFeeRate},
+	{token.ErrImpersonation, codes.InvalidArgument, reasonImpersonation},
+	{token.ErrDenied, codes.PermissionDenied, reasonDenied},
+}
+
+// toWire gives a registry error the status the client needs to recognise it.
+func toWire(err error) error {
+	if err == nil {
+		return nil
+	}
+	var validation *token.ValidationError
+	if errors.As(err, &validation) {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(validation.Fields))
+		for i, f := range validation.Fields {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Reason}
+		}
+		return withDetails(codes.InvalidArgument, reasonInvalidToken, err,
+			&errdetails.BadRequest{FieldViolations: violations})
+	}
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return withDetails(s.code, s.reason, err)
+		}
+	}
+	return err
+}
+
+// withDetails builds a status for err carrying an ErrorInfo with reason and any extra
+// details.
+func withDetails(code codes.Code, reason string, err error, extra ...protoadapt.MessageV1) error {
+	st := status.New(code, err.Error())
+	details := append([]protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}}, extra...)
+	// Details only fail to attach to an OK status, which is never built here.
+	if withInfo, detailErr := st.WithDetails(details...); detailErr == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// RemoteError is an error from the server that matches a registry sentinel, so that
+// errors.Is(err, token.ErrTokenNotFound) works the same for a Client as for a local
+// TokenSystem.
+type RemoteError struct {
+	// Message is the text of the error on the server.
+	Message  string
+	sentinel error
+}
+
+func (e *RemoteError) Error() string { return e.Message }
+
+// Unwrap returns the sentinel the error stands for.
+func (e *RemoteError) Unwrap() error { return e.sentinel }
+
+// fromWire turns an error received from the server back into the registry error it
+// stands for. Transport errors and unknown reasons are returned unchanged.
+func fromWire(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	var (
+		info       *errdetails.ErrorInfo
+		badRequest *errdetails.BadRequest
+	)
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			if d.GetDomain() == errorDomain {
+				info = d
+			}
+		case *errdetails.BadRequest:
+			badRequest = d
+		}
+	}
+	if info == nil {
+		return err
+	}
+	if info.GetReason() == reasonInvalidToken {
+		validation := &token.ValidationError{}
+		for _, v := range badRequest.GetFieldViolations() {
+			validation.Fields = append(validation.Fields, token.FieldError{Field: v.GetField(), Reason: v.GetDescription()})
+		}
+		return validation
+	}
+	for _, s := range sentinels {
+		if s.reason == info.GetReason() {
+			return &RemoteError{Message: st.Message(), sentinel: s.err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+// Package tokenrpc gives processes remote access to a shared TokenSystem. The server
+// exposes it as the gRPC service iwinswap.tokens.v1.Tokens, defined in
+// tokensv1/tokens.proto, and Client has the same methods as a local TokenSystem, so
+// callers can switch between the two.
+//
+// Registry errors are sent as gRPC statuses carrying a google.rpc.ErrorInfo whose reason
+// names the sentinel, such as "TOKEN_NOT_FOUND". Validation failures also carry a
+// google.rpc.BadRequest listing every failed field. Watch is a server stream of events.
+package tokenrpc
+
+import (
+	"context"
+
+	token "github.com/Iwinswap/iwinswap-erc20-token-system"
+	"github.com/Iwinswap/iwinswap-erc20-token-system/tokenrpc/tokensv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// NewServer returns a grpc.Server serving ts, configured with opts. The server has no
+// access control of its own; add it with interceptors or transport credentials in opts.
+func NewServer(ts *token.TokenSystem, opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(opts...)
+	Register(srv, ts)
+	return srv
+}
+
+// Register adds the Tokens service for ts to an existing server.
+func Register(r grpc.ServiceRegistrar, ts *token.TokenSystem) {
+	tokensv1.RegisterTokensServer(r, &server{ts: ts})
+}
+
+// server implements tokensv1.TokensServer over a TokenSystem.
+type server struct {
+	tokensv1.UnimplementedTokensServer
+	ts *token.TokenSystem
+}
+
+func (s *server) AddToken(_ context.Context, req *tokensv1.AddTokenRequest) (*tokensv1.AddTokenResponse, error) {
+	addr, err := addressArg(req.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := decimalsArg(req.GetDecimals())
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.ts.AddToken(addr, req.GetName(), req.GetSymbol(), decimals)
+	if err != nil {
+		return nil, toWire(err)
+	}
+	return &tokensv1.AddTokenResponse{Id: id}, nil
+}
+
+func (s *server) DeleteToken(_ context.Context, req *tokensv1.DeleteTokenRequest) (*tokensv1.DeleteTokenResponse, error) {
+	if err := s.ts.DeleteToken(req.GetId()); err != nil {
+		return nil, toWire(err)
+	}
+	return &tokensv1.DeleteTokenResponse{}, nil
+}
+
+func (s *server) UpdateTokenPPM(_ context.Context, req *tokensv1.UpdateTokenPPMRequest) (*tokensv1.UpdateTokenPPMResponse, error) {
+	if err := s.ts.UpdateTokenPPM(req.GetId(), req.GetFeePpm(), req.GetGas()); err != nil {
+		return nil, toWire(err)
+	}
+	return &tokensv1.UpdateTokenPPMResponse{}, nil
+}
+
+func (s *server) GetTokenByID(_ context.Context, req *tokensv1.GetTokenByIDRequest) (*tokensv1.Token, error) {
+	view, err := s.ts.GetTokenByID(req.GetId())
+	if err != nil {
+		return nil, toWire(err)
+	}
+	return toProto(view), nil
+}
+
+func (s *server) GetTokenByAddress(_ context.Context, req *tokensv1.GetTokenByAddressRequest) (*tokensv1.Token, error) {
+	addr, err := addressArg(req.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+	view, err := s.ts.GetTokenByAddress(addr)
+	if err != nil {
+		return nil, toWire(err)
+	}
+	return toProto(view), nil
+}
+
+func (s *server) View(context.Context, *tokensv1.ViewRequest) (*tokensv1.ViewResponse, error) {
+	views, seq := s.ts.ViewWithSeq()
+	resp := &tokensv1.ViewResponse{Tokens: make([]*tokensv1.Token, len(views)), Seq: seq}
+	for i, view := range views {
+		resp.Tokens[i] = toProto(view)
+	}
+	return resp, nil
+}
+
+// Watch streams every event committed after the call. It sends the response headers once
+// subscribed, so a client that waits for them misses nothing committed afterwards. The
+// local subscription drops events on overflow, so a slow or stalled client receives
+// ResyncRequired rather than holding up writers.
+func (s *server) Watch(_ *tokensv1.WatchRequest, stream grpc.ServerStreamingServer[tokensv1.Event]) error {
+	events := s.ts.Subscribe(token.SubscribeOptions{})
+	defer events.Close()
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case ev := <-events.C:
+			if err := stream.Send(eventToProto(ev)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
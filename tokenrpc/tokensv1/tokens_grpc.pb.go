@@ -0,0 +1,374 @@
+// TokenSystem served over gRPC. Generated code lives beside this file; regenerate it with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	    --go-grpc_out=. --go-grpc_opt=paths=source_relative tokens.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tokens.proto
+
+package tokensv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tokens_AddToken_FullMethodName          = "/iwinswap.tokens.v1.Tokens/AddToken"
+	Tokens_DeleteToken_FullMethodName       = "/iwinswap.tokens.v1.Tokens/DeleteToken"
+	Tokens_UpdateTokenPPM_FullMethodName    = "/iwinswap.tokens.v1.Tokens/UpdateTokenPPM"
+	Tokens_GetTokenByID_FullMethodName      = "/iwinswap.tokens.v1.Tokens/GetTokenByID"
+	Tokens_GetTokenByAddress_FullMethodName = "/iwinswap.tokens.v1.Tokens/GetTokenByAddress"
+	Tokens_View_FullMethodName              = "/iwinswap.tokens.v1.Tokens/View"
+	Tokens_Watch_FullMethodName             = "/iwinswap.tokens.v1.Tokens/Watch"
+)
+
+// TokensClient is the client API for Tokens service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Tokens mirrors the methods of a local TokenSystem.
+//
+// Registry errors are returned with a google.rpc.ErrorInfo detail whose reason names the
+// sentinel, such as "TOKEN_NOT_FOUND". Validation failures also carry a
+// google.rpc.BadRequest listing every failed field.
+type TokensClient interface {
+	AddToken(ctx context.Context, in *AddTokenRequest, opts ...grpc.CallOption) (*AddTokenResponse, error)
+	DeleteToken(ctx context.Context, in *DeleteTokenRequest, opts ...grpc.CallOption) (*DeleteTokenResponse, error)
+	UpdateTokenPPM(ctx context.Context, in *UpdateTokenPPMRequest, opts ...grpc.CallOption) (*UpdateTokenPPMResponse, error)
+	GetTokenByID(ctx context.Context, in *GetTokenByIDRequest, opts ...grpc.CallOption) (*Token, error)
+	GetTokenByAddress(ctx context.Context, in *GetTokenByAddressRequest, opts ...grpc.CallOption) (*Token, error)
+	View(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*ViewResponse, error)
+	// Watch streams every change committed after the call. A client that falls behind
+	// receives RESYNC_REQUIRED in place of the events it missed.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type tokensClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTokensClient(cc grpc.ClientConnInterface) TokensClient {
+	return &tokensClient{cc}
+}
+
+func (c *tokensClient) AddToken(ctx context.Context, in *AddTokenRequest, opts ...grpc.CallOption) (*AddTokenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddTokenResponse)
+	err := c.cc.Invoke(ctx, Tokens_AddToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokensClient) DeleteToken(ctx context.Context, in *DeleteTokenRequest, opts ...grpc.CallOption) (*DeleteTokenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteTokenResponse)
+	err := c.cc.Invoke(ctx, Tokens_DeleteToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokensClient) UpdateTokenPPM(ctx context.Context, in *UpdateTokenPPMRequest, opts ...grpc.CallOption) (*UpdateTokenPPMResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateTokenPPMResponse)
+	err := c.cc.Invoke(ctx, Tokens_UpdateTokenPPM_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokensClient) GetTokenByID(ctx context.Context, in *GetTokenByIDRequest, opts ...grpc.CallOption) (*Token, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Token)
+	err := c.cc.Invoke(ctx, Tokens_GetTokenByID_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokensClient) GetTokenByAddress(ctx context.Context, in *GetTokenByAddressRequest, opts ...grpc.CallOption) (*Token, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Token)
+	err := c.cc.Invoke(ctx, Tokens_GetTokenByAddress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokensClient) View(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*ViewResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ViewResponse)
+	err := c.cc.Invoke(ctx, Tokens_View_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokensClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tokens_ServiceDesc.Streams[0], Tokens_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tokens_WatchClient = grpc.ServerStreamingClient[Event]
+
+// TokensServer is the server API for Tokens service.
+// All implementations must embed UnimplementedTokensServer
+// for forward compatibility.
+//
+// Tokens mirrors the methods of a local TokenSystem.
+//
+// Registry errors are returned with a google.rpc.ErrorInfo detail whose reason names the
+// sentinel, such as "TOKEN_NOT_FOUND". Validation failures also carry a
+// google.rpc.BadRequest listing every failed field.
+type TokensServer interface {
+	AddToken(context.Context, *AddTokenRequest) (*AddTokenResponse, error)
+	DeleteToken(context.Context, *DeleteTokenRequest) (*DeleteTokenResponse, error)
+	UpdateTokenPPM(context.Context, *UpdateTokenPPMRequest) (*UpdateTokenPPMResponse, error)
+	GetTokenByID(context.Context, *GetTokenByIDRequest) (*Token, error)
+	GetTokenByAddress(context.Context, *GetTokenByAddressRequest) (*Token, error)
+	View(context.Context, *ViewRequest) (*ViewResponse, error)
+	// Watch streams every change committed after the call. A client that falls behind
+	// receives RESYNC_REQUIRED in place of the events it missed.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedTokensServer()
+}
+
+// UnimplementedTokensServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTokensServer struct{}
+
+func (UnimplementedTokensServer) AddToken(context.Context, *AddTokenRequest) (*AddTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddToken not implemented")
+}
+func (UnimplementedTokensServer) DeleteToken(context.Context, *DeleteTokenRequest) (*DeleteTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteToken not implemented")
+}
+func (UnimplementedTokensServer) UpdateTokenPPM(context.Context, *UpdateTokenPPMRequest) (*UpdateTokenPPMResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTokenPPM not implemented")
+}
+func (UnimplementedTokensServer) GetTokenByID(context.Context, *GetTokenByIDRequest) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTokenByID not implemented")
+}
+func (UnimplementedTokensServer) GetTokenByAddress(context.Context, *GetTokenByAddressRequest) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTokenByAddress not implemented")
+}
+func (UnimplementedTokensServer) View(context.Context, *ViewRequest) (*ViewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method View not implemented")
+}
+func (UnimplementedTokensServer) Watch(*WatchRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedTokensServer) mustEmbedUnimplementedTokensServer() {}
+func (UnimplementedTokensServer) testEmbeddedByValue()                {}
+
+// UnsafeTokensServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TokensServer will
+// result in compilation errors.
+type UnsafeTokensServer interface {
+	mustEmbedUnimplementedTokensServer()
+}
+
+func RegisterTokensServer(s grpc.ServiceRegistrar, srv TokensServer) {
+	// If the following call pancis, it indicates UnimplementedTokensServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tokens_ServiceDesc, srv)
+}
+
+func _Tokens_AddToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).AddToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tokens_AddToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokensServer).AddToken(ctx, req.(*AddTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tokens_DeleteToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).DeleteToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tokens_DeleteToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokensServer).DeleteToken(ctx, req.(*DeleteTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tokens_UpdateTokenPPM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTokenPPMRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).UpdateTokenPPM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tokens_UpdateTokenPPM_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokensServer).UpdateTokenPPM(ctx, req.(*UpdateTokenPPMRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tokens_GetTokenByID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTokenByIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).GetTokenByID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tokens_GetTokenByID_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokensServer).GetTokenByID(ctx, req.(*GetTokenByIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tokens_GetTokenByAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTokenByAddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).GetTokenByAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tokens_GetTokenByAddress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokensServer).GetTokenByAddress(ctx, req.(*GetTokenByAddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tokens_View_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).View(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tokens_View_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokensServer).View(ctx, req.(*ViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tokens_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TokensServer).Watch(m, &grpc.GenericServerStream[WatchRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tokens_WatchServer = grpc.ServerStreamingServer[Event]
+
+// Tokens_ServiceDesc is the grpc.ServiceDesc for Tokens service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tokens_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "iwinswap.tokens.v1.Tokens",
+	HandlerType: (*TokensServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddToken",
+			Handler:    _Tokens_AddToken_Handler,
+		},
+		{
+			MethodName: "DeleteToken",
+			Handler:    _Tokens_DeleteToken_Handler,
+		},
+		{
+			MethodName: "UpdateTokenPPM",
+			Handler:    _Tokens_UpdateTokenPPM_Handler,
+		},
+		{
+			MethodName: "GetTokenByID",
+			Handler:    _Tokens_GetTokenByID_Handler,
+		},
+		{
+			MethodName: "GetTokenByAddress",
+			Handler:    _Tokens_GetTokenByAddress_Handler,
+		},
+		{
+			MethodName: "View",
+			Handler:    _Tokens_View_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Tokens_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tokens.proto",
+}
@@ -0,0 +1,116 @@
+package token
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrTxClosed is returned when a Tx is used after the Update call that created it has returned.
+var ErrTxClosed = errors.New("transaction closed")
+
+// Tx is a set of registry changes made inside TokenSystem.Update. Its operations apply to a
+// private copy of the registry, so they see each other's effects, but nothing becomes
+// visible to other callers until Update commits. A Tx must not be used concurrently or
+// after Update returns.
+type Tx struct {
+	ts        *TokenSystem
+	registry  *TokenRegistry
+	mutations []mutation
+	events    []Event
+	closed    bool
+}
+
+// Update runs fn as a single atomic change under the write lock. If fn returns nil, every
+// operation it made is committed at once; when a write-ahead log is attached they are
+// written as one record. If fn returns an error or panics, none of them are, and the
+// registry is left exactly as it was, including its next ID and token order.
+//
+// The transaction works on a copy of the registry, so each Update costs O(n) in the
+// number of tokens. Readers are not blocked by fn in lock-free mode; otherwise they wait
+// until Update returns, so fn should not perform slow work such as network calls. fn must
+// use tx rather than ts: calling a TokenSystem method that takes the lock would deadlock.
+func (ts *TokenSystem) Update(fn func(tx *Tx) error) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	tx := &Tx{ts: ts, registry: cloneRegistry(ts.registry)}
+	defer func() { tx.closed = true }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	// The mutations were validated in order against the transaction's copy, which is how
+	// recovery replays them, so they can be logged without checking again.
+	return ts.install(tx.registry, tx.mutations, tx.events)
+}
+
+// apply validates m against the transaction's registry, applies it and records it.
+func (tx *Tx) apply(m mutation) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	ev, err := tx.ts.stage(m, tx.registry)
+	if err != nil {
+		return err
+	}
+	tx.mutations = append(tx.mutations, m)
+	tx.events = append(tx.events, ev)
+	return nil
+}
+
+// AddToken adds a token within the transaction and returns its ID. The ID is only
+// consumed if the transaction commits.
+func (tx *Tx) AddToken(addr common.Address, name, symbol string, decimals uint8) (uint64, error) {
+	id := tx.registry.nextID
+	err := tx.apply(mutation{
+		kind:     mutationAdd,
+		id:       id,
+		address:  addr,
+		name:     name,
+		symbol:   symbol,
+		decimals: decimals,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// DeleteToken removes a token within the transaction.
+func (tx *Tx) DeleteToken(id uint64) error {
+	return tx.apply(mutation{kind: mutationDelete, id: id})
+}
+
+// UpdateTokenPPM updates a token's fee and transfer gas within the transaction.
+func (tx *Tx) UpdateTokenPPM(id uint64, feePPM uint32, gas uint64) error {
+	return tx.apply(mutation{
+		kind:             mutationUpdate,
+		id:               id,
+		feeOnTransferPPM: feePPM,
+		gasForTransfer:   gas,
+	})
+}
+
+// GetTokenByID looks up a token, including the transaction's own uncommitted changes.
+func (tx *Tx) GetTokenByID(id uint64) (TokenView, error) {
+	if tx.closed {
+		return TokenView{}, ErrTxClosed
+	}
+	return getTokenByID(id, tx.registry)
+}
+
+// GetTokenByAddress looks up a token, including the transaction's own uncommitted changes.
+func (tx *Tx) GetTokenByAddress(addr common.Address) (TokenView, error) {
+	if tx.closed {
+		return TokenView{}, ErrTxClosed
+	}
+	return getTokenByAddress(addr, tx.registry)
+}
+
+// View returns every token, including the transaction's own uncommitted changes.
+func (tx *Tx) View() []TokenView {
+	if tx.closed {
+		return nil
+	}
+	return viewRegistry(tx.registry)
+}
@@ -0,0 +1,190 @@
+package token
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// populateTestSystem adds four tokens to a TokenSystem and returns their IDs.
+func populateTestSystem(t *testing.T, ts *TokenSystem) []uint64 {
+	ids := make([]uint64, 4)
+	for i := range ids {
+		var err error
+		ids[i], err = ts.AddToken(addr(byte(i+1)), "Token", "TKN", 18)
+		require.NoError(t, err)
+	}
+	return ids
+}
+
+// --- Unit Tests ---
+
+func TestTokenSystem_UpdateCommits(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Locked"},
+		{name: "LockFree", opts: []Option{WithLockFreeReads()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ts := NewTokenSystem(tc.opts...)
+			ids := populateTestSystem(t, ts)
+
+			var added uint64
+			err := ts.Update(func(tx *Tx) error {
+				var err error
+				added, err = tx.AddToken(addr(5), "Token E", "TKE", 6)
+				if err != nil {
+					return err
+				}
+				if err := tx.DeleteToken(ids[0]); err != nil {
+					return err
+				}
+				if err := tx.UpdateTokenPPM(added, 25_000, 70000); err != nil {
+					return err
+				}
+
+				// The transaction reads its own writes.
+				view, err := tx.GetTokenByID(added)
+				require.NoError(t, err)
+				assert.Equal(t, uint32(25_000), view.FeeOnTransferPPM)
+				_, err = tx.GetTokenByAddress(addr(1))
+				assert.ErrorIs(t, err, ErrTokenNotFound)
+				assert.Len(t, tx.View(), 4)
+
+				// Lock-free readers can run during the transaction and must not see it.
+				if ts.lockFree {
+					_, err = ts.GetTokenByID(added)
+					assert.ErrorIs(t, err, ErrTokenNotFound)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+
+			assert.Len(t, ts.View(), 4)
+			_, err = ts.GetTokenByID(ids[0])
+			assert.ErrorIs(t, err, ErrTokenNotFound)
+			view, err := ts.GetTokenByAddress(addr(5))
+			require.NoError(t, err)
+			assert.Equal(t, TokenView{ID: added, Address: addr(5), Name: "Token E", Symbol: "TKE", Decimals: 6, FeeOnTransferPPM: 25_000, GasForTransfer: 70000}, view)
+		})
+	}
+}
+
+func TestTokenSystem_UpdateRollsBack(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	ids := populateTestSystem(t, ts)
+	before := ts.State()
+	errAbort := errors.New("abort")
+
+	err := ts.Update(func(tx *Tx) error {
+		// Consume IDs, reorder the columns with a swap-and-pop delete and change a fee.
+		if _, err := tx.AddToken(addr(5), "Token E", "TKE", 6); err != nil {
+			return err
+		}
+		if err := tx.DeleteToken(ids[1]); err != nil {
+			return err
+		}
+		if err := tx.UpdateTokenPPM(ids[3], 90_000, 1); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+	assert.Equal(t, before, ts.State(), "order, next ID and tombstones are unchanged")
+
+	// An operation error inside the callback aborts the same way when returned.
+	err = ts.Update(func(tx *Tx) error {
+		if _, err := tx.AddToken(addr(6), "Token F", "TKF", 6); err != nil {
+			return err
+		}
+		_, err := tx.AddToken(addr(2), "Dup", "DUP", 18)
+		return err
+	})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, before, ts.State())
+
+	id, err := ts.AddToken(addr(7), "Token G", "TKG", 18)
+	require.NoError(t, err)
+	assert.Equal(t, before.NextID, id, "IDs consumed by rolled-back transactions are reissued")
+}
+
+func TestTokenSystem_UpdateRollsBackOnPanic(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem(WithLockFreeReads())
+	populateTestSystem(t, ts)
+	before := ts.State()
+
+	assert.Panics(t, func() {
+		_ = ts.Update(func(tx *Tx) error {
+			_, _ = tx.AddToken(addr(5), "Token E", "TKE", 6)
+			panic("boom")
+		})
+	})
+	assert.Equal(t, before, ts.State())
+
+	// The lock must have been released.
+	_, err := ts.AddToken(addr(5), "Token E", "TKE", 6)
+	assert.NoError(t, err)
+}
+
+func TestTokenSystem_UpdateTxClosed(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+	var leaked *Tx
+	require.NoError(t, ts.Update(func(tx *Tx) error {
+		leaked = tx
+		return nil
+	}))
+
+	_, err := leaked.AddToken(addr(1), "Token A", "TKA", 18)
+	assert.ErrorIs(t, err, ErrTxClosed)
+	_, err = leaked.GetTokenByID(1)
+	assert.ErrorIs(t, err, ErrTxClosed)
+	assert.Empty(t, ts.View())
+}
+
+func TestTokenSystem_UpdateWithWAL(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	ids := populateTestSystem(t, ts)
+
+	// A transaction may depend on its own earlier operations, which commit cannot.
+	require.NoError(t, ts.Update(func(tx *Tx) error {
+		id, err := tx.AddToken(addr(5), "Token E", "TKE", 6)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateTokenPPM(id, 10_000, 21000); err != nil {
+			return err
+		}
+		if err := tx.DeleteToken(id); err != nil {
+			return err
+		}
+		return tx.DeleteToken(ids[2])
+	}))
+	sizeBefore := ts.wal.size
+	require.Error(t, ts.Update(func(tx *Tx) error {
+		_, _ = tx.AddToken(addr(6), "Token F", "TKF", 6)
+		return errors.New("abort")
+	}))
+	assert.Equal(t, sizeBefore, ts.wal.size, "a rolled-back transaction writes nothing")
+
+	expected := ts.State()
+	require.NoError(t, ts.Close())
+
+	recovered, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assert.Equal(t, expected, recovered.State())
+}
@@ -0,0 +1,192 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrInvalidToken is wrapped by every ValidationError.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Validator checks token data before the TokenSystem writes it. Rejections should be
+// returned as a *ValidationError so callers can inspect every violated field.
+type Validator interface {
+	// ValidateAdd checks a token about to be added. Its ID is not assigned yet, and its
+	// fee and gas are zero.
+	ValidateAdd(view TokenView) error
+	// ValidateUpdate checks the fee and transfer gas about to be set on an existing token.
+	ValidateUpdate(current TokenView, feePPM uint32, gas uint64) error
+}
+
+// FieldError is one violated rule. Field uses the TokenView JSON names.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists every field of a token that failed validation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error joins every field error into one message.
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrInvalidToken.Error())
+	for i, f := range e.Fields {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(f.Field)
+		b.WriteString(": ")
+		b.WriteString(f.Reason)
+	}
+	return b.String()
+}
+
+// Unwrap makes every ValidationError match ErrInvalidToken.
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidToken
+}
+
+// add records a violation of field.
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// errOrNil returns e if any field failed, and nil otherwise.
+func (e *ValidationError) errOrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ValidationRules is the built-in Validator. Besides the configurable limits, it always
+// requires a non-zero address, a non-empty symbol, names and symbols of printable UTF-8,
+// and a fee of at most 100%.
+type ValidationRules struct {
+	// MaxNameLength and MaxSymbolLength limit the length in characters. Zero means no limit.
+	MaxNameLength   int
+	MaxSymbolLength int
+	// MaxDecimals bounds the decimals. Zero means no limit.
+	MaxDecimals uint8
+}
+
+// DefaultValidationRules returns the rules every TokenSystem uses unless WithValidator
+// says otherwise. 77 decimals is the most for which one whole token fits in a uint256.
+func DefaultValidationRules() ValidationRules {
+	return ValidationRules{
+		MaxNameLength:   64,
+		MaxSymbolLength: 32,
+		MaxDecimals:     77,
+	}
+}
+
+// ValidateAdd implements Validator.
+func (r ValidationRules) ValidateAdd(view TokenView) error {
+	var verr ValidationError
+	if view.Address == (common.Address{}) {
+		verr.add("address", "zero address")
+	}
+	r.checkText(&verr, "name", view.Name, r.MaxNameLength)
+	if view.Symbol == "" {
+		verr.add("symbol", "empty")
+	} else {
+		r.checkText(&verr, "symbol", view.Symbol, r.MaxSymbolLength)
+	}
+	if r.MaxDecimals > 0 && view.Decimals > r.MaxDecimals {
+		verr.add("decimals", "%d exceeds %d", view.Decimals, r.MaxDecimals)
+	}
+	return verr.errOrNil()
+}
+
+// ValidateUpdate implements Validator.
+func (r ValidationRules) ValidateUpdate(current TokenView, feePPM uint32, gas uint64) error {
+	var verr ValidationError
+	if feePPM > FeeDenominator {
+		verr.add("feeOnTransferPPM", "%d exceeds 100%%", feePPM)
+	}
+	return verr.errOrNil()
+}
+
+// checkText requires s to be printable UTF-8 of at most maxLen characters.
+func (r ValidationRules) checkText(verr *ValidationError, field, s string, maxLen int) {
+	if !utf8.ValidString(s) {
+		verr.add(field, "not valid UTF-8")
+		return
+	}
+	if n := utf8.RuneCountInString(s); maxLen > 0 && n > maxLen {
+		verr.add(field, "%d characters exceeds %d", n, maxLen)
+	}
+	if i := strings.IndexFunc(s, func(c rune) bool { return !unicode.IsPrint(c) }); i >= 0 {
+		c, _ := utf8.DecodeRuneInString(s[i:])
+		verr.add(field, "unprintable character %U", c)
+	}
+}
+
+// WithValidator replaces the Validator applied to every add and update. Nil disables
+// validation beyond the registry's own integrity checks.
+func WithValidator(validator Validator) Option {
+	return func(ts *TokenSystem) {
+		ts.validator = validator
+	}
+}
+
+// validate runs the denylist, the configured Validator and the canonical guard on m
+// against registry.
+func (ts *TokenSystem) validate(m mutation, registry *TokenRegistry) error {
+	switch m.kind {
+	case mutationAdd:
+		if err := ts.checkDenylist(m); err != nil {
+			return err
+		}
+		if ts.validator != nil {
+			err := ts.validator.ValidateAdd(TokenView{
+				Address:  m.address,
+				Name:     m.name,
+				Symbol:   m.symbol,
+				Decimals: m.decimals,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return ts.guardCanonical(m, registry)
+	case mutationUpdate:
+		if ts.validator == nil {
+			return nil
+		}
+		current, err := getTokenByID(m.id, registry)
+		if err != nil {
+			return err
+		}
+		return ts.validator.ValidateUpdate(current, m.feeOnTransferPPM, m.gasForTransfer)
+	case mutationMetadata:
+		// A renamed token must pass the rules a new token with its metadata would.
+		current, err := getTokenByID(m.id, registry)
+		if err != nil {
+			return err
+		}
+		if ts.validator != nil {
+			err := ts.validator.ValidateAdd(TokenView{
+				Address:  current.Address,
+				Name:     m.name,
+				Symbol:   m.symbol,
+				Decimals: m.decimals,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return ts.guardCanonical(mutation{address: current.Address, name: m.name, symbol: m.symbol}, registry)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package token
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// fieldsOf returns the names of the fields err reports, failing the test if err is not a
+// *ValidationError.
+func fieldsOf(t *testing.T, err error) []string {
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	fields := make([]string, len(verr.Fields))
+	for i, f := range verr.Fields {
+		fields[i] = f.Field
+	}
+	return fields
+}
+
+// rejectAll is a Validator that refuses every change.
+type rejectAll struct{}
+
+func (rejectAll) ValidateAdd(TokenView) error                    { return errors.New("no adds") }
+func (rejectAll) ValidateUpdate(TokenView, uint32, uint64) error { return errors.New("no updates") }
+
+// --- Unit Tests ---
+
+func TestValidationRules_ValidateAdd(t *testing.T) {
+	t.Parallel()
+	rules := DefaultValidationRules()
+
+	testCases := []struct {
+		name     string
+		view     TokenView
+		expected []string
+	}{
+		{name: "Valid", view: TokenView{Address: addr(1), Name: "USD Coin", Symbol: "USDC", Decimals: 6}},
+		{name: "Unicode", view: TokenView{Address: addr(1), Name: "Ünïcödé Tøken 🚀", Symbol: "ÜT", Decimals: 18}},
+		{name: "Empty name", view: TokenView{Address: addr(1), Symbol: "X", Decimals: 18}},
+		{name: "Zero address", view: TokenView{Name: "A", Symbol: "A"}, expected: []string{"address"}},
+		{name: "Empty symbol", view: TokenView{Address: addr(1), Name: "A"}, expected: []string{"symbol"}},
+		{name: "Long name", view: TokenView{Address: addr(1), Name: strings.Repeat("a", 10_000), Symbol: "A"}, expected: []string{"name"}},
+		{name: "Long symbol", view: TokenView{Address: addr(1), Symbol: strings.Repeat("é", 33)}, expected: []string{"symbol"}},
+		{name: "Decimals", view: TokenView{Address: addr(1), Symbol: "A", Decimals: 78}, expected: []string{"decimals"}},
+		{name: "Control character", view: TokenView{Address: addr(1), Name: "A\nB", Symbol: "A"}, expected: []string{"name"}},
+		{name: "Bidi override", view: TokenView{Address: addr(1), Name: "A", Symbol: "A‮B"}, expected: []string{"symbol"}},
+		{name: "Invalid UTF-8", view: TokenView{Address: addr(1), Name: "\xff", Symbol: "A"}, expected: []string{"name"}},
+		{
+			name:     "Every violation is reported",
+			view:     TokenView{Name: strings.Repeat("\t", 65), Decimals: 255},
+			expected: []string{"address", "name", "name", "symbol", "decimals"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := rules.ValidateAdd(tc.view)
+			if len(tc.expected) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tc.expected, fieldsOf(t, err))
+		})
+	}
+
+	// Zero limits are unlimited.
+	assert.NoError(t, ValidationRules{}.ValidateAdd(TokenView{Address: addr(1), Name: strings.Repeat("a", 10_000), Symbol: "A", Decimals: 255}))
+}
+
+func TestValidationError_Message(t *testing.T) {
+	t.Parallel()
+	err := DefaultValidationRules().ValidateAdd(TokenView{Name: "ok", Symbol: ""})
+	assert.EqualError(t, err, "invalid token: address: zero address; symbol: empty")
+}
+
+func TestTokenSystem_Validation(t *testing.T) {
+	t.Parallel()
+	ts := NewTokenSystem()
+
+	_, err := ts.AddToken(common.Address{}, "Zero", "", 18)
+	assert.Equal(t, []string{"address", "symbol"}, fieldsOf(t, err))
+	assert.Empty(t, ts.View())
+
+	id, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	err = ts.UpdateTokenPPM(id, FeeDenominator+1, 0)
+	assert.Equal(t, []string{"feeOnTransferPPM"}, fieldsOf(t, err))
+	assert.ErrorIs(t, ts.UpdateTokenPPM(999, 0, 0), ErrTokenNotFound)
+
+	// Batches reject only the invalid tokens.
+	result := ts.AddTokens([]TokenMetadata{
+		{Address: addr(2), Name: "Token B", Symbol: "TKB", Decimals: 18},
+		{Address: addr(3), Name: "Bad\x00", Symbol: "BAD", Decimals: 18},
+	})
+	assert.Contains(t, result.Added, addr(2))
+	assert.Equal(t, []string{"name"}, fieldsOf(t, result.Failed[addr(3)]))
+
+	// Transactions validate each operation as it is made.
+	err = ts.Update(func(tx *Tx) error {
+		_, err := tx.AddToken(addr(4), "Token D", "TKD", 200)
+		return err
+	})
+	assert.Equal(t, []string{"decimals"}, fieldsOf(t, err))
+	assert.Len(t, ts.View(), 2)
+}
+
+func TestTokenSystem_WithValidator(t *testing.T) {
+	t.Parallel()
+
+	custom := NewTokenSystem(WithValidator(rejectAll{}))
+	_, err := custom.AddToken(addr(1), "Token A", "TKA", 18)
+	assert.EqualError(t, err, "no adds")
+
+	disabled := NewTokenSystem(WithValidator(nil))
+	id, err := disabled.AddToken(common.Address{}, "", "", 255)
+	require.NoError(t, err)
+	assert.ErrorIs(t, disabled.UpdateTokenPPM(id, FeeDenominator+1, 0), ErrInvalidFeeRate, "the registry still bounds fees")
+
+	strict := NewTokenSystem(WithValidator(ValidationRules{MaxSymbolLength: 4, MaxDecimals: 18}))
+	_, err = strict.AddToken(addr(1), "Token A", "TOKEN", 24)
+	assert.Equal(t, []string{"symbol", "decimals"}, fieldsOf(t, err))
+}
@@ -0,0 +1,449 @@
+package token
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WAL layout (all integers little-endian):
+//
+//	header:
+//	  magic         [4]byte  "IWAL"
+//	  version       uint16
+//	  baseChecksum  uint32   checksum of the snapshot the log applies on top of
+//	records, repeated:
+//	  length        uint32   payload length
+//	  checksum      uint32   CRC-32 (Castagnoli) of the payload
+//	  payload:
+//	    count       uint32
+//	    mutations   [count]
+//	mutation:
+//	  kind          uint8
+//	  id            uint64
+//	  add:    address [20]byte, name, symbol (uint32 length, bytes), decimals uint8
+//	  update: fee uint32 parts per million, gas uint64
+//	  flags:  flags uint32
+//	  metadata: name, symbol (uint32 length, bytes), decimals uint8
+//
+// A record is only acknowledged once it has been fully written (and synced, unless
+// WALOptions.NoSync is set), so a last record that fails its length or checksum check can
+// only be the torn tail of an interrupted append and is truncated during recovery. A
+// damaged record followed by others is corruption, which recovery refuses, as is a length
+// above maxWALRecordLen, which no append ever writes.
+const (
+	walMagic   = "IWAL"
+	walVersion = uint16(1)
+
+	walHeaderLen       = 4 + 2 + 4
+	walRecordHeaderLen = 4 + 4
+
+	// maxWALRecordLen bounds the payload of a single record, which holds a batch of
+	// mutations, so that recovery can tell a damaged length field from a torn tail.
+	maxWALRecordLen = 64 << 20
+)
+
+var (
+	// ErrInvalidWAL is returned when a log file does not start with a valid WAL header.
+	ErrInvalidWAL = errors.New("invalid WAL: bad header")
+	// ErrUnsupportedWALVersion is returned when the log was written by an unknown format version.
+	ErrUnsupportedWALVersion = errors.New("invalid WAL: unsupported format version")
+	// ErrWALCorrupt is returned when a record before the end of the log fails its checksum,
+	// or a record declares a length no append writes.
+	ErrWALCorrupt = errors.New("invalid WAL: corrupt record")
+	// ErrWALRecordTooLarge is returned when a batch of mutations does not fit in a single
+	// log record. Nothing is applied; split the batch.
+	ErrWALRecordTooLarge = errors.New("WAL record too large")
+	// ErrWALReplay is returned when an intact log record cannot be applied on top of the snapshot.
+	ErrWALReplay = errors.New("invalid WAL: record cannot be replayed")
+	// ErrSnapshotMissing is returned when a log exists but the snapshot it builds on does not.
+	ErrSnapshotMissing = errors.New("snapshot file missing for existing WAL")
+	// ErrWALFailed is returned by mutations once a record could not be synced, or a failed
+	// record could not be removed from the log. Compact replaces the log with a snapshot of
+	// the registry as it is in memory and clears the failure.
+	ErrWALFailed = errors.New("WAL failed: log may hold a record that was not applied")
+	// ErrNoWAL is returned by Compact when the TokenSystem has no write-ahead log attached.
+	ErrNoWAL = errors.New("token system has no write-ahead log")
+	// ErrWALClosed is returned by mutations after the TokenSystem has been closed.
+	ErrWALClosed = errors.New("write-ahead log is closed")
+)
+
+// WALOptions configures a durable TokenSystem opened with OpenTokenSystem.
+type WALOptions struct {
+	// SnapshotPath is the binary snapshot the log is replayed on top of. It is created
+	// empty if neither it nor the log exists yet.
+	SnapshotPath string
+	// WALPath is the append-only log of mutations made since the snapshot was written.
+	WALPath string
+	// CompactThreshold compacts the log into a fresh snapshot once it grows beyond this
+	// many bytes. Zero disables automatic compaction; Compact can still be called manually.
+	CompactThreshold int64
+	// NoSync skips the fsync after each append. Mutations then survive a process crash
+	// but not an operating system crash or power loss.
+	NoSync bool
+}
+
+// OpenTokenSystem recovers a TokenSystem from the snapshot and write-ahead log named in
+// walOpts and keeps the log attached, so every subsequent AddToken, DeleteToken and
+// UpdateTokenPPM is durably recorded before it is acknowledged. Call Close when done.
+func OpenTokenSystem(walOpts WALOptions, opts ...Option) (*TokenSystem, error) {
+	registry, checksum, err := loadSnapshotFile(walOpts.SnapshotPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, statErr := os.Stat(walOpts.WALPath); statErr == nil {
+			return nil, fmt.Errorf("%w: %s", ErrSnapshotMissing, walOpts.SnapshotPath)
+		}
+		registry = NewTokenRegistry()
+		checksum, err = writeSnapshotFile(walOpts.SnapshotPath, registry)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wal, err := recoverWAL(walOpts.WALPath, checksum, registry, walOpts.NoSync)
+	if err != nil {
+		return nil, err
+	}
+	ts := newTokenSystem(registry, opts)
+	ts.wal = wal
+	ts.walOptions = walOpts
+	return ts, nil
+}
+
+// Compact writes the current registry to a fresh snapshot and starts an empty log on top
+// of it. It acquires a full write lock.
+func (ts *TokenSystem) Compact() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.wal == nil {
+		return ErrNoWAL
+	}
+	return ts.compact()
+}
+
+// Close releases the write-ahead log. Mutations made after Close fail with ErrWALClosed.
+// It is a no-op for a TokenSystem without a log.
+func (ts *TokenSystem) Close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.wal == nil {
+		return nil
+	}
+	return ts.wal.close()
+}
+
+// compact replaces the snapshot before the log. If the process dies between the two
+// renames, the old log no longer matches the new snapshot's checksum and is discarded
+// on recovery, which is safe because the snapshot already contains its records.
+func (ts *TokenSystem) compact() error {
+	if ts.wal.file == nil {
+		return ErrWALClosed
+	}
+	checksum, err := writeSnapshotFile(ts.walOptions.SnapshotPath, ts.registry)
+	if err != nil {
+		return err
+	}
+	wal, err := createWAL(ts.walOptions.WALPath, checksum, ts.walOptions.NoSync)
+	if err != nil {
+		return err
+	}
+	ts.wal.close()
+	ts.wal = wal
+	return nil
+}
+
+// writeAheadLog is an open, append-only log file positioned after its last valid record.
+type writeAheadLog struct {
+	file   walFile
+	size   int64
+	noSync bool
+	failed error // Set once the file may hold a record that was reported as failed
+}
+
+// walFile is the part of *os.File the log uses.
+type walFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// recoverWAL opens the log at path and replays every intact record onto the registry.
+// A torn tail is truncated away; a damaged record anywhere else fails with ErrWALCorrupt.
+// A log whose base checksum does not match the snapshot was already folded into it by a
+// compaction that crashed before replacing the log, so it is discarded. A missing log is
+// created.
+func recoverWAL(path string, baseChecksum uint32, registry *TokenRegistry, noSync bool) (*writeAheadLog, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return createWAL(path, baseChecksum, noSync)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < walHeaderLen || !bytes.Equal(data[:len(walMagic)], []byte(walMagic)) {
+		return nil, ErrInvalidWAL
+	}
+	version := binary.LittleEndian.Uint16(data[4:6])
+	if version != walVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedWALVersion, version)
+	}
+	if binary.LittleEndian.Uint32(data[6:walHeaderLen]) != baseChecksum {
+		return createWAL(path, baseChecksum, noSync)
+	}
+
+	offset := walHeaderLen
+	for len(data)-offset >= walRecordHeaderLen {
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		checksum := binary.LittleEndian.Uint32(data[offset+4:])
+		start := offset + walRecordHeaderLen
+		if length > maxWALRecordLen {
+			return nil, fmt.Errorf("%w: record at offset %d declares %d bytes", ErrWALCorrupt, offset, length)
+		}
+		if length > len(data)-start {
+			break
+		}
+		payload := data[start : start+length]
+		if crc32.Checksum(payload, snapshotCRCTable) != checksum {
+			// Only the last record can be torn; a bad record with others after it means
+			// the log is corrupt, and truncating would silently drop the later records.
+			if start+length != len(data) {
+				return nil, fmt.Errorf("%w: record at offset %d", ErrWALCorrupt, offset)
+			}
+			break
+		}
+
+		mutations, err := decodeWALRecord(payload)
+		if err != nil {
+			return nil, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		for _, m := range mutations {
+			if err := applyMutation(m, registry); err != nil {
+				return nil, fmt.Errorf("%w: record at offset %d: %w", ErrWALReplay, offset, err)
+			}
+		}
+		offset = start + length
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if offset < len(data) {
+		if err := file.Truncate(int64(offset)); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &writeAheadLog{file: file, size: int64(offset), noSync: noSync}, nil
+}
+
+// createWAL atomically replaces the file at path with an empty log based on baseChecksum.
+func createWAL(path string, baseChecksum uint32, noSync bool) (*writeAheadLog, error) {
+	header := make([]byte, 0, walHeaderLen)
+	header = append(header, walMagic...)
+	header = binary.LittleEndian.AppendUint16(header, walVersion)
+	header = binary.LittleEndian.AppendUint32(header, baseChecksum)
+
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(header)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{file: file, size: walHeaderLen, noSync: noSync}, nil
+}
+
+// append writes the mutations as a single record, so they are recovered all or nothing.
+func (w *writeAheadLog) append(mutations ...mutation) error {
+	if w.file == nil {
+		return ErrWALClosed
+	}
+	if w.failed != nil {
+		return w.failed
+	}
+
+	payload := binary.LittleEndian.AppendUint32(nil, uint32(len(mutations)))
+	for _, m := range mutations {
+		payload = appendWALMutation(payload, m)
+	}
+	if len(payload) > maxWALRecordLen {
+		return fmt.Errorf("%w: %d bytes for %d mutations", ErrWALRecordTooLarge, len(payload), len(mutations))
+	}
+	record := make([]byte, 0, walRecordHeaderLen+len(payload))
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(payload)))
+	record = binary.LittleEndian.AppendUint32(record, crc32.Checksum(payload, snapshotCRCTable))
+	record = append(record, payload...)
+
+	if _, err := w.file.Write(record); err != nil {
+		// Drop the partial record so later appends do not land behind it.
+		if truncateErr := w.file.Truncate(w.size); truncateErr != nil {
+			w.failed = fmt.Errorf("%w: %w", ErrWALFailed, errors.Join(err, truncateErr))
+			return w.failed
+		}
+		return err
+	}
+	if !w.noSync {
+		if err := w.file.Sync(); err != nil {
+			// The whole record is in the file, and recovery would replay a mutation that is
+			// reported as failed. Remove it, but after a failed sync nothing more is known
+			// about what reached the disk, so refuse further appends until the log is
+			// replaced.
+			w.failed = fmt.Errorf("%w: %w", ErrWALFailed, errors.Join(err, w.file.Truncate(w.size)))
+			return w.failed
+		}
+	}
+	w.size += int64(len(record))
+	return nil
+}
+
+func (w *writeAheadLog) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func appendWALMutation(buf []byte, m mutation) []byte {
+	buf = append(buf, byte(m.kind))
+	buf = binary.LittleEndian.AppendUint64(buf, m.id)
+	switch m.kind {
+	case mutationAdd:
+		buf = append(buf, m.address.Bytes()...)
+		buf = appendBinaryString(buf, m.name)
+		buf = appendBinaryString(buf, m.symbol)
+		buf = append(buf, m.decimals)
+	case mutationUpdate:
+		buf = binary.LittleEndian.AppendUint32(buf, m.feeOnTransferPPM)
+		buf = binary.LittleEndian.AppendUint64(buf, m.gasForTransfer)
+	case mutationFlags:
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(m.flags))
+	case mutationMetadata:
+		buf = appendBinaryString(buf, m.name)
+		buf = appendBinaryString(buf, m.symbol)
+		buf = append(buf, m.decimals)
+	}
+	return buf
+}
+
+func decodeWALRecord(payload []byte) ([]mutation, error) {
+	d := &binaryDecoder{buf: payload, errCorrupt: ErrWALReplay}
+	count := d.uint32()
+	if count > uint32(len(d.buf)) {
+		return nil, fmt.Errorf("%w: mutation count %d exceeds record size", ErrWALReplay, count)
+	}
+
+	mutations := make([]mutation, count)
+	for i := range mutations {
+		m := &mutations[i]
+		m.kind = mutationKind(d.uint8())
+		m.id = d.uint64()
+		switch m.kind {
+		case mutationAdd:
+			m.address = common.BytesToAddress(d.bytes(common.AddressLength))
+			m.name = d.string()
+			m.symbol = d.string()
+			m.decimals = d.uint8()
+		case mutationDelete:
+		case mutationUpdate:
+			m.feeOnTransferPPM = d.uint32()
+			m.gasForTransfer = d.uint64()
+		case mutationFlags:
+			m.flags = RiskFlags(d.uint32())
+		case mutationMetadata:
+			m.name = d.string()
+			m.symbol = d.string()
+			m.decimals = d.uint8()
+		default:
+			if d.err == nil {
+				return nil, fmt.Errorf("%w: unknown mutation kind %d", ErrWALReplay, m.kind)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.buf) != 0 {
+		return nil, fmt.Errorf("%w: %d unread record bytes", ErrWALReplay, len(d.buf))
+	}
+	return mutations, nil
+}
+
+// loadSnapshotFile reads the snapshot at path and returns the registry and its checksum.
+func loadSnapshotFile(path string) (*TokenRegistry, uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return readSnapshot(bufio.NewReader(f))
+}
+
+// writeSnapshotFile atomically replaces the snapshot at path and returns its checksum.
+func writeSnapshotFile(path string, registry *TokenRegistry) (uint32, error) {
+	var checksum uint32
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		var err error
+		checksum, err = writeSnapshot(w, registry)
+		return err
+	})
+	return checksum, err
+}
+
+// writeFileAtomic writes to a temporary file in the same directory, syncs it, and renames
+// it over path so readers observe either the old or the new contents, never a mixture.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once the rename has succeeded.
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a preceding rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,360 @@
+package token
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Test Helpers ---
+
+// newTestWALOptions returns options pointing at fresh files in a per-test directory.
+func newTestWALOptions(t *testing.T) WALOptions {
+	dir := t.TempDir()
+	return WALOptions{
+		SnapshotPath: filepath.Join(dir, "tokens.snap"),
+		WALPath:      filepath.Join(dir, "tokens.wal"),
+		NoSync:       true, // fsync adds nothing to crash simulation within one process
+	}
+}
+
+// openTestSystem opens a durable TokenSystem and closes it when the test ends.
+func openTestSystem(t *testing.T, opts WALOptions) *TokenSystem {
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { ts.Close() })
+	return ts
+}
+
+// populate performs a representative mix of mutations and returns the resulting view.
+func populate(t *testing.T, ts *TokenSystem) []TokenView {
+	idA, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	idB, err := ts.AddToken(addr(2), "Token B", "TKB", 6)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(3), "Token C", "TKC", 8)
+	require.NoError(t, err)
+	require.NoError(t, ts.UpdateTokenPPM(idA, 25_000, 70000))
+	require.NoError(t, ts.SetFlags(idA, FlagPausable|FlagUpgradeable))
+	require.NoError(t, ts.ClearFlags(idA, FlagUpgradeable))
+	require.NoError(t, ts.DeleteToken(idB))
+	return ts.View()
+}
+
+// failingSyncFile is a log file whose Sync always fails.
+type failingSyncFile struct {
+	walFile
+}
+
+func (failingSyncFile) Sync() error { return errors.New("sync: input/output error") }
+
+// failingFile is a log file whose Sync and Truncate always fail.
+type failingFile struct {
+	failingSyncFile
+}
+
+func (failingFile) Truncate(int64) error { return errors.New("truncate: input/output error") }
+
+// --- Unit Tests ---
+
+func TestWAL_RecoverAfterReopen(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	expected := populate(t, ts)
+	require.NoError(t, ts.Close()) // Simulates a crash: no compaction has happened
+
+	recovered := openTestSystem(t, opts)
+	assert.Equal(t, expected, recovered.View())
+
+	// The ID counter must also be recovered, including the deleted ID 2.
+	id, err := recovered.AddToken(addr(4), "Token D", "TKD", 18)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), id)
+}
+
+func TestWAL_FailedMutationsAreNotLogged(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	ts := openTestSystem(t, opts)
+
+	_, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	sizeBefore := ts.wal.size
+
+	_, err = ts.AddToken(addr(1), "Token A", "TKA", 18)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.ErrorIs(t, ts.DeleteToken(999), ErrTokenNotFound)
+	assert.ErrorIs(t, ts.UpdateTokenPPM(999, 10_000, 1), ErrTokenNotFound)
+	assert.Equal(t, sizeBefore, ts.wal.size)
+}
+
+func TestWAL_TruncatesTornTail(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	intactSize := ts.wal.size
+	_, err = ts.AddToken(addr(2), "Token B", "TKB", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.Close())
+
+	// Chop the second record in half, as if the process died mid-write.
+	info, err := os.Stat(opts.WALPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(opts.WALPath, intactSize+(info.Size()-intactSize)/2))
+
+	recovered := openTestSystem(t, opts)
+	views := recovered.View()
+	require.Len(t, views, 1)
+	assert.Equal(t, "Token A", views[0].Name)
+
+	info, err = os.Stat(opts.WALPath)
+	require.NoError(t, err)
+	assert.Equal(t, intactSize, info.Size(), "torn tail should be truncated away")
+
+	// New appends must land directly after the last intact record.
+	_, err = recovered.AddToken(addr(3), "Token C", "TKC", 18)
+	require.NoError(t, err)
+	require.NoError(t, recovered.Close())
+	assert.Len(t, openTestSystem(t, opts).View(), 2)
+}
+
+func TestWAL_CorruptRecordChecksumIsTreatedAsTail(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.Close())
+
+	data, err := os.ReadFile(opts.WALPath)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xFF
+	require.NoError(t, os.WriteFile(opts.WALPath, data, 0o644))
+
+	assert.Empty(t, openTestSystem(t, opts).View())
+}
+
+func TestWAL_CorruptRecordBeforeTailIsRejected(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	firstEnd := ts.wal.size
+	_, err = ts.AddToken(addr(2), "Token B", "TKB", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.Close())
+
+	data, err := os.ReadFile(opts.WALPath)
+	require.NoError(t, err)
+	data[firstEnd-1] ^= 0xFF
+	require.NoError(t, os.WriteFile(opts.WALPath, data, 0o644))
+
+	_, err = OpenTokenSystem(opts)
+	assert.ErrorIs(t, err, ErrWALCorrupt)
+	after, err := os.ReadFile(opts.WALPath)
+	require.NoError(t, err)
+	assert.Equal(t, data, after, "the later record is not truncated away")
+}
+
+func TestWAL_OversizedRecordLengthIsRejected(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	_, err = ts.AddToken(addr(2), "Token B", "TKB", 18)
+	require.NoError(t, err)
+	require.NoError(t, ts.Close())
+
+	// A flipped high bit in the first record's length runs past the end of the file,
+	// like a torn tail, but no append writes a record that long.
+	data, err := os.ReadFile(opts.WALPath)
+	require.NoError(t, err)
+	data[walHeaderLen+3] ^= 0x80
+	require.NoError(t, os.WriteFile(opts.WALPath, data, 0o644))
+
+	_, err = OpenTokenSystem(opts)
+	assert.ErrorIs(t, err, ErrWALCorrupt)
+	after, err := os.ReadFile(opts.WALPath)
+	require.NoError(t, err)
+	assert.Equal(t, data, after, "the records are not truncated away")
+}
+
+func TestWAL_Compact(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	expected := populate(t, ts)
+	require.NoError(t, ts.Compact())
+	assert.Equal(t, int64(walHeaderLen), ts.wal.size)
+	require.NoError(t, ts.Close())
+
+	recovered := openTestSystem(t, opts)
+	assert.Equal(t, expected, recovered.View())
+}
+
+func TestWAL_CompactThreshold(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	opts.CompactThreshold = 200
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	for i := 1; i <= 20; i++ {
+		_, err := ts.AddToken(addr(byte(i)), "Token", "TKN", 18)
+		require.NoError(t, err)
+		assert.Less(t, ts.wal.size, opts.CompactThreshold)
+	}
+	expected := ts.View()
+	require.NoError(t, ts.Close())
+
+	assert.Equal(t, expected, openTestSystem(t, opts).View())
+}
+
+func TestWAL_StaleLogAfterInterruptedCompaction(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+
+	ts, err := OpenTokenSystem(opts)
+	require.NoError(t, err)
+	expected := populate(t, ts)
+
+	// Perform only the first half of a compaction: the snapshot is replaced but the
+	// log that was folded into it is left behind.
+	_, err = writeSnapshotFile(opts.SnapshotPath, ts.registry)
+	require.NoError(t, err)
+	require.NoError(t, ts.Close())
+
+	recovered := openTestSystem(t, opts)
+	assert.Equal(t, expected, recovered.View(), "stale log must not be replayed twice")
+}
+
+func TestWAL_OpenErrors(t *testing.T) {
+	t.Parallel()
+	t.Run("MissingSnapshot", func(t *testing.T) {
+		opts := newTestWALOptions(t)
+		ts, err := OpenTokenSystem(opts)
+		require.NoError(t, err)
+		require.NoError(t, ts.Close())
+		require.NoError(t, os.Remove(opts.SnapshotPath))
+
+		_, err = OpenTokenSystem(opts)
+		assert.ErrorIs(t, err, ErrSnapshotMissing)
+	})
+
+	t.Run("BadHeader", func(t *testing.T) {
+		opts := newTestWALOptions(t)
+		ts, err := OpenTokenSystem(opts)
+		require.NoError(t, err)
+		require.NoError(t, ts.Close())
+		require.NoError(t, os.WriteFile(opts.WALPath, []byte("garbage!!!"), 0o644))
+
+		_, err = OpenTokenSystem(opts)
+		assert.ErrorIs(t, err, ErrInvalidWAL)
+	})
+}
+
+func TestWAL_FailedSyncIsNotReplayed(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	opts.NoSync = false
+	ts := openTestSystem(t, opts)
+	_, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	require.NoError(t, err)
+	healthy := ts.wal.file
+	ts.wal.file = failingSyncFile{healthy}
+
+	_, err = ts.AddToken(addr(2), "Token B", "TKB", 18)
+	assert.ErrorIs(t, err, ErrWALFailed)
+	ts.wal.file = healthy
+	_, err = ts.AddToken(addr(3), "Token C", "TKC", 18)
+	assert.ErrorIs(t, err, ErrWALFailed, "the log refuses appends until it is replaced")
+	assert.Len(t, ts.View(), 1)
+
+	// The failed record was removed, so recovery neither replays it nor reuses its ID.
+	require.NoError(t, ts.Close())
+	reopened := openTestSystem(t, opts)
+	assert.Len(t, reopened.View(), 1)
+	id, err := reopened.AddToken(addr(2), "Token B", "TKB", 18)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), id)
+
+	// Compact replaces a failed log.
+	reopened.wal.file = failingSyncFile{reopened.wal.file}
+	_, err = reopened.AddToken(addr(3), "Token C", "TKC", 18)
+	require.ErrorIs(t, err, ErrWALFailed)
+	require.NoError(t, reopened.Compact())
+	_, err = reopened.AddToken(addr(3), "Token C", "TKC", 18)
+	assert.NoError(t, err)
+}
+
+func TestWAL_FailedTruncateIsReported(t *testing.T) {
+	t.Parallel()
+	opts := newTestWALOptions(t)
+	opts.NoSync = false
+	ts := openTestSystem(t, opts)
+	healthy := ts.wal.file
+	ts.wal.file = failingFile{failingSyncFile{healthy}}
+
+	_, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	assert.ErrorIs(t, err, ErrWALFailed)
+	assert.ErrorContains(t, err, "truncate: input/output error")
+	ts.wal.file = healthy
+	_, err = ts.AddToken(addr(1), "Token A", "TKA", 18)
+	assert.ErrorIs(t, err, ErrWALFailed, "the log refuses appends until it is replaced")
+	assert.Empty(t, ts.View())
+}
+
+func TestWAL_ClosedAndDetached(t *testing.T) {
+	t.Parallel()
+	ts := openTestSystem(t, newTestWALOptions(t))
+	require.NoError(t, ts.Close())
+
+	_, err := ts.AddToken(addr(1), "Token A", "TKA", 18)
+	assert.ErrorIs(t, err, ErrWALClosed)
+	assert.Empty(t, ts.View(), "a mutation that could not be logged must not be applied")
+
+	assert.ErrorIs(t, NewTokenSystem().Compact(), ErrNoWAL)
+}
+
+// --- Benchmarking ---
+
+func BenchmarkWAL_AddToken(b *testing.B) {
+	dir := b.TempDir()
+	ts, err := OpenTokenSystem(WALOptions{
+		SnapshotPath: filepath.Join(dir, "tokens.snap"),
+		WALPath:      filepath.Join(dir, "tokens.wal"),
+		NoSync:       true,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ts.Close()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		a := addr(byte(i))
+		a[1], a[2], a[3] = byte(i>>8), byte(i>>16), byte(i>>24)
+		ts.AddToken(a, "bench", "B", 18)
+	}
+}